@@ -28,6 +28,15 @@ import (
 )
 
 func Main() int {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case validator.CommandValidate:
+			return validator.RunValidate(os.Args[2:], os.Stdout, os.Stderr)
+		case validator.CommandLint:
+			return validator.RunLint(os.Args[2:], os.Stdout, os.Stderr)
+		}
+	}
+
 	app := &validator.App{}
 	service.Setup(app)
 	log.InitializeLogging("kubevirt-template-validator")
@@ -0,0 +1,10 @@
+#!/bin/bash
+{
+RET=0
+echo 'Negative test - Create a template with broken rules'
+if $KUBECTL create -n default -f manifests/invalid/template-with-broken-rules.yaml ; then
+	RET=1
+	$KUBECTL delete -n default -f manifests/invalid/template-with-broken-rules.yaml
+fi
+exit $RET
+}
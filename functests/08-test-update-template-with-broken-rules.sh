@@ -0,0 +1,12 @@
+#!/bin/bash
+{
+RET=0
+echo 'Negative test - Update a template with broken rules'
+$KUBECTL create -n default -f manifests/template-with-rules.yaml || exit 2
+sleep 1s
+if $KUBECTL annotate -n default --overwrite template fedora-desktop-small-with-rules validations='[{"name": "SupportedChipset", "path": "jsonpath::.spec.domain.machine.type", "rule": "regex", "regex": "(q35"}]' ; then
+	RET=1
+fi
+$KUBECTL delete -n default -f manifests/template-with-rules.yaml
+exit $RET
+}
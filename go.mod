@@ -5,16 +5,23 @@ go 1.15
 require (
 	github.com/davecgh/go-spew v1.1.1
 	github.com/fsnotify/fsnotify v1.4.9
+	github.com/go-openapi/spec v0.19.3
+	github.com/google/cel-go v0.7.3
+	github.com/hashicorp/golang-lru v0.5.4
 	github.com/onsi/ginkgo v1.12.1
 	github.com/onsi/gomega v1.10.1
 	github.com/openshift/api v0.0.0
 	github.com/openshift/client-go v0.0.0
 	github.com/spf13/pflag v1.0.5
+	github.com/xeipuuv/gojsonschema v1.2.0
+	google.golang.org/genproto v0.0.0-20201110150050-8816d57aaa9a
 	k8s.io/api v0.20.6
 	k8s.io/apimachinery v0.20.6
 	k8s.io/client-go v12.0.0+incompatible
 	k8s.io/klog v1.0.0
+	k8s.io/kube-openapi v0.0.0-20201113171705-d219536bb9fd
 	kubevirt.io/client-go v0.38.1
+	sigs.k8s.io/yaml v1.2.0
 )
 
 replace (
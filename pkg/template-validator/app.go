@@ -55,6 +55,7 @@ type App struct {
 	TLSInfo       k8sutils.TLSInfo
 	versionOnly   bool
 	skipInformers bool
+	ratcheting    bool
 }
 
 var _ service.Service = &App{}
@@ -70,6 +71,7 @@ func (app *App) AddFlags() {
 	flag.StringVarP(&app.TLSInfo.CertsDirectory, "cert-dir", "c", "", "specify path to the directory containing TLS key and certificate - this enables TLS")
 	flag.BoolVarP(&app.versionOnly, "version", "V", false, "show version and exit")
 	flag.BoolVarP(&app.skipInformers, "skip-informers", "S", false, "don't initialize informerers - use this only in devel mode")
+	flag.BoolVar(&app.ratcheting, "ratcheting", false, "on updates, tolerate the violations already found in the previous version of the VM")
 }
 
 func (app *App) KubevirtVersion() string {
@@ -95,10 +97,15 @@ func (app *App) Run() {
 		virtinformers.SetInformers(nil)
 	}
 
+	if app.ratcheting {
+		log.Log.Infof("validator app: ratcheting of the pre-existing violations ENABLED")
+	}
+
 	informers := virtinformers.GetInformers()
 	if !informers.Available() {
 		log.Log.Infof("validator app: template informer NOT available")
 	} else {
+		validating.RegisterTemplateInvalidation(informers.TemplateInformer)
 		go informers.TemplateInformer.Run(stopChan)
 		log.Log.Infof("validator app: started informers")
 		cache.WaitForCacheSync(
@@ -111,7 +118,10 @@ func (app *App) Run() {
 	log.Log.Infof("validator app: running with TLSInfo.CertsDirectory%+v", app.TLSInfo.CertsDirectory)
 
 	http.HandleFunc(validating.VMTemplateValidatePath, func(w http.ResponseWriter, r *http.Request) {
-		validating.ServeVMTemplateValidate(w, r)
+		validating.ServeVMTemplateValidate(w, r, app.ratcheting)
+	})
+	http.HandleFunc(validating.TemplateValidatePath, func(w http.ResponseWriter, r *http.Request) {
+		validating.ServeTemplateValidate(w, r)
 	})
 
 	if app.TLSInfo.IsEnabled() {
@@ -0,0 +1,105 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2019 Red Hat, Inc.
+ */
+
+package validator
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	flag "github.com/spf13/pflag"
+
+	"github.com/kubevirt/kubevirt-template-validator/pkg/validation"
+)
+
+const (
+	CommandLint string = "lint"
+
+	ExitClean  int = 0
+	ExitIssues int = 1
+)
+
+// LintReport collects the issues found in the rules of one file.
+type LintReport struct {
+	File   string                 `json:"file"`
+	Issues []validation.LintIssue `json:"issues"`
+}
+
+// RunLint implements the `lint` command: it checks the rules found in Templates
+// (or in plain rules files) without evaluating them. Returns the process exit code.
+func RunLint(args []string, stdout, stderr io.Writer) int {
+	var output string
+
+	flags := flag.NewFlagSet(CommandLint, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVarP(&output, "output", "o", outputHuman, "output format: human or json")
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: %s [--output human|json] FILE...\n", CommandLint)
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return ExitError
+	}
+	if flags.NArg() == 0 || (output != outputHuman && output != outputJSON) {
+		flags.Usage()
+		return ExitError
+	}
+
+	var reports []LintReport
+	for _, file := range flags.Args() {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			fmt.Fprintf(stderr, "cannot read %s: %v\n", file, err)
+			return ExitError
+		}
+		rules, err := extractRules(data)
+		if err != nil {
+			fmt.Fprintf(stderr, "cannot read the rules from %s: %v\n", file, err)
+			return ExitError
+		}
+		reports = append(reports, LintReport{
+			File:   file,
+			Issues: validation.Lint(rules),
+		})
+	}
+
+	if output == outputJSON {
+		data, err := json.MarshalIndent(reports, "", "  ")
+		if err != nil {
+			fmt.Fprintf(stderr, "cannot encode the reports: %v\n", err)
+			return ExitError
+		}
+		fmt.Fprintln(stdout, string(data))
+	} else {
+		for _, report := range reports {
+			for _, issue := range report.Issues {
+				fmt.Fprintf(stdout, "%s: %s\n", report.File, issue)
+			}
+		}
+	}
+
+	for _, report := range reports {
+		if len(report.Issues) > 0 {
+			return ExitIssues
+		}
+	}
+	return ExitClean
+}
@@ -0,0 +1,79 @@
+package validator_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	validator "github.com/kubevirt/kubevirt-template-validator/pkg/template-validator"
+)
+
+var _ = Describe("Lint", func() {
+	var (
+		dir            string
+		stdout, stderr *bytes.Buffer
+	)
+
+	writeFile := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		Expect(ioutil.WriteFile(path, []byte(content), 0644)).To(Succeed())
+		return path
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "lint")
+		Expect(err).ToNot(HaveOccurred())
+		stdout = new(bytes.Buffer)
+		stderr = new(bytes.Buffer)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("should accept clean templates", func() {
+		tmpl := writeFile("template.yaml", templateWithRules)
+
+		code := validator.RunLint([]string{tmpl}, stdout, stderr)
+		Expect(code).To(Equal(validator.ExitClean), stdout.String())
+		Expect(stdout.String()).To(BeEmpty())
+	})
+
+	It("should report the issues", func() {
+		rules := writeFile("rules.json", `[{
+			"name": "typo",
+			"path": "jsonpath::.spec.domain.cpu.coers",
+			"rule": "integer",
+			"message": "at most 4 cores",
+			"max": 4
+		}]`)
+
+		code := validator.RunLint([]string{rules}, stdout, stderr)
+		Expect(code).To(Equal(validator.ExitIssues))
+		Expect(stdout.String()).To(Equal(rules + ": rules[0] (typo) path: .spec.domain.cpu: unknown field \"coers\" in CPU\n"))
+	})
+
+	It("should emit JSON", func() {
+		rules := writeFile("rules.json", `[{"name": "incomplete", "rule": "integer"}]`)
+
+		code := validator.RunLint([]string{"-o", "json", rules}, stdout, stderr)
+		Expect(code).To(Equal(validator.ExitIssues))
+
+		var reports []validator.LintReport
+		Expect(json.Unmarshal(stdout.Bytes(), &reports)).To(Succeed())
+		Expect(reports).To(HaveLen(1))
+		Expect(reports[0].File).To(Equal(rules))
+		Expect(reports[0].Issues).ToNot(BeEmpty())
+	})
+
+	It("should fail on unreadable files", func() {
+		code := validator.RunLint([]string{filepath.Join(dir, "missing.yaml")}, stdout, stderr)
+		Expect(code).To(Equal(validator.ExitError))
+	})
+})
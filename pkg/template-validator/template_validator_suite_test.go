@@ -0,0 +1,13 @@
+package validator_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestTemplateValidator(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Template Validator Suite")
+}
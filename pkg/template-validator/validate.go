@@ -0,0 +1,313 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2019 Red Hat, Inc.
+ */
+
+package validator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	templatev1 "github.com/openshift/api/template/v1"
+	flag "github.com/spf13/pflag"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	k6tv1 "kubevirt.io/client-go/api/v1"
+	"kubevirt.io/client-go/log"
+	sigsyaml "sigs.k8s.io/yaml"
+
+	"github.com/kubevirt/kubevirt-template-validator/pkg/validation"
+	"github.com/kubevirt/kubevirt-template-validator/pkg/webhooks/validating"
+)
+
+// Exit codes of the offline commands, meant to be consumed by CI.
+const (
+	ExitAdmitted int = 0
+	ExitRejected int = 1
+	ExitError    int = 2
+)
+
+const (
+	CommandValidate string = "validate"
+
+	outputHuman string = "human"
+	outputJSON  string = "json"
+
+	templateKind string = "Template"
+	// the same annotation the webhook reads from the parent template
+	templateValidationsKey string = "validations"
+)
+
+// ValidateReport is the outcome of the evaluation of the rules against one VM.
+type ValidateReport struct {
+	File     string               `json:"file"`
+	VM       string               `json:"vm"`
+	Admitted bool                 `json:"admitted"`
+	Causes   []metav1.StatusCause `json:"causes,omitempty"`
+	Warnings []string             `json:"warnings,omitempty"`
+	Rules    []RuleReport         `json:"rules"`
+}
+
+// RuleReport is the serializable form of validation.Report
+type RuleReport struct {
+	Name    string       `json:"name"`
+	Rule    string       `json:"rule"`
+	Element string       `json:"element,omitempty"`
+	Status  string       `json:"status"`
+	Message string       `json:"message,omitempty"`
+	Error   string       `json:"error,omitempty"`
+	Nested  []RuleReport `json:"nested,omitempty"`
+}
+
+const (
+	statusSatisfied string = "satisfied"
+	statusFailed    string = "failed"
+	statusSkipped   string = "skipped"
+	statusError     string = "error"
+)
+
+// RunValidate implements the `validate` command: it evaluates the rules found in a Template
+// (or in a plain rules file) against VM manifests, exactly like the webhook does on admission:
+// the VMs skipping the validation, or carrying their own rules, are handled the same way.
+// Returns the process exit code.
+func RunValidate(args []string, stdout, stderr io.Writer) int {
+	var rulesFile, output string
+	var verbose bool
+
+	flags := flag.NewFlagSet(CommandValidate, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVarP(&rulesFile, "rules", "r", "", "Template YAML/JSON, or plain validation rules, to evaluate")
+	flags.StringVarP(&output, "output", "o", outputHuman, "output format: human or json")
+	flags.BoolVar(&verbose, "verbose", false, "emit the evaluation logs on stderr")
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: %s --rules FILE [--output human|json] VM_FILE...\n", CommandValidate)
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return ExitError
+	}
+	if rulesFile == "" || flags.NArg() == 0 || (output != outputHuman && output != outputJSON) {
+		flags.Usage()
+		return ExitError
+	}
+
+	if verbose {
+		log.Log.SetIOWriter(stderr)
+	} else {
+		log.Log.SetIOWriter(ioutil.Discard)
+	}
+
+	rs, err := readRuleSet(rulesFile)
+	if err != nil {
+		fmt.Fprintf(stderr, "cannot read the rules from %s: %v\n", rulesFile, err)
+		return ExitError
+	}
+	rs = rs.WithSource("file " + rulesFile)
+
+	var reports []ValidateReport
+	for _, vmFile := range flags.Args() {
+		vms, err := readVirtualMachines(vmFile)
+		if err != nil {
+			fmt.Fprintf(stderr, "cannot read the VMs from %s: %v\n", vmFile, err)
+			return ExitError
+		}
+		for _, vm := range vms {
+			report, err := validateVM(rs, vmFile, vm)
+			if err != nil {
+				fmt.Fprintf(stderr, "cannot read the rules of VM %s from %s: %v\n", vm.Name, vmFile, err)
+				return ExitError
+			}
+			reports = append(reports, report)
+		}
+	}
+
+	if output == outputJSON {
+		data, err := json.MarshalIndent(reports, "", "  ")
+		if err != nil {
+			fmt.Fprintf(stderr, "cannot encode the reports: %v\n", err)
+			return ExitError
+		}
+		fmt.Fprintln(stdout, string(data))
+	} else {
+		for _, report := range reports {
+			printValidateReport(stdout, &report)
+		}
+	}
+
+	for _, report := range reports {
+		if !report.Admitted {
+			return ExitRejected
+		}
+	}
+	return ExitAdmitted
+}
+
+// validateVM evaluates the rules the webhook would select for the VM: the rules given
+// stand for the ones of its template, see validating.SelectRuleSetForVM.
+func validateVM(rs *validation.RuleSet, file string, vm *k6tv1.VirtualMachine) (ValidateReport, error) {
+	vmRuleSet, err := validating.SelectRuleSetForVM(vm, func() (*validation.RuleSet, error) {
+		return rs, nil
+	})
+	if err != nil {
+		return ValidateReport{}, err
+	}
+	res := validating.EvaluateVMTemplate(vmRuleSet, vm, nil, false)
+	report := ValidateReport{
+		File:     file,
+		VM:       vm.Name,
+		Admitted: res.Succeeded(),
+		Warnings: res.Warnings,
+		Rules:    toRuleReports(res.Status),
+	}
+	if !res.Succeeded() {
+		report.Causes = res.ToStatusCauses()
+	}
+	return report, nil
+}
+
+func toRuleReports(reports []validation.Report) []RuleReport {
+	var ret []RuleReport
+	for _, rr := range reports {
+		report := RuleReport{
+			Name:    rr.Ref.Name,
+			Rule:    rr.Ref.Rule,
+			Element: rr.Element,
+			Message: rr.Message,
+			Nested:  toRuleReports(rr.Nested),
+		}
+		switch {
+		case rr.Error != nil:
+			report.Status = statusError
+			report.Error = rr.Error.Error()
+		case rr.Skipped:
+			report.Status = statusSkipped
+			report.Message = rr.SkipReason
+		case rr.Satisfied:
+			report.Status = statusSatisfied
+		default:
+			report.Status = statusFailed
+		}
+		ret = append(ret, report)
+	}
+	return ret
+}
+
+func printValidateReport(w io.Writer, report *ValidateReport) {
+	outcome := "ADMITTED"
+	if !report.Admitted {
+		outcome = "REJECTED"
+	}
+	fmt.Fprintf(w, "%s (%s): %s\n", report.VM, report.File, outcome)
+	printRuleReports(w, report.Rules, 1)
+	for _, warning := range report.Warnings {
+		fmt.Fprintf(w, "  warning: %s\n", warning)
+	}
+}
+
+func printRuleReports(w io.Writer, reports []RuleReport, depth int) {
+	indent := strings.Repeat("  ", depth)
+	for _, rr := range reports {
+		name := rr.Name
+		if rr.Element != "" {
+			name = fmt.Sprintf("%s@%s", rr.Name, rr.Element)
+		}
+		switch rr.Status {
+		case statusError:
+			fmt.Fprintf(w, "%s[%s] %s: %s\n", indent, strings.ToUpper(rr.Status), name, rr.Error)
+		default:
+			fmt.Fprintf(w, "%s[%s] %s: %s\n", indent, strings.ToUpper(rr.Status), name, rr.Message)
+		}
+		printRuleReports(w, rr.Nested, depth+1)
+	}
+}
+
+// readRuleSet reads either a Template, taking the rules from its annotation, or plain rules.
+func readRuleSet(path string) (*validation.RuleSet, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := extractRules(data)
+	if err != nil {
+		return nil, err
+	}
+	return validation.CompileRules(rules)
+}
+
+func extractRules(data []byte) ([]byte, error) {
+	jsonData, err := sigsyaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	typeMeta := metav1.TypeMeta{}
+	// plain rules are a list, so they can't be decoded as objects
+	if err := json.Unmarshal(jsonData, &typeMeta); err != nil || typeMeta.Kind != templateKind {
+		return jsonData, nil
+	}
+
+	tmpl := templatev1.Template{}
+	if err := json.Unmarshal(jsonData, &tmpl); err != nil {
+		return nil, err
+	}
+	rules, ok := tmpl.Annotations[templateValidationsKey]
+	if !ok {
+		return nil, fmt.Errorf("template %s has no %s annotation", tmpl.Name, templateValidationsKey)
+	}
+	return []byte(rules), nil
+}
+
+// readVirtualMachines reads all the VMs from a YAML stream or JSON file.
+func readVirtualMachines(path string) ([]*k6tv1.VirtualMachine, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var vms []*k6tv1.VirtualMachine
+	decoder := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), 4096)
+	for {
+		vm := k6tv1.VirtualMachine{}
+		err := decoder.Decode(&vm)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if vm.Kind == "" && vm.Name == "" {
+			// empty YAML document
+			continue
+		}
+		if vm.Kind != "VirtualMachine" {
+			return nil, fmt.Errorf("unexpected kind %q, expected VirtualMachine", vm.Kind)
+		}
+		if vm.Spec.Template == nil {
+			// the rules are evaluated against the template, like the webhook does
+			return nil, fmt.Errorf("VirtualMachine %s has no spec.template", vm.Name)
+		}
+		vms = append(vms, &vm)
+	}
+	if len(vms) == 0 {
+		return nil, fmt.Errorf("no VirtualMachine found")
+	}
+	return vms, nil
+}
@@ -0,0 +1,233 @@
+package validator_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	validator "github.com/kubevirt/kubevirt-template-validator/pkg/template-validator"
+)
+
+const templateWithRules = `apiVersion: template.openshift.io/v1
+kind: Template
+metadata:
+  name: fedora-small
+  annotations:
+    validations: |
+      [
+        {
+          "name": "minimal-memory",
+          "path": "jsonpath::.spec.domain.resources.requests.memory",
+          "rule": "quantity",
+          "message": "memory must be at least 1Gi",
+          "min": "1Gi"
+        }, {
+          "name": "cpu-cores",
+          "valid": "jsonpath::.spec.domain.cpu.cores",
+          "path": "jsonpath::.spec.domain.cpu.cores",
+          "rule": "integer",
+          "message": "at most 4 cores",
+          "max": 4
+        }
+      ]
+objects: []
+`
+
+const vmTemplate = `apiVersion: kubevirt.io/v1alpha3
+kind: VirtualMachine
+metadata:
+  name: %s
+spec:
+  template:
+    spec:
+      domain:
+        devices: {}
+        resources:
+          requests:
+            memory: %s
+`
+
+func newVMManifest(name, memory string) string {
+	return fmt.Sprintf(vmTemplate, name, memory)
+}
+
+var _ = Describe("Validate", func() {
+	var (
+		dir            string
+		stdout, stderr *bytes.Buffer
+	)
+
+	writeFile := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		Expect(ioutil.WriteFile(path, []byte(content), 0644)).To(Succeed())
+		return path
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "validate")
+		Expect(err).ToNot(HaveOccurred())
+		stdout = new(bytes.Buffer)
+		stderr = new(bytes.Buffer)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("should admit VMs satisfying the template rules", func() {
+		tmpl := writeFile("template.yaml", templateWithRules)
+		vm := writeFile("vm.yaml", newVMManifest("vm-big", "2Gi"))
+
+		code := validator.RunValidate([]string{"--rules", tmpl, vm}, stdout, stderr)
+		Expect(code).To(Equal(validator.ExitAdmitted), stderr.String())
+		Expect(stdout.String()).To(ContainSubstring("vm-big (%s): ADMITTED", vm))
+		Expect(stdout.String()).To(ContainSubstring("[SATISFIED] minimal-memory"))
+		Expect(stdout.String()).To(ContainSubstring("[SKIPPED] cpu-cores: not appliable"))
+	})
+
+	It("should reject VMs not satisfying the template rules", func() {
+		tmpl := writeFile("template.yaml", templateWithRules)
+		vms := writeFile("vms.yaml", newVMManifest("vm-big", "2Gi")+"---\n"+newVMManifest("vm-small", "512Mi"))
+
+		code := validator.RunValidate([]string{"--rules", tmpl, vms}, stdout, stderr)
+		Expect(code).To(Equal(validator.ExitRejected), stderr.String())
+		Expect(stdout.String()).To(ContainSubstring("vm-big (%s): ADMITTED", vms))
+		Expect(stdout.String()).To(ContainSubstring("vm-small (%s): REJECTED", vms))
+		Expect(stdout.String()).To(ContainSubstring("[FAILED] minimal-memory"))
+	})
+
+	It("should accept plain rules and emit JSON", func() {
+		rules := writeFile("rules.json", `[{
+			"name": "minimal-memory",
+			"path": "jsonpath::.spec.domain.resources.requests.memory",
+			"rule": "quantity",
+			"message": "memory must be at least 1Gi",
+			"min": "1Gi"
+		}]`)
+		vm := writeFile("vm.yaml", newVMManifest("vm-small", "512Mi"))
+
+		code := validator.RunValidate([]string{"-r", rules, "-o", "json", vm}, stdout, stderr)
+		Expect(code).To(Equal(validator.ExitRejected), stderr.String())
+
+		var reports []validator.ValidateReport
+		Expect(json.Unmarshal(stdout.Bytes(), &reports)).To(Succeed())
+		Expect(reports).To(HaveLen(1))
+		Expect(reports[0].VM).To(Equal("vm-small"))
+		Expect(reports[0].Admitted).To(BeFalse())
+		Expect(reports[0].Causes).To(HaveLen(1))
+		Expect(reports[0].Rules).To(HaveLen(1))
+		Expect(reports[0].Rules[0].Status).To(Equal("failed"))
+	})
+
+	It("should fail on malformed input", func() {
+		rules := writeFile("rules.json", `[{"name": "broken"`)
+		vm := writeFile("vm.yaml", newVMManifest("vm-small", "512Mi"))
+
+		code := validator.RunValidate([]string{"--rules", rules, vm}, stdout, stderr)
+		Expect(code).To(Equal(validator.ExitError))
+	})
+
+	It("should tell why the rules are skipped", func() {
+		rules := writeFile("rules.json", `[{
+			"name": "minimal-memory",
+			"path": "jsonpath::.spec.domain.resources.requests.memory",
+			"rule": "quantity",
+			"message": "memory must be at least 1Gi",
+			"min": "1Gi",
+			"onMissing": "skip"
+		}, {
+			"name": "memory-unchanged",
+			"path": "jsonpath::.spec.domain.resources.requests.memory",
+			"rule": "quantity",
+			"message": "memory can't change",
+			"min": "1Gi",
+			"operations": ["UPDATE"]
+		}]`)
+		vm := writeFile("vm.yaml", `apiVersion: kubevirt.io/v1alpha3
+kind: VirtualMachine
+metadata:
+  name: vm-nomem
+spec:
+  template:
+    spec:
+      domain:
+        devices: {}
+`)
+
+		code := validator.RunValidate([]string{"--rules", rules, vm}, stdout, stderr)
+		Expect(code).To(Equal(validator.ExitAdmitted), stderr.String())
+		Expect(stdout.String()).To(ContainSubstring("[SKIPPED] minimal-memory: no value set at .spec.domain.resources.requests.memory"))
+		Expect(stdout.String()).To(ContainSubstring("[SKIPPED] memory-unchanged: not for CREATE"))
+	})
+
+	It("should select the rules like the webhook", func() {
+		tmpl := writeFile("template.yaml", templateWithRules)
+		vms := writeFile("vms.yaml", `apiVersion: kubevirt.io/v1alpha3
+kind: VirtualMachine
+metadata:
+  name: vm-skipped
+  annotations:
+    vm.kubevirt.io/skip-validations: ""
+spec:
+  template:
+    spec:
+      domain:
+        devices: {}
+        resources:
+          requests:
+            memory: 512Mi
+---
+apiVersion: kubevirt.io/v1alpha3
+kind: VirtualMachine
+metadata:
+  name: vm-own-rules
+  annotations:
+    vm.kubevirt.io/validations: |
+      [{"name": "tiny-memory", "path": "jsonpath::.spec.domain.resources.requests.memory", "rule": "quantity", "message": "memory must be at most 256Mi", "max": "256Mi"}]
+spec:
+  template:
+    spec:
+      domain:
+        devices: {}
+        resources:
+          requests:
+            memory: 512Mi
+`)
+
+		code := validator.RunValidate([]string{"--rules", tmpl, vms}, stdout, stderr)
+		Expect(code).To(Equal(validator.ExitRejected), stderr.String())
+		Expect(stdout.String()).To(ContainSubstring("vm-skipped (%s): ADMITTED", vms))
+		Expect(stdout.String()).To(ContainSubstring("vm-own-rules (%s): REJECTED", vms))
+		Expect(stdout.String()).To(ContainSubstring("[FAILED] tiny-memory"))
+		Expect(stdout.String()).ToNot(ContainSubstring("minimal-memory"))
+	})
+
+	It("should fail on VMs without a template", func() {
+		tmpl := writeFile("template.yaml", templateWithRules)
+		vm := writeFile("vm.yaml", `apiVersion: kubevirt.io/v1alpha3
+kind: VirtualMachine
+metadata:
+  name: vm-empty
+spec:
+  running: false
+`)
+
+		code := validator.RunValidate([]string{"--rules", tmpl, vm}, stdout, stderr)
+		Expect(code).To(Equal(validator.ExitError))
+		Expect(stderr.String()).To(ContainSubstring("VirtualMachine vm-empty has no spec.template"))
+	})
+
+	It("should fail without VMs", func() {
+		tmpl := writeFile("template.yaml", templateWithRules)
+
+		code := validator.RunValidate([]string{"--rules", tmpl}, stdout, stderr)
+		Expect(code).To(Equal(validator.ExitError))
+	})
+})
@@ -0,0 +1,215 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2019 Red Hat, Inc.
+ */
+
+package validation
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	k6tv1 "kubevirt.io/client-go/api/v1"
+)
+
+// aggregate rules compute a function over all the values found at their path,
+// and check the result against their min/max bounds, e.g. to limit the number of disks:
+//   {"rule": "aggregate", "function": "count", "path": "jsonpath::.spec.domain.devices.disks[*]", "max": 4}
+// Like for the presence rules, the values are never taken from the reference VM:
+// a missing path has no values, so its count and sum are zero.
+
+const (
+	ruleAggregate string = "aggregate"
+
+	AggregateCount    string = "count"
+	AggregateSum      string = "sum"
+	AggregateMin      string = "min"
+	AggregateMax      string = "max"
+	AggregateDistinct string = "distinct"
+)
+
+func isValidAggregate(f string) bool {
+	switch f {
+	case AggregateCount, AggregateSum, AggregateMin, AggregateMax, AggregateDistinct:
+		return true
+	}
+	return false
+}
+
+type aggregateRule struct {
+	Ref          *Rule
+	Value        QuantityRange
+	Current      []string // the values the result was computed from
+	Result       resource.Quantity
+	Empty        bool // min and max of no values are undefined
+	Satisfied    bool
+	Explanations []string
+}
+
+func NewAggregateRule(r *Rule, vm, ref *k6tv1.VirtualMachine) (RuleApplier, error) {
+	if !isValidAggregate(r.Function) {
+		return nil, fmt.Errorf("unsupported aggregate function %q", r.Function)
+	}
+	ar := aggregateRule{Ref: r}
+	err := ar.Value.Decode(r.param(r.Min), r.param(r.Max), vm, ref)
+	if err != nil {
+		return nil, err
+	}
+	return &ar, nil
+}
+
+func (ar *aggregateRule) Apply(vm, ref *k6tv1.VirtualMachine) (bool, error) {
+	values, err := findPresentValues(ar.Ref.Path, vm, ref)
+	if err != nil {
+		return false, err
+	}
+
+	ar.Current = make([]string, 0, len(values))
+	for i, obj := range values {
+		ar.Current = append(ar.Current, describeValue(ar.Ref.Path, i, obj))
+	}
+	ar.Explanations = explainExpressions(vm, ref, ar.Ref.param(ar.Ref.Min), ar.Ref.param(ar.Ref.Max))
+
+	switch ar.Ref.Function {
+	case AggregateCount:
+		ar.Result = *resource.NewQuantity(int64(len(values)), resource.DecimalSI)
+	case AggregateDistinct:
+		distinct := make(map[string]bool)
+		for _, obj := range values {
+			distinct[valueAsString(obj)] = true
+		}
+		ar.Result = *resource.NewQuantity(int64(len(distinct)), resource.DecimalSI)
+	default:
+		quantities := make([]resource.Quantity, 0, len(values))
+		for _, obj := range values {
+			q, ok := toQuantity(obj)
+			if _, isString := obj.(string); isString || !ok {
+				return false, fmt.Errorf("mismatching type: %T, not int or resource.Quantity", obj)
+			}
+			quantities = append(quantities, q)
+		}
+		ar.Result, ar.Empty = aggregateQuantities(ar.Ref.Function, quantities)
+	}
+
+	ar.Satisfied = ar.Empty || ar.Value.Includes(ar.Result)
+	return ar.Satisfied, nil
+}
+
+func aggregateQuantities(function string, quantities []resource.Quantity) (resource.Quantity, bool) {
+	if function == AggregateSum {
+		sum := resource.Quantity{}
+		for i, q := range quantities {
+			if i == 0 {
+				sum = q.DeepCopy()
+			} else {
+				sum.Add(q)
+			}
+		}
+		return sum, false
+	}
+	if len(quantities) == 0 {
+		return resource.Quantity{}, true
+	}
+	ret := quantities[0]
+	for _, q := range quantities[1:] {
+		if (function == AggregateMin && q.Cmp(ret) < 0) || (function == AggregateMax && q.Cmp(ret) > 0) {
+			ret = q
+		}
+	}
+	return ret, false
+}
+
+func (ar *aggregateRule) String() string {
+	lowerBound := "N/A"
+	if ar.Value.MinSet {
+		lowerBound = ar.Value.Min.String()
+	}
+	upperBound := "N/A"
+	if ar.Value.MaxSet {
+		upperBound = ar.Value.Max.String()
+	}
+
+	values := strings.Join(ar.Current, ", ")
+	if ar.Empty {
+		return fmt.Sprintf("%s of [] is undefined, nothing to check", ar.Ref.Function)
+	}
+	outcome := "is in"
+	if !ar.Satisfied {
+		outcome = "is not in"
+	}
+	message := fmt.Sprintf("%s of [%s] = %s %s interval [%s, %s]", ar.Ref.Function, values, ar.Result.String(), outcome, lowerBound, upperBound)
+	return withExplanations(message, ar.Explanations)
+}
+
+// describeValue returns a short representation of the i-th value found at jsonPath:
+// objects are described by their name, if they have one, or else by their index, e.g. "disks[0]".
+func describeValue(jsonPath string, i int, obj interface{}) string {
+	val := reflect.ValueOf(obj)
+	switch val.Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array:
+		if _, ok := toQuantity(obj); !ok {
+			if val.Kind() == reflect.Struct {
+				if name := val.FieldByName("Name"); name.Kind() == reflect.String && name.String() != "" {
+					return name.String()
+				}
+			}
+			return describeIndex(jsonPath, i)
+		}
+	}
+	return valueAsString(obj)
+}
+
+// describeIndex names the i-th value found at jsonPath after the list it was taken from.
+// Across many lists (e.g. ".a[*].b[*]") the index is just the position among all the values.
+func describeIndex(jsonPath string, i int) string {
+	expr := TrimJSONPath(jsonPath)
+	if strings.Count(expr, "[*]") == 1 && strings.HasSuffix(expr, "[*]") {
+		list := strings.TrimSuffix(expr, "[*]")
+		list = list[strings.LastIndex(list, ".")+1:]
+		return fmt.Sprintf("%s[%d]", list, i)
+	}
+	return fmt.Sprintf("#%d", i)
+}
+
+// findPresentValues returns the values set at path, dereferencing pointers.
+// The reference VM is only used to tell bogus paths apart from missing values.
+func findPresentValues(jsonPath string, vm, ref *k6tv1.VirtualMachine) ([]interface{}, error) {
+	path, err := NewPath(jsonPath)
+	if err != nil {
+		return nil, err
+	}
+	err = path.Find(vm)
+	if err == ErrInvalidJSONPath {
+		// missing optional subpath or bogus path?
+		if refErr := checkMissingPath(jsonPath, ref); refErr != nil {
+			return nil, refErr
+		}
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ret []interface{}
+	for _, val := range path.presentValues() {
+		if obj, ok := indirect(val); ok {
+			ret = append(ret, obj)
+		}
+	}
+	return ret, nil
+}
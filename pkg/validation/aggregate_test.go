@@ -0,0 +1,158 @@
+package validation_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	k8sv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	k6tv1 "kubevirt.io/client-go/api/v1"
+
+	k6tobjs "github.com/kubevirt/kubevirt-template-validator/pkg/kubevirtobjs"
+	"github.com/kubevirt/kubevirt-template-validator/pkg/validation"
+)
+
+var _ = Describe("Aggregate", func() {
+	var (
+		vmCirros *k6tv1.VirtualMachine
+		vmRef    *k6tv1.VirtualMachine
+	)
+
+	BeforeEach(func() {
+		vmCirros = NewVMCirros()
+		vmRef = k6tobjs.NewDefaultVirtualMachine()
+		for i := range vmCirros.Spec.Template.Spec.Domain.Devices.Disks {
+			bootOrder := uint(i + 1)
+			vmCirros.Spec.Template.Spec.Domain.Devices.Disks[i].BootOrder = &bootOrder
+		}
+	})
+
+	newAggregate := func(function, path string, min, max interface{}) *validation.Rule {
+		return &validation.Rule{
+			Rule:     "aggregate",
+			Name:     "aggregate-" + function,
+			Path:     path,
+			Message:  "aggregate out of range",
+			Function: function,
+			Min:      min,
+			Max:      max,
+		}
+	}
+
+	It("Should count the values", func() {
+		r := newAggregate("count", "jsonpath::.spec.domain.devices.disks[*]", nil, 2)
+		expectRuleApplicationSuccess(r, vmCirros, vmRef)
+
+		r.Max = 1
+		expectRuleApplicationFailure(r, vmCirros, vmRef)
+	})
+
+	It("Should count missing values as zero", func() {
+		r := newAggregate("count", "jsonpath::.spec.domain.devices.interfaces[*]", nil, 0)
+		expectRuleApplicationSuccess(r, vmCirros, vmRef)
+
+		r.Min = 1
+		expectRuleApplicationFailure(r, vmCirros, vmRef)
+	})
+
+	It("Should fail with bogus paths", func() {
+		r := newAggregate("count", "jsonpath::.spec.domain.devices.floppies[*]", nil, 2)
+		ra, err := r.Specialize(vmCirros, vmRef)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = ra.Apply(vmCirros, vmRef)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should sum the values", func() {
+		r := newAggregate("sum", "jsonpath::.spec.domain.devices.disks[*].bootOrder", nil, 3)
+		expectRuleApplicationSuccess(r, vmCirros, vmRef)
+
+		r.Max = 2
+		expectRuleApplicationFailure(r, vmCirros, vmRef)
+	})
+
+	It("Should sum quantities", func() {
+		vmCirros.Spec.Template.Spec.Domain.Resources.Limits = k8sv1.ResourceList{
+			k8sv1.ResourceMemory: resource.MustParse("1Gi"),
+		}
+		r := newAggregate("sum", "jsonpath::.spec.domain.resources.*.memory", nil, "1152M")
+		expectRuleApplicationFailure(r, vmCirros, vmRef)
+
+		r.Max = "2Gi"
+		expectRuleApplicationSuccess(r, vmCirros, vmRef)
+	})
+
+	It("Should compute the minimum and the maximum", func() {
+		r := newAggregate("min", "jsonpath::.spec.domain.devices.disks[*].bootOrder", 1, nil)
+		expectRuleApplicationSuccess(r, vmCirros, vmRef)
+
+		r = newAggregate("max", "jsonpath::.spec.domain.devices.disks[*].bootOrder", nil, 1)
+		expectRuleApplicationFailure(r, vmCirros, vmRef)
+	})
+
+	It("Should not check the minimum of no values", func() {
+		r := newAggregate("min", "jsonpath::.spec.domain.devices.disks[*].cdrom.bus", 1, nil)
+		expectRuleApplicationSuccess(r, vmCirros, vmRef)
+	})
+
+	It("Should count the distinct values", func() {
+		r := newAggregate("distinct", "jsonpath::.spec.domain.devices.disks[*].disk.bus", nil, 1)
+		expectRuleApplicationSuccess(r, vmCirros, vmRef)
+
+		vmCirros.Spec.Template.Spec.Domain.Devices.Disks[1].Disk.Bus = "sata"
+		expectRuleApplicationFailure(r, vmCirros, vmRef)
+	})
+
+	It("Should reject sums of strings", func() {
+		r := newAggregate("sum", "jsonpath::.spec.domain.devices.disks[*].name", nil, 1)
+		ra, err := r.Specialize(vmCirros, vmRef)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = ra.Apply(vmCirros, vmRef)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should reject unknown functions", func() {
+		r := newAggregate("avg", "jsonpath::.spec.domain.devices.disks[*].bootOrder", nil, 1)
+		_, err := r.Specialize(vmCirros, vmRef)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should explain the result", func() {
+		r := newAggregate("sum", "jsonpath::.spec.domain.devices.disks[*].bootOrder", nil, 2)
+		ra, err := r.Specialize(vmCirros, vmRef)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = ra.Apply(vmCirros, vmRef)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ra.String()).To(Equal("sum of [1, 2] = 3 is not in interval [N/A, 2]"))
+
+		r = newAggregate("count", "jsonpath::.spec.domain.devices.disks[*]", nil, 2)
+		ra, err = r.Specialize(vmCirros, vmRef)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = ra.Apply(vmCirros, vmRef)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ra.String()).To(Equal("count of [containerdisk, cloudinitdisk] = 2 is in interval [N/A, 2]"))
+
+		r = newAggregate("count", "jsonpath::.spec.domain.devices.disks[*].disk", nil, 2)
+		ra, err = r.Specialize(vmCirros, vmRef)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = ra.Apply(vmCirros, vmRef)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ra.String()).To(Equal("count of [#0, #1] = 2 is in interval [N/A, 2]"))
+
+		r = newAggregate("count", "jsonpath::.spec.domain.devices.interfaces[*]", nil, 2)
+		vmCirros.Spec.Template.Spec.Domain.Devices.Interfaces = []k6tv1.Interface{{}, {}}
+		ra, err = r.Specialize(vmCirros, vmRef)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = ra.Apply(vmCirros, vmRef)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ra.String()).To(Equal("count of [interfaces[0], interfaces[1]] = 2 is in interval [N/A, 2]"))
+	})
+
+	It("Should lint the aggregate rules", func() {
+		r := newAggregate("", "jsonpath::.spec.domain.devices.disks[*]", nil, nil)
+		issues := validation.LintRules([]validation.Rule{*r})
+		Expect(issues).To(HaveLen(2))
+		Expect(issues[0].Key).To(Equal("function"))
+		Expect(issues[1].Key).To(Equal("min/max"))
+	})
+})
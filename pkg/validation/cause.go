@@ -0,0 +1,249 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2019 Red Hat, Inc.
+ */
+
+package validation
+
+import (
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	k6tv1 "kubevirt.io/client-go/api/v1"
+)
+
+// The reason codes of the causes. They are stable, so the clients can rely on them,
+// and they match the Kubernetes field error types whenever possible.
+const (
+	ReasonValueInvalid      string = string(metav1.CauseTypeFieldValueInvalid)
+	ReasonValueNotSupported string = string(metav1.CauseTypeFieldValueNotSupported)
+	ReasonValueRequired     string = string(metav1.CauseTypeFieldValueRequired)
+	ReasonValueForbidden    string = "FieldValueForbidden"
+	ReasonValueDuplicate    string = string(metav1.CauseTypeFieldValueDuplicate)
+	ReasonValueNotFound     string = string(metav1.CauseTypeFieldValueNotFound)
+	// the rule itself is at fault, e.g. it is malformed or its path is bogus
+	ReasonRuleError string = "RuleError"
+)
+
+// Cause is a reason why the VM is rejected.
+type Cause struct {
+	Reason  string // the reason code, see the Reason constants
+	Field   string // the field at fault, from the root of the VM, e.g. spec.template.spec.domain.devices.disks[2].disk.bus
+	Message string
+	Rule    string // the name of the rule
+	Source  string // where the rule comes from, if known, e.g. the template
+}
+
+// ToStatusCause turns the cause into a StatusCause. The name and the source of the rule
+// are added to the message, because StatusCauses have no room for them.
+func (c Cause) ToStatusCause() metav1.StatusCause {
+	message := c.Message
+	switch {
+	case c.Rule != "" && c.Source != "":
+		message = fmt.Sprintf("%s [rule: %s, source: %s]", message, c.Rule, c.Source)
+	case c.Rule != "":
+		message = fmt.Sprintf("%s [rule: %s]", message, c.Rule)
+	}
+	return metav1.StatusCause{
+		Type:    metav1.CauseType(c.Reason),
+		Field:   c.Field,
+		Message: message,
+	}
+}
+
+// missingReporter is implemented by the RuleAppliers which handle the missing values.
+type missingReporter interface {
+	missingState() missingValue
+}
+
+func (ir *intRule) missingState() missingValue      { return ir.Missing }
+func (qr *quantityRule) missingState() missingValue { return qr.Missing }
+func (sr *stringRule) missingState() missingValue   { return sr.Missing }
+func (er *enumRule) missingState() missingValue     { return er.Missing }
+func (rr *regexRule) missingState() missingValue    { return rr.Missing }
+func (br *boolRule) missingState() missingValue     { return br.Missing }
+
+// ruleReason returns the reason code for the failure of the rule.
+func ruleReason(r *Rule, ra RuleApplier) string {
+	if mr, ok := ra.(missingReporter); ok && mr.missingState().fails() {
+		return ReasonValueRequired
+	}
+	switch r.Rule {
+	case "enum":
+		return ReasonValueNotSupported
+	case "required":
+		return ReasonValueRequired
+	case "forbidden":
+		return ReasonValueForbidden
+	case ruleUnique:
+		return ReasonValueDuplicate
+	case ruleReferences:
+		return ReasonValueNotFound
+	}
+	return ReasonValueInvalid
+}
+
+func reportReason(rr *Report) string {
+	if rr.Error != nil {
+		return ReasonRuleError
+	}
+	if rr.Reason != "" {
+		return rr.Reason
+	}
+	return ReasonValueInvalid
+}
+
+// fieldPath turns a path as returned by TrimJSONPath (e.g. ".spec.domain.cpu.cores")
+// into a field path from the root of the VM (e.g. "spec.template.spec.domain.cpu.cores").
+func fieldPath(path string) string {
+	if strings.HasPrefix(path, ".") {
+		return "spec.template" + path
+	}
+	root, ok := findPathRoot(path)
+	if !ok {
+		// e.g. an expression: there is no single field to blame
+		return ""
+	}
+	_, expr := splitPath(path)
+	return strings.TrimPrefix(root.base+expr, ".")
+}
+
+// the rules which check each value found at their path on its own
+var valueRules = []string{"integer", "quantity", "string", "regex", "enum", "bool", ruleFormat}
+
+// failingValue is a value at fault, among all the values found at the path of a rule.
+type failingValue struct {
+	Index   int // the position among the values found at the path
+	Message string
+}
+
+// failingValuesReporter is implemented by the RuleAppliers which judge the values found
+// at their path as a whole (e.g. unique rules), but can still tell which ones are at fault.
+type failingValuesReporter interface {
+	failingValues() []failingValue
+}
+
+// valueViolations tells exactly which values are at fault. The value rules are applied again
+// to each value found at their path, one at a time; the other rules tell the failing values
+// themselves, see failingValuesReporter. Only the paths with [*] wildcards are expanded.
+func valueViolations(r *Rule, ra RuleApplier, vm, oldVM, ref *k6tv1.VirtualMachine) []Violation {
+	if !strings.Contains(r.Path, "[*]") {
+		return nil
+	}
+	if fr, ok := ra.(failingValuesReporter); ok {
+		return indexedViolations(r.Path, fr.failingValues(), vm, ref)
+	}
+	if !containsString(valueRules, r.Rule) {
+		return nil
+	}
+	if q, err := r.getQuantifier(); err != nil || !q.isAll() {
+		// the other quantifiers are about the values as a whole
+		return nil
+	}
+	paths, err := expandPath(r.Path, vm, ref)
+	if err != nil {
+		return nil
+	}
+
+	var violations []Violation
+	for _, path := range paths {
+		if values, err := findPresentValues(path, vm, ref); err != nil || len(values) == 0 {
+			continue
+		}
+		single := *r
+		single.Path = path
+		ra, err := single.specialize(vm, oldVM, ref, nil)
+		if err != nil {
+			continue
+		}
+		if ok, err := ra.Apply(vm, ref); ok || err != nil {
+			continue
+		}
+		violations = append(violations, Violation{
+			Field:       TrimJSONPath(path),
+			Message:     ra.String(),
+			Description: single.renderMessage(ra),
+		})
+	}
+	return violations
+}
+
+// indexedViolations finds the fields of the failing values, walking the expanded path
+// like the JSONPath lookup does, so the positions of the values match.
+func indexedViolations(path string, failing []failingValue, vm, ref *k6tv1.VirtualMachine) []Violation {
+	if len(failing) == 0 {
+		return nil
+	}
+	paths, err := expandPath(path, vm, ref)
+	if err != nil {
+		return nil
+	}
+
+	var violations []Violation
+	next, pos := 0, 0
+	for _, p := range paths {
+		values, err := findPresentValues(p, vm, ref)
+		if err != nil {
+			return nil
+		}
+		for range values {
+			if next < len(failing) && failing[next].Index == pos {
+				violations = append(violations, Violation{
+					Field:   TrimJSONPath(p),
+					Message: failing[next].Message,
+				})
+				next++
+			}
+			pos++
+		}
+	}
+	if next != len(failing) {
+		// the values didn't match, better to report the path as a whole
+		return nil
+	}
+	return violations
+}
+
+// expandPath replaces the [*] wildcards of the path with the indexes of the list elements,
+// e.g. ".spec.domain.devices.disks[*].disk.bus" becomes ".spec.domain.devices.disks[0].disk.bus"...
+// The paths with other wildcards, filters or slices can't be expanded.
+func expandPath(path string, vm, ref *k6tv1.VirtualMachine) ([]string, error) {
+	root, expr := splitPath(path)
+	if strings.Count(expr, "*") != strings.Count(expr, "[*]") ||
+		strings.Contains(expr, "..") || strings.ContainsAny(expr, "?:,") {
+		return nil, fmt.Errorf("cannot expand %s", expr)
+	}
+	pos := strings.Index(expr, "[*]")
+	if pos == -1 {
+		return []string{path}, nil
+	}
+	list, rest := expr[:pos], expr[pos+len("[*]"):]
+	count, err := countElements(root.prefix+list, vm, ref)
+	if err != nil {
+		return nil, err
+	}
+	var ret []string
+	for i := 0; i < count; i++ {
+		paths, err := expandPath(fmt.Sprintf("%s%s[%d]%s", root.prefix, list, i, rest), vm, ref)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, paths...)
+	}
+	return ret, nil
+}
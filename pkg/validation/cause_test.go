@@ -0,0 +1,144 @@
+package validation_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k6tv1 "kubevirt.io/client-go/api/v1"
+
+	"github.com/kubevirt/kubevirt-template-validator/pkg/validation"
+)
+
+var _ = Describe("Causes", func() {
+	var vmCirros *k6tv1.VirtualMachine
+
+	BeforeEach(func() {
+		vmCirros = NewVMCirros()
+	})
+
+	newBusRule := func() validation.Rule {
+		return validation.Rule{
+			Name:    "disk-bus",
+			Rule:    "enum",
+			Path:    "jsonpath::.spec.domain.devices.disks[*].disk.bus",
+			Message: "disks must use sata",
+			Values:  []string{"sata"},
+		}
+	}
+
+	It("Should report each value at fault", func() {
+		vmCirros.Spec.Template.Spec.Domain.Devices.Disks[0].Disk.Bus = "sata"
+		res := validation.NewEvaluator().Evaluate([]validation.Rule{newBusRule()}, vmCirros)
+
+		causes := res.Causes()
+		Expect(causes).To(HaveLen(1))
+		Expect(causes[0].Field).To(Equal("spec.template.spec.domain.devices.disks[1].disk.bus"))
+		Expect(causes[0].Message).To(Equal("disks must use sata: Some of [virtio] are not in [sata]"))
+		Expect(causes[0].Reason).To(Equal(validation.ReasonValueNotSupported))
+		Expect(causes[0].Rule).To(Equal("disk-bus"))
+	})
+
+	It("Should expand the nested lists", func() {
+		vmCirros.Spec.Template.Spec.Domain.Devices.Interfaces = []k6tv1.Interface{
+			{Name: "default", Ports: []k6tv1.Port{{Port: 80}, {Port: 8080}}},
+			{Name: "secondary", Ports: []k6tv1.Port{{Port: 22}, {Port: 70000}}},
+		}
+		res := validation.NewEvaluator().Evaluate([]validation.Rule{{
+			Name:    "ports",
+			Rule:    "integer",
+			Path:    "jsonpath::.spec.domain.devices.interfaces[*].ports[*].port",
+			Message: "invalid port",
+			Min:     1,
+			Max:     65535,
+		}}, vmCirros)
+
+		causes := res.Causes()
+		Expect(causes).To(HaveLen(1))
+		Expect(causes[0].Field).To(Equal("spec.template.spec.domain.devices.interfaces[1].ports[1].port"))
+		Expect(causes[0].Reason).To(Equal(validation.ReasonValueInvalid))
+	})
+
+	It("Should report each duplicate value", func() {
+		disks := vmCirros.Spec.Template.Spec.Domain.Devices.Disks
+		vmCirros.Spec.Template.Spec.Domain.Devices.Disks = append(disks, disks[0], disks[1], disks[0])
+		res := validation.NewEvaluator().Evaluate([]validation.Rule{{
+			Name:    "disk-names",
+			Rule:    "unique",
+			Path:    "jsonpath::.spec.domain.devices.disks[*].name",
+			Message: "disk names must be unique",
+		}}, vmCirros)
+
+		causes := res.Causes()
+		Expect(causes).To(HaveLen(3))
+		Expect(causes[0].Field).To(Equal("spec.template.spec.domain.devices.disks[2].name"))
+		Expect(causes[0].Message).To(Equal(`disk names must be unique: Duplicate value "containerdisk"`))
+		Expect(causes[0].Reason).To(Equal(validation.ReasonValueDuplicate))
+		Expect(causes[1].Field).To(Equal("spec.template.spec.domain.devices.disks[3].name"))
+		Expect(causes[2].Field).To(Equal("spec.template.spec.domain.devices.disks[4].name"))
+	})
+
+	It("Should report each dangling reference", func() {
+		vmCirros.Spec.Template.Spec.Domain.Devices.Disks[1].Name = "seed"
+		res := validation.NewEvaluator().Evaluate([]validation.Rule{{
+			Name:    "disk-volumes",
+			Rule:    "references",
+			Path:    "jsonpath::.spec.domain.devices.disks[*].name",
+			Target:  "jsonpath::.spec.volumes[*].name",
+			Message: "disks need a volume",
+		}}, vmCirros)
+
+		causes := res.Causes()
+		Expect(causes).To(HaveLen(1))
+		Expect(causes[0].Field).To(Equal("spec.template.spec.domain.devices.disks[1].name"))
+		Expect(causes[0].Message).To(Equal(`disks need a volume: Value "seed" is not found in .spec.volumes[*].name [containerdisk, cloudinitdisk]`))
+		Expect(causes[0].Reason).To(Equal(validation.ReasonValueNotFound))
+	})
+
+	It("Should not report the expressions as fields", func() {
+		res := validation.NewEvaluator().Evaluate([]validation.Rule{{
+			Name:    "memory-per-disk",
+			Rule:    "integer",
+			Path:    "expr::{.spec.domain.resources.requests.memory} / 2",
+			Message: "not enough memory",
+			Min:     1073741824,
+		}}, vmCirros)
+
+		causes := res.Causes()
+		Expect(causes).To(HaveLen(1))
+		Expect(causes[0].Reason).To(Equal(validation.ReasonValueInvalid))
+		Expect(causes[0].Field).To(BeEmpty())
+	})
+
+	It("Should report the whole path with quantifiers", func() {
+		r := newBusRule()
+		r.Quantifier = "any"
+		res := validation.NewEvaluator().Evaluate([]validation.Rule{r}, vmCirros)
+
+		causes := res.Causes()
+		Expect(causes).To(HaveLen(1))
+		Expect(causes[0].Field).To(Equal("spec.template.spec.domain.devices.disks[*].disk.bus"))
+	})
+
+	It("Should tell the rule errors apart", func() {
+		r := newBusRule()
+		r.Path = "jsonpath::.spec.domain.devices.floppies[*].bus"
+		res := validation.NewEvaluator().Evaluate([]validation.Rule{r}, vmCirros)
+
+		causes := res.Causes()
+		Expect(causes).To(HaveLen(1))
+		Expect(causes[0].Reason).To(Equal(validation.ReasonRuleError))
+	})
+
+	It("Should tell the rule and its source", func() {
+		rs := validation.NewRuleSet([]validation.Rule{newBusRule()}).WithSource("template default/cirros")
+		ev := validation.NewEvaluator()
+		res := ev.EvaluateRuleSet(rs, vmCirros, nil)
+
+		causes := res.ToStatusCauses()
+		Expect(causes).To(HaveLen(2))
+		Expect(causes[0].Type).To(Equal(metav1.CauseTypeFieldValueNotSupported))
+		Expect(causes[0].Field).To(Equal("spec.template.spec.domain.devices.disks[0].disk.bus"))
+		Expect(causes[0].Message).To(HaveSuffix(" [rule: disk-bus, source: template default/cirros]"))
+	})
+})
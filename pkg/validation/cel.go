@@ -0,0 +1,306 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2019 Red Hat, Inc.
+ */
+
+package validation
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+
+	k6tv1 "kubevirt.io/client-go/api/v1"
+)
+
+// CEL rules evaluate a Common Expression Language expression, which must yield a boolean.
+// The expression can access the whole VirtualMachine object (not just spec.template!)
+// as the `vm` variable, using the JSON field names, e.g.
+//   vm.spec.template.spec.domain.cpu.cores <= 8
+// On updates, the previous version of the VirtualMachine is available as `oldVM`,
+// which is null otherwise.
+// The variables are typed after the OpenAPI schema of the KubeVirt types, so the expressions
+// are type checked when they are compiled, and the integer fields compare with integers.
+// An expression accessing a field which is not set evaluates to false: use has() to test them.
+
+const (
+	ruleCEL string = "cel"
+
+	celVarVM    string = "vm"
+	celVarOldVM string = "oldVM"
+
+	// the longest expression accepted, so a template can't make the admission arbitrarily costly
+	maxCELExpressionLength int = 1024
+
+	// the error reported by CEL when a map key or a field is not set
+	celNoSuchKey string = "no such key"
+)
+
+var (
+	celEnvOnce sync.Once
+	celEnv     *cel.Env
+	celEnvErr  error
+)
+
+func getCELEnv() (*cel.Env, error) {
+	celEnvOnce.Do(func() {
+		var registry ref.TypeRegistry
+		registry, celEnvErr = types.NewRegistry()
+		if celEnvErr != nil {
+			return
+		}
+		celEnv, celEnvErr = cel.NewEnv(
+			cel.CustomTypeProvider(&celTypeProvider{TypeProvider: registry}),
+			cel.Declarations(
+				decls.NewVar(celVarVM, decls.NewObjectType(schemaRootVM)),
+				decls.NewVar(celVarOldVM, decls.NewObjectType(schemaRootVM)),
+			),
+		)
+	})
+	return celEnv, celEnvErr
+}
+
+func compileCEL(expression string) (cel.Program, error) {
+	if len(expression) > maxCELExpressionLength {
+		return nil, fmt.Errorf("CEL expression too long: %d characters, at most %d", len(expression), maxCELExpressionLength)
+	}
+	env, err := getCELEnv()
+	if err != nil {
+		return nil, err
+	}
+	ast, iss := env.Compile(expression)
+	if iss.Err() != nil {
+		return nil, fmt.Errorf("malformed CEL expression: %v", iss.Err())
+	}
+	switch ast.ResultType().GetTypeKind().(type) {
+	case *exprpb.Type_Dyn:
+		// can't tell at compile time, will be checked when evaluated
+	case *exprpb.Type_Primitive:
+		if ast.ResultType().GetPrimitive() != exprpb.Type_BOOL {
+			return nil, fmt.Errorf("CEL expression must yield bool, not %s", cel.FormatType(ast.ResultType()))
+		}
+	default:
+		return nil, fmt.Errorf("CEL expression must yield bool, not %s", cel.FormatType(ast.ResultType()))
+	}
+	return env.Program(ast)
+}
+
+// celTypeProvider describes the KubeVirt types to CEL, after their OpenAPI schema.
+// The values are the VMs decoded from JSON, see toCELValue.
+type celTypeProvider struct {
+	ref.TypeProvider // for the CEL types
+}
+
+func (p *celTypeProvider) FindType(typeName string) (*exprpb.Type, bool) {
+	if _, ok := getOpenAPIDefinitions()[typeName]; ok {
+		return decls.NewTypeType(decls.NewObjectType(typeName)), true
+	}
+	return p.TypeProvider.FindType(typeName)
+}
+
+func (p *celTypeProvider) FindFieldType(messageType, fieldName string) (*ref.FieldType, bool) {
+	def, ok := getOpenAPIDefinitions()[messageType]
+	if !ok {
+		return p.TypeProvider.FindFieldType(messageType, fieldName)
+	}
+	prop, ok := def.Schema.Properties[fieldName]
+	if !ok {
+		return nil, false
+	}
+	fieldType := celSchemaType(resolveSchema(&prop))
+	return &ref.FieldType{
+		Type: fieldType,
+		IsSet: func(target interface{}) bool {
+			_, ok := celField(target, fieldName)
+			return ok
+		},
+		GetFrom: func(target interface{}) (interface{}, error) {
+			val, ok := celField(target, fieldName)
+			if !ok {
+				return nil, fmt.Errorf("%s: %s", celNoSuchKey, fieldName)
+			}
+			if i, ok := val.(int64); ok && fieldType.GetPrimitive() == exprpb.Type_DOUBLE {
+				// e.g. 2.0 is marshalled as 2
+				return float64(i), nil
+			}
+			return val, nil
+		},
+	}, true
+}
+
+func celField(target interface{}, fieldName string) (interface{}, bool) {
+	obj, ok := target.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	val, ok := obj[fieldName]
+	return val, ok && val != nil
+}
+
+// celSchemaType returns the CEL type of the values of the given schema.
+// The types which can't be told, like the quantities (either strings or numbers), are dynamic.
+func celSchemaType(sn schemaNode) *exprpb.Type {
+	switch {
+	case sn.schema == nil || sn.name == schemaQuantity || sn.name == schemaIntOrString:
+		return decls.Dyn
+	case sn.isType("integer"):
+		return decls.Int
+	case sn.isType("number"):
+		return decls.Double
+	case sn.isType("string"):
+		return decls.String
+	case sn.isType("boolean"):
+		return decls.Bool
+	case sn.isType("array"):
+		if sn.schema.Items == nil || sn.schema.Items.Schema == nil {
+			return decls.NewListType(decls.Dyn)
+		}
+		return decls.NewListType(celSchemaType(resolveSchema(sn.schema.Items.Schema)))
+	case sn.name != "" && len(sn.schema.Properties) > 0:
+		return decls.NewObjectType(sn.name)
+	case sn.schema.AdditionalProperties != nil && sn.schema.AdditionalProperties.Schema != nil:
+		return decls.NewMapType(decls.String, celSchemaType(resolveSchema(sn.schema.AdditionalProperties.Schema)))
+	}
+	return decls.Dyn
+}
+
+// celVars are the variables of the CEL expressions. The VMs are converted once per evaluation,
+// on the first use, rather than once per rule.
+type celVars struct {
+	vm, oldVM *k6tv1.VirtualMachine
+	vars      map[string]interface{}
+	err       error
+}
+
+func newCELVars(vm, oldVM *k6tv1.VirtualMachine) *celVars {
+	return &celVars{vm: vm, oldVM: oldVM}
+}
+
+func (cv *celVars) get() (map[string]interface{}, error) {
+	if cv.vars != nil || cv.err != nil {
+		return cv.vars, cv.err
+	}
+	vmObj, err := toCELValue(cv.vm)
+	if err != nil {
+		cv.err = err
+		return nil, err
+	}
+	oldVMObj, err := toCELValue(cv.oldVM)
+	if err != nil {
+		cv.err = err
+		return nil, err
+	}
+	cv.vars = map[string]interface{}{
+		celVarVM:    vmObj,
+		celVarOldVM: oldVMObj,
+	}
+	return cv.vars, nil
+}
+
+// toCELValue decodes the VM from its JSON representation, keeping the integers as such.
+func toCELValue(vm *k6tv1.VirtualMachine) (interface{}, error) {
+	if vm == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(vm)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var obj interface{}
+	if err := dec.Decode(&obj); err != nil {
+		return nil, err
+	}
+	return convertJSONNumbers(obj), nil
+}
+
+func convertJSONNumbers(obj interface{}) interface{} {
+	switch val := obj.(type) {
+	case map[string]interface{}:
+		for k, v := range val {
+			val[k] = convertJSONNumbers(v)
+		}
+	case []interface{}:
+		for i, v := range val {
+			val[i] = convertJSONNumbers(v)
+		}
+	case json.Number:
+		if i, err := val.Int64(); err == nil {
+			return i
+		}
+		f, _ := val.Float64()
+		return f
+	}
+	return obj
+}
+
+type celRule struct {
+	Ref       *Rule
+	Vars      *celVars
+	Missing   string // the error about the value not set, if any
+	Satisfied bool
+}
+
+func NewCELRule(r *Rule, vars *celVars) (RuleApplier, error) {
+	if r.compileErr != nil {
+		return nil, r.compileErr
+	}
+	return &celRule{Ref: r, Vars: vars}, nil
+}
+
+func (cr *celRule) Apply(vm, ref *k6tv1.VirtualMachine) (bool, error) {
+	vars, err := cr.Vars.get()
+	if err != nil {
+		return false, err
+	}
+
+	cr.Missing = ""
+	out, _, err := cr.Ref.celProgram.Eval(vars)
+	if err != nil && strings.HasPrefix(err.Error(), celNoSuchKey) {
+		cr.Missing = err.Error()
+		cr.Satisfied = false
+		return cr.Satisfied, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("cannot evaluate CEL expression: %v", err)
+	}
+	satisfied, ok := out.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("CEL expression yielded %v, not bool", out.Type().TypeName())
+	}
+
+	cr.Satisfied = satisfied
+	return cr.Satisfied, nil
+}
+
+func (cr *celRule) String() string {
+	if cr.Satisfied {
+		return fmt.Sprintf("Expression `%s` is true", cr.Ref.Expression)
+	} else if cr.Missing != "" {
+		return fmt.Sprintf("Expression `%s` is false, %s", cr.Ref.Expression, cr.Missing)
+	} else {
+		return fmt.Sprintf("Expression `%s` is false", cr.Ref.Expression)
+	}
+}
@@ -0,0 +1,195 @@
+package validation_test
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	k6tv1 "kubevirt.io/client-go/api/v1"
+
+	k6tobjs "github.com/kubevirt/kubevirt-template-validator/pkg/kubevirtobjs"
+	"github.com/kubevirt/kubevirt-template-validator/pkg/validation"
+)
+
+var _ = Describe("CEL", func() {
+	var (
+		vmCirros *k6tv1.VirtualMachine
+		vmRef    *k6tv1.VirtualMachine
+	)
+
+	BeforeEach(func() {
+		vmCirros = NewVMCirros()
+		vmRef = k6tobjs.NewDefaultVirtualMachine()
+	})
+
+	Context("With valid expressions", func() {
+		It("Should apply CEL rules", func() {
+			r := validation.Rule{
+				Rule:       "cel",
+				Name:       "q35-machine",
+				Message:    "machine type must be q35",
+				Expression: "vm.spec.template.spec.domain.machine.type == 'q35'",
+			}
+			expectRuleApplicationSuccess(&r, vmCirros, vmRef)
+		})
+
+		It("Should fail CEL rules", func() {
+			r := validation.Rule{
+				Rule:       "cel",
+				Name:       "all-disks-sata",
+				Message:    "all the disks must use sata",
+				Expression: "vm.spec.template.spec.domain.devices.disks.all(d, d.disk.bus == 'sata')",
+			}
+			expectRuleApplicationFailure(&r, vmCirros, vmRef)
+		})
+
+		It("Should error if the expression does not yield a bool", func() {
+			r := validation.Rule{
+				Rule:       "cel",
+				Name:       "memory",
+				Message:    "memory",
+				Expression: "vm.spec.template.spec.domain.resources.requests['memory']",
+			}
+			expectRuleApplicationError(&r, vmCirros, vmRef)
+		})
+
+		It("Should compare the integer fields with integers", func() {
+			r := validation.Rule{
+				Rule:       "cel",
+				Name:       "max-cores",
+				Message:    "too many cores",
+				Expression: "vm.spec.template.spec.domain.cpu.cores < 2",
+			}
+			vmCirros.Spec.Template.Spec.Domain.CPU = &k6tv1.CPU{Cores: 1}
+			expectRuleApplicationSuccess(&r, vmCirros, vmRef)
+
+			vmCirros.Spec.Template.Spec.Domain.CPU.Cores = 4
+			expectRuleApplicationFailure(&r, vmCirros, vmRef)
+		})
+
+		It("Should evaluate to false when accessing fields not set", func() {
+			r := validation.Rule{
+				Rule:       "cel",
+				Name:       "max-cores",
+				Message:    "too many cores",
+				Expression: "vm.spec.template.spec.domain.cpu.cores < 2",
+			}
+			Expect(vmCirros.Spec.Template.Spec.Domain.CPU).To(BeNil())
+			ra, err := r.Specialize(vmCirros, vmRef)
+			Expect(err).ToNot(HaveOccurred())
+			ok, err := ra.Apply(vmCirros, vmRef)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ok).To(BeFalse())
+			Expect(ra.String()).To(ContainSubstring("no such key: cpu"))
+		})
+
+		It("Should test the fields not set", func() {
+			r := validation.Rule{
+				Rule:       "cel",
+				Name:       "max-cores",
+				Message:    "too many cores",
+				Expression: "!has(vm.spec.template.spec.domain.cpu) || vm.spec.template.spec.domain.cpu.cores < 2",
+			}
+			expectRuleApplicationSuccess(&r, vmCirros, vmRef)
+		})
+
+		It("Should access the old VM on updates", func() {
+			rules := []validation.Rule{{
+				Rule:       "cel",
+				Name:       "immutable-machine-type",
+				Message:    "machine type cannot change",
+				Expression: "oldVM == null || oldVM.spec.template.spec.domain.machine.type == vm.spec.template.spec.domain.machine.type",
+			}}
+
+			ev := validation.Evaluator{Sink: GinkgoWriter}
+			res := ev.Evaluate(rules, vmCirros)
+			Expect(res.Succeeded()).To(BeTrue())
+
+			newVM := NewVMCirros()
+			newVM.Spec.Template.Spec.Domain.Machine.Type = "pc"
+			res = ev.EvaluateWithOldVM(rules, newVM, vmCirros)
+			Expect(res.Succeeded()).To(BeFalse())
+		})
+	})
+
+	Context("With invalid expressions", func() {
+		It("Should reject malformed expressions", func() {
+			r := validation.Rule{
+				Rule:       "cel",
+				Name:       "broken",
+				Message:    "broken",
+				Expression: "vm.spec.template.spec.domain.machine.type ==",
+			}
+			ra, err := r.Specialize(vmCirros, vmRef)
+			Expect(err).To(HaveOccurred())
+			Expect(ra).To(BeNil())
+		})
+
+		It("Should reject non-boolean expressions", func() {
+			r := validation.Rule{
+				Rule:       "cel",
+				Name:       "number",
+				Message:    "number",
+				Expression: "1 + 2",
+			}
+			ra, err := r.Specialize(vmCirros, vmRef)
+			Expect(err).To(HaveOccurred())
+			Expect(ra).To(BeNil())
+		})
+
+		It("Should reject the type errors", func() {
+			for _, expr := range []string{
+				"vm.spec.template.spec.domain.machine.type",
+				"vm.spec.template.spec.domain.cpu.cores < '2'",
+				"vm.spec.template.spec.domain.cpu.cores < 2.5",
+				"vm.spec.template.spec.domain.cpu.corez < 2",
+			} {
+				r := validation.Rule{
+					Rule:       "cel",
+					Name:       "typed",
+					Message:    "typed",
+					Expression: expr,
+				}
+				_, err := r.Specialize(vmCirros, vmRef)
+				Expect(err).To(HaveOccurred(), expr)
+			}
+		})
+
+		It("Should reject the expressions too long", func() {
+			r := validation.Rule{
+				Rule:       "cel",
+				Name:       "long",
+				Message:    "long",
+				Expression: "true" + strings.Repeat(" && true", 200),
+			}
+			_, err := r.Specialize(vmCirros, vmRef)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("Should report compile errors like malformed rules", func() {
+			text := `[{
+            "name": "broken",
+            "rule": "cel",
+            "message": "broken expression",
+            "expression": "vm.spec.template.spec.domain.machine.type == "
+          }, {
+            "name": "q35-machine",
+            "rule": "cel",
+            "message": "machine type must be q35",
+            "expression": "vm.spec.template.spec.domain.machine.type == 'q35'"
+          }]`
+			rules, err := validation.ParseRules([]byte(text))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(rules)).To(Equal(2))
+
+			ev := validation.Evaluator{Sink: GinkgoWriter}
+			res := ev.Evaluate(rules, vmCirros)
+			Expect(res.Succeeded()).To(BeFalse())
+			Expect(len(res.Status)).To(Equal(2))
+			Expect(res.Status[0].Error).To(HaveOccurred())
+			Expect(res.Status[1].Error).ToNot(HaveOccurred())
+			Expect(res.Status[1].Satisfied).To(BeTrue())
+		})
+	})
+})
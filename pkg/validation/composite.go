@@ -0,0 +1,189 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2019 Red Hat, Inc.
+ */
+
+package validation
+
+import (
+	"fmt"
+	"strings"
+
+	k6tv1 "kubevirt.io/client-go/api/v1"
+)
+
+// composite rules combine the results of their nested rules.
+// The nested rules are evaluated exactly like the top-level rules,
+// so they can be composite rules themselves.
+// Only the nested rules which apply, and are errors, count: the skipped rules do not apply,
+// and the warnings (and infos) never fail their parent, they are just reported.
+// So, when no nested rule counts, every composite rule is satisfied.
+// The branches of anyOf and oneOf rules are alternatives: once a branch satisfies the rule,
+// the warnings of the nested rules are dropped, since the VM took another way.
+const (
+	ruleAllOf string = "allOf"
+	ruleAnyOf string = "anyOf"
+	ruleOneOf string = "oneOf"
+	ruleNot   string = "not"
+)
+
+func isCompositeRule(r string) bool {
+	return r == ruleAllOf || r == ruleAnyOf || r == ruleOneOf || r == ruleNot
+}
+
+// nestedReporter is implemented by the RuleAppliers which evaluate nested rules,
+// to let the Evaluator roll up the nested Reports into the parent Report.
+type nestedReporter interface {
+	NestedReports() []Report
+	NestedWarnings() []string
+}
+
+type compositeRule struct {
+	Ref       *Rule
+	OldVM     *k6tv1.VirtualMachine
+	Vars      *celVars
+	Reports   []Report
+	Warnings  []string
+	Satisfied bool
+}
+
+func NewCompositeRule(r *Rule, oldVM *k6tv1.VirtualMachine, vars *celVars) (RuleApplier, error) {
+	if len(r.Rules) == 0 {
+		return nil, fmt.Errorf("%s rule without nested rules", r.Rule)
+	}
+	if r.Rule == ruleNot && len(r.Rules) != 1 {
+		return nil, fmt.Errorf("%s rule expects exactly one nested rule, found %d", r.Rule, len(r.Rules))
+	}
+	return &compositeRule{Ref: r, OldVM: oldVM, Vars: vars}, nil
+}
+
+func (cr *compositeRule) Apply(vm, ref *k6tv1.VirtualMachine) (bool, error) {
+	res := NewEvaluator().evaluate(cr.Ref.Rules, vm, cr.OldVM, ref, cr.Vars)
+	for _, rr := range res.Status {
+		if rr.Error != nil {
+			return false, fmt.Errorf("nested rule %s: %v", rr.Ref.Name, rr.Error)
+		}
+	}
+	cr.Reports = res.Status
+	cr.Warnings = res.Warnings
+
+	satisfiedCount := len(cr.satisfiedBranches())
+	applies := cr.countingBranches() > 0
+	switch cr.Ref.Rule {
+	case ruleAllOf:
+		cr.Satisfied = len(cr.failedBranches()) == 0
+	case ruleAnyOf:
+		cr.Satisfied = !applies || satisfiedCount > 0
+	case ruleOneOf:
+		cr.Satisfied = !applies || satisfiedCount == 1
+	case ruleNot:
+		cr.Satisfied = satisfiedCount == 0
+	}
+	if (cr.Ref.Rule == ruleAnyOf || cr.Ref.Rule == ruleOneOf) && cr.Satisfied && satisfiedCount > 0 {
+		cr.Warnings = nil
+	}
+	return cr.Satisfied, nil
+}
+
+func (cr *compositeRule) NestedReports() []Report {
+	return cr.Reports
+}
+
+func (cr *compositeRule) NestedWarnings() []string {
+	return cr.Warnings
+}
+
+// counts tells if the nested rule counts for the parent: it applied, and it is an error.
+func counts(rr *Report) bool {
+	return !rr.Skipped && rr.Ref.GetSeverity() == SeverityError
+}
+
+func (cr *compositeRule) countingBranches() int {
+	count := 0
+	for i := range cr.Reports {
+		if counts(&cr.Reports[i]) {
+			count++
+		}
+	}
+	return count
+}
+
+func (cr *compositeRule) satisfiedBranches() []string {
+	var names []string
+	for _, rr := range cr.Reports {
+		if counts(&rr) && rr.Satisfied {
+			names = append(names, rr.Ref.Name)
+		}
+	}
+	return names
+}
+
+// failedBranches returns the explanation of each nested rule which counts, and is not satisfied.
+func (cr *compositeRule) failedBranches() []string {
+	var explanations []string
+	for _, rr := range cr.Reports {
+		if counts(&rr) && !rr.Satisfied {
+			explanations = append(explanations, fmt.Sprintf("%s (%s)", rr.Ref.Name, rr.Message))
+		}
+	}
+	return explanations
+}
+
+func (cr *compositeRule) branchNames() string {
+	names := make([]string, 0, len(cr.Ref.Rules))
+	for i := range cr.Ref.Rules {
+		names = append(names, cr.Ref.Rules[i].Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+func (cr *compositeRule) String() string {
+	satisfied := strings.Join(cr.satisfiedBranches(), ", ")
+	failed := strings.Join(cr.failedBranches(), "; ")
+
+	if cr.countingBranches() == 0 {
+		if cr.Ref.Rule == ruleNot {
+			return fmt.Sprintf("Rule %s does not apply as an error", cr.branchNames())
+		}
+		return fmt.Sprintf("None of [%s] applies as an error", cr.branchNames())
+	}
+	switch cr.Ref.Rule {
+	case ruleAllOf:
+		if cr.Satisfied {
+			return fmt.Sprintf("All of [%s] are satisfied", cr.branchNames())
+		}
+		return fmt.Sprintf("Some of [%s] are not satisfied: %s", cr.branchNames(), failed)
+	case ruleAnyOf:
+		if cr.Satisfied {
+			return fmt.Sprintf("Some of [%s] are satisfied: [%s]", cr.branchNames(), satisfied)
+		}
+		return fmt.Sprintf("None of [%s] is satisfied: %s", cr.branchNames(), failed)
+	case ruleOneOf:
+		if cr.Satisfied {
+			return fmt.Sprintf("Exactly one of [%s] is satisfied: [%s]", cr.branchNames(), satisfied)
+		}
+		if satisfied == "" {
+			return fmt.Sprintf("None of [%s] is satisfied: %s", cr.branchNames(), failed)
+		}
+		return fmt.Sprintf("More than one of [%s] is satisfied: [%s]", cr.branchNames(), satisfied)
+	case ruleNot:
+		if cr.Satisfied {
+			return fmt.Sprintf("Rule %s is not satisfied", cr.branchNames())
+		}
+		return fmt.Sprintf("Rule %s is satisfied, but it must not be", cr.branchNames())
+	}
+	return ""
+}
@@ -0,0 +1,287 @@
+package validation_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	k6tv1 "kubevirt.io/client-go/api/v1"
+
+	k6tobjs "github.com/kubevirt/kubevirt-template-validator/pkg/kubevirtobjs"
+	"github.com/kubevirt/kubevirt-template-validator/pkg/validation"
+)
+
+var _ = Describe("Composite", func() {
+	var (
+		vmCirros *k6tv1.VirtualMachine
+		vmRef    *k6tv1.VirtualMachine
+		virtio   validation.Rule
+		sata     validation.Rule
+		q35      validation.Rule
+	)
+
+	BeforeEach(func() {
+		vmCirros = NewVMCirros()
+		vmRef = k6tobjs.NewDefaultVirtualMachine()
+		virtio = validation.Rule{
+			Rule:    "enum",
+			Name:    "virtio-disks",
+			Path:    "jsonpath::.spec.domain.devices.disks[*].disk.bus",
+			Message: "disks must use virtio",
+			Values:  []string{"virtio"},
+		}
+		sata = validation.Rule{
+			Rule:    "enum",
+			Name:    "sata-disks",
+			Path:    "jsonpath::.spec.domain.devices.disks[*].disk.bus",
+			Message: "disks must use sata",
+			Values:  []string{"sata"},
+		}
+		q35 = validation.Rule{
+			Rule:    "enum",
+			Name:    "q35-machine",
+			Path:    "jsonpath::.spec.domain.machine.type",
+			Message: "machine type must be q35",
+			Values:  []string{"q35"},
+		}
+	})
+
+	Context("With valid rules", func() {
+		It("Should apply allOf rules", func() {
+			r := validation.Rule{
+				Rule:    "allOf",
+				Name:    "virtio-q35",
+				Message: "virtio disks on q35 required",
+				Rules:   []validation.Rule{virtio, q35},
+			}
+			expectRuleApplicationSuccess(&r, vmCirros, vmRef)
+
+			r.Rules = []validation.Rule{sata, q35}
+			expectRuleApplicationFailure(&r, vmCirros, vmRef)
+		})
+
+		It("Should apply anyOf rules", func() {
+			r := validation.Rule{
+				Rule:    "anyOf",
+				Name:    "supported-bus",
+				Message: "disks must use a supported bus",
+				Rules:   []validation.Rule{sata, virtio},
+			}
+			expectRuleApplicationSuccess(&r, vmCirros, vmRef)
+
+			r.Rules = []validation.Rule{sata}
+			expectRuleApplicationFailure(&r, vmCirros, vmRef)
+		})
+
+		It("Should apply oneOf rules", func() {
+			r := validation.Rule{
+				Rule:    "oneOf",
+				Name:    "supported-bus",
+				Message: "disks must use exactly one supported bus",
+				Rules:   []validation.Rule{sata, virtio},
+			}
+			expectRuleApplicationSuccess(&r, vmCirros, vmRef)
+
+			r.Rules = []validation.Rule{q35, virtio}
+			expectRuleApplicationFailure(&r, vmCirros, vmRef)
+		})
+
+		It("Should apply not rules", func() {
+			r := validation.Rule{
+				Rule:    "not",
+				Name:    "no-sata",
+				Message: "disks must not use sata",
+				Rules:   []validation.Rule{sata},
+			}
+			expectRuleApplicationSuccess(&r, vmCirros, vmRef)
+
+			r.Rules = []validation.Rule{virtio}
+			expectRuleApplicationFailure(&r, vmCirros, vmRef)
+		})
+
+		It("Should apply nested composite rules", func() {
+			r := validation.Rule{
+				Rule:    "anyOf",
+				Name:    "windows-disks",
+				Message: "disks must be either virtio on q35, or sata",
+				Rules: []validation.Rule{
+					{
+						Rule:    "allOf",
+						Name:    "virtio-q35",
+						Message: "virtio disks on q35",
+						Rules:   []validation.Rule{virtio, q35},
+					},
+					sata,
+				},
+			}
+			expectRuleApplicationSuccess(&r, vmCirros, vmRef)
+		})
+	})
+
+	Context("With invalid rules", func() {
+		It("Should reject composite rules without nested rules", func() {
+			r := validation.Rule{
+				Rule:    "anyOf",
+				Name:    "empty",
+				Message: "nothing to check",
+			}
+			ra, err := r.Specialize(vmCirros, vmRef)
+			Expect(err).To(HaveOccurred())
+			Expect(ra).To(BeNil())
+		})
+
+		It("Should reject not rules with more than one nested rule", func() {
+			r := validation.Rule{
+				Rule:    "not",
+				Name:    "not-both",
+				Message: "cannot negate two rules",
+				Rules:   []validation.Rule{sata, virtio},
+			}
+			ra, err := r.Specialize(vmCirros, vmRef)
+			Expect(err).To(HaveOccurred())
+			Expect(ra).To(BeNil())
+		})
+
+		It("Should error if a nested rule is malformed", func() {
+			sata.Rule = "foobar"
+			r := validation.Rule{
+				Rule:    "anyOf",
+				Name:    "supported-bus",
+				Message: "disks must use a supported bus",
+				Rules:   []validation.Rule{sata, virtio},
+			}
+			expectRuleApplicationError(&r, vmCirros, vmRef)
+		})
+	})
+
+	Context("When evaluated", func() {
+		It("Should roll up nested reports and explain failed branches", func() {
+			rules := []validation.Rule{{
+				Rule:    "anyOf",
+				Name:    "supported-bus",
+				Message: "disks must use a supported bus",
+				Rules: []validation.Rule{sata, {
+					Rule:    "enum",
+					Name:    "scsi-disks",
+					Path:    "jsonpath::.spec.domain.devices.disks[*].disk.bus",
+					Message: "disks must use scsi",
+					Values:  []string{"scsi"},
+				}},
+			}}
+
+			ev := validation.Evaluator{Sink: GinkgoWriter}
+			res := ev.Evaluate(rules, vmCirros)
+			Expect(res.Succeeded()).To(BeFalse())
+			Expect(len(res.Status)).To(Equal(1))
+			Expect(len(res.Status[0].Nested)).To(Equal(2))
+			Expect(res.Status[0].Nested[0].Satisfied).To(BeFalse())
+			Expect(res.Status[0].Nested[1].Satisfied).To(BeFalse())
+
+			causes := res.ToStatusCauses()
+			Expect(len(causes)).To(Equal(1))
+			Expect(causes[0].Message).To(ContainSubstring("sata-disks"))
+			Expect(causes[0].Message).To(ContainSubstring("scsi-disks"))
+		})
+
+		It("Should not count the skipped nested rules", func() {
+			// only on updates, so skipped on creation
+			sata.Operations = []string{validation.OperationUpdate}
+			virtio.Operations = []string{validation.OperationUpdate}
+
+			ev := validation.Evaluator{Sink: GinkgoWriter}
+			for _, kind := range []string{"allOf", "anyOf", "oneOf"} {
+				res := ev.Evaluate([]validation.Rule{{
+					Rule:    kind,
+					Name:    "supported-bus",
+					Message: "disks must use a supported bus",
+					Rules:   []validation.Rule{sata, virtio},
+				}}, vmCirros)
+				Expect(res.Succeeded()).To(BeTrue(), kind)
+				Expect(res.Status[0].Message).To(Equal("None of [sata-disks, virtio-disks] applies as an error"))
+			}
+
+			res := ev.Evaluate([]validation.Rule{{
+				Rule:    "not",
+				Name:    "no-sata",
+				Message: "disks must not use sata",
+				Rules:   []validation.Rule{sata},
+			}}, vmCirros)
+			Expect(res.Succeeded()).To(BeTrue())
+			Expect(res.Status[0].Message).To(Equal("Rule sata-disks does not apply as an error"))
+
+			// the rules which apply still decide
+			sata.Operations = nil
+			res = ev.Evaluate([]validation.Rule{{
+				Rule:    "anyOf",
+				Name:    "supported-bus",
+				Message: "disks must use a supported bus",
+				Rules:   []validation.Rule{virtio, sata},
+			}}, vmCirros)
+			Expect(res.Succeeded()).To(BeFalse())
+		})
+
+		It("Should never fail because of the nested warnings", func() {
+			sata.Severity = validation.SeverityWarning
+			q35.Severity = validation.SeverityWarning
+
+			ev := validation.Evaluator{Sink: GinkgoWriter}
+			res := ev.Evaluate([]validation.Rule{{
+				Rule:    "allOf",
+				Name:    "virtio-and-sata",
+				Message: "disks must use virtio",
+				Rules:   []validation.Rule{virtio, sata},
+			}}, vmCirros)
+			Expect(res.Succeeded()).To(BeTrue())
+			Expect(res.Warnings).To(HaveLen(1))
+			Expect(res.Warnings[0]).To(HavePrefix("disks must use sata"))
+
+			res = ev.Evaluate([]validation.Rule{{
+				Rule:    "anyOf",
+				Name:    "sata-or-q35",
+				Message: "disks must use sata",
+				Rules:   []validation.Rule{sata, q35},
+			}}, vmCirros)
+			Expect(res.Succeeded()).To(BeTrue())
+			Expect(res.Warnings).To(HaveLen(1))
+
+			// a satisfied warning does not fail a not rule either
+			res = ev.Evaluate([]validation.Rule{{
+				Rule:    "not",
+				Name:    "not-q35",
+				Message: "machine type should not be q35",
+				Rules:   []validation.Rule{q35},
+			}}, vmCirros)
+			Expect(res.Succeeded()).To(BeTrue())
+			Expect(res.Warnings).To(BeEmpty())
+		})
+
+		It("Should drop the nested warnings once another branch is satisfied", func() {
+			sata.Severity = validation.SeverityWarning
+			anyOf := validation.Rule{
+				Rule:    "anyOf",
+				Name:    "sata-or-virtio",
+				Message: "disks must use a supported bus",
+				Rules:   []validation.Rule{sata, virtio},
+			}
+
+			ev := validation.Evaluator{Sink: GinkgoWriter}
+			res := ev.Evaluate([]validation.Rule{anyOf}, vmCirros)
+			Expect(res.Succeeded()).To(BeTrue())
+			Expect(res.Warnings).To(BeEmpty())
+
+			oneOf := anyOf
+			oneOf.Rule = "oneOf"
+			res = ev.Evaluate([]validation.Rule{oneOf}, vmCirros)
+			Expect(res.Succeeded()).To(BeTrue())
+			Expect(res.Warnings).To(BeEmpty())
+
+			// no branch satisfies the rule
+			for i := range vmCirros.Spec.Template.Spec.Domain.Devices.Disks {
+				vmCirros.Spec.Template.Spec.Domain.Devices.Disks[i].Disk.Bus = "ide"
+			}
+			res = ev.Evaluate([]validation.Rule{anyOf}, vmCirros)
+			Expect(res.Succeeded()).To(BeFalse())
+			Expect(res.Warnings).To(HaveLen(1))
+			Expect(res.Warnings[0]).To(HavePrefix("disks must use sata"))
+		})
+	})
+})
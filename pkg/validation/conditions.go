@@ -0,0 +1,162 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2019 Red Hat, Inc.
+ */
+
+package validation
+
+import (
+	"fmt"
+	"reflect"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	k6tv1 "kubevirt.io/client-go/api/v1"
+)
+
+// Condition restricts the VMs a Rule applies on, depending on the value of a field.
+// A Rule applies only if all its conditions are met.
+// If a Condition has only a Path, it is met if the Path is set in the VM.
+// Otherwise all the checks set in a Condition must pass.
+// Conditions are always checked against the actual VM, never against the
+// reference VM: a missing field never meets a Condition.
+type Condition struct {
+	Path string `json:"path,omitempty"`
+	// checks on the values found at Path
+	Equals interface{} `json:"equals,omitempty"`
+	In     []string    `json:"in,omitempty"`
+	Min    interface{} `json:"min,omitempty"`
+	Max    interface{} `json:"max,omitempty"`
+	// LabelSelector is matched against the labels of the VM object
+	LabelSelector *metav1.LabelSelector `json:"labelSelector,omitempty"`
+}
+
+func (c *Condition) IsMetBy(vm *k6tv1.VirtualMachine) (bool, error) {
+	return c.isMetBy(vm, nil)
+}
+
+// isMetBy is like IsMetBy, using the expressions compiled along with the rule of the condition.
+func (c *Condition) isMetBy(vm *k6tv1.VirtualMachine, exprs compiledExpressions) (bool, error) {
+	if c.Path == "" && c.LabelSelector == nil {
+		return false, fmt.Errorf("condition without path and labelSelector")
+	}
+
+	if c.LabelSelector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(c.LabelSelector)
+		if err != nil {
+			return false, err
+		}
+		if !selector.Matches(labels.Set(vm.Labels)) {
+			return false, nil
+		}
+	}
+
+	if c.Path == "" {
+		return true, nil
+	}
+
+	p, err := NewPath(c.Path)
+	if err != nil {
+		return false, err
+	}
+	err = p.Find(vm)
+	if err == ErrInvalidJSONPath {
+		// like for Rule.Valid, a missing path is not an error
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	values := p.setValues()
+	if len(values) == 0 {
+		return false, nil
+	}
+
+	var rng QuantityRange
+	if c.Min != nil || c.Max != nil {
+		// bounds can be JSONPaths too, but without the reference VM fallback.
+		err = rng.Decode(exprs.param(c.Min), exprs.param(c.Max), vm, vm)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	for _, val := range values {
+		obj := val.Interface()
+		if c.Equals != nil && !valueEquals(obj, c.Equals) {
+			return false, nil
+		}
+		if len(c.In) > 0 && !containsOnly([]string{valueAsString(obj)}, c.In) {
+			return false, nil
+		}
+		if rng.MinSet || rng.MaxSet {
+			q, ok := toQuantity(obj)
+			if !ok || !rng.Includes(q) {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
+func (p *Path) presentValues() []reflect.Value {
+	return p.filterValues(isPresent)
+}
+
+func (p *Path) setValues() []reflect.Value {
+	return p.filterValues(isSet)
+}
+
+func (p *Path) filterValues(keep func(reflect.Value) bool) []reflect.Value {
+	var ret []reflect.Value
+	for _, result := range p.results {
+		for _, val := range result {
+			if keep(val) {
+				ret = append(ret, val)
+			}
+		}
+	}
+	return ret
+}
+
+func valueAsString(obj interface{}) string {
+	val := reflect.ValueOf(obj)
+	if val.Kind() == reflect.Ptr && !val.IsNil() {
+		obj = val.Elem().Interface()
+	}
+	if q, ok := obj.(resource.Quantity); ok {
+		return q.String()
+	}
+	return fmt.Sprintf("%v", obj)
+}
+
+func valueEquals(obj, expected interface{}) bool {
+	if expectedBool, ok := expected.(bool); ok {
+		v, ok := toBool(obj)
+		return ok && v == expectedBool
+	}
+	if _, isString := obj.(string); !isString {
+		if v, ok := toQuantity(obj); ok {
+			if expectedQuantity, ok := toQuantity(expected); ok {
+				return v.Cmp(expectedQuantity) == 0
+			}
+		}
+	}
+	return valueAsString(obj) == fmt.Sprintf("%v", expected)
+}
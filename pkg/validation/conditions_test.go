@@ -0,0 +1,171 @@
+package validation_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	k6tv1 "kubevirt.io/client-go/api/v1"
+
+	"github.com/kubevirt/kubevirt-template-validator/pkg/validation"
+)
+
+var _ = Describe("Conditions", func() {
+	var (
+		vmCirros *k6tv1.VirtualMachine
+	)
+
+	BeforeEach(func() {
+		vmCirros = NewVMCirros()
+	})
+
+	Context("With path conditions", func() {
+		It("Should be met if the path is set", func() {
+			c := validation.Condition{Path: "jsonpath::.spec.domain.machine.type"}
+			Expect(c.IsMetBy(vmCirros)).To(BeTrue())
+		})
+
+		It("Should not be met if the path is missing", func() {
+			c := validation.Condition{Path: "jsonpath::.spec.domain.firmware.bootloader.efi"}
+			Expect(c.IsMetBy(vmCirros)).To(BeFalse())
+		})
+
+		It("Should check equality", func() {
+			c := validation.Condition{
+				Path:   "jsonpath::.spec.domain.machine.type",
+				Equals: "q35",
+			}
+			Expect(c.IsMetBy(vmCirros)).To(BeTrue())
+
+			c.Equals = "pc"
+			Expect(c.IsMetBy(vmCirros)).To(BeFalse())
+		})
+
+		It("Should check enum membership", func() {
+			c := validation.Condition{
+				Path: "jsonpath::.spec.domain.machine.type",
+				In:   []string{"pc", "q35"},
+			}
+			Expect(c.IsMetBy(vmCirros)).To(BeTrue())
+
+			c.In = []string{"pc"}
+			Expect(c.IsMetBy(vmCirros)).To(BeFalse())
+		})
+
+		It("Should compare numbers", func() {
+			c := validation.Condition{
+				Path: "jsonpath::.spec.domain.resources.requests.memory",
+				Min:  "64Mi",
+			}
+			Expect(c.IsMetBy(vmCirros)).To(BeTrue())
+
+			c.Min = "1Gi"
+			Expect(c.IsMetBy(vmCirros)).To(BeFalse())
+
+			c.Min = nil
+			c.Max = 256 * 1024 * 1024
+			Expect(c.IsMetBy(vmCirros)).To(BeTrue())
+		})
+
+		It("Should check booleans", func() {
+			_true := true
+			vmCirros.Spec.Template.Spec.Domain.Firmware = &k6tv1.Firmware{
+				Bootloader: &k6tv1.Bootloader{
+					EFI: &k6tv1.EFI{SecureBoot: &_true},
+				},
+			}
+			c := validation.Condition{
+				Path:   "jsonpath::.spec.domain.firmware.bootloader.efi.secureBoot",
+				Equals: true,
+			}
+			Expect(c.IsMetBy(vmCirros)).To(BeTrue())
+
+			c.Equals = false
+			Expect(c.IsMetBy(vmCirros)).To(BeFalse())
+		})
+	})
+
+	Context("With label selectors", func() {
+		It("Should match the VM labels", func() {
+			c := validation.Condition{
+				LabelSelector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{"kubevirt.io/vm": "vm-cirros"},
+				},
+			}
+			Expect(c.IsMetBy(vmCirros)).To(BeTrue())
+		})
+
+		It("Should not match missing labels", func() {
+			c := validation.Condition{
+				LabelSelector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{"workload": "high-performance"},
+				},
+			}
+			Expect(c.IsMetBy(vmCirros)).To(BeFalse())
+		})
+	})
+
+	Context("With rules", func() {
+		It("Should skip rules whose conditions are not met", func() {
+			rules := []validation.Rule{{
+				Name:    "secureboot-needs-smm",
+				Rule:    "bool",
+				Path:    "jsonpath::.spec.domain.features.smm.enabled",
+				Message: "SMM must be enabled with SecureBoot",
+				When: []validation.Condition{
+					{Path: "jsonpath::.spec.domain.firmware.bootloader.efi"},
+					{Path: "jsonpath::.spec.domain.firmware.bootloader.efi.secureBoot", Equals: true},
+				},
+			}}
+
+			ev := validation.Evaluator{Sink: GinkgoWriter}
+			res := ev.Evaluate(rules, vmCirros)
+			Expect(res.Succeeded()).To(BeTrue())
+			Expect(len(res.Status)).To(Equal(1))
+			Expect(res.Status[0].Skipped).To(BeTrue())
+		})
+
+		It("Should apply rules whose conditions are met", func() {
+			vmCirros.Labels["workload"] = "high-performance"
+			rules := []validation.Rule{{
+				Name:    "high-performance-cores",
+				Rule:    "integer",
+				Path:    "jsonpath::.spec.domain.cpu.cores",
+				Message: "high performance VMs need dedicated cores",
+				Min:     2,
+				When: []validation.Condition{{
+					LabelSelector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{"workload": "high-performance"},
+					},
+				}},
+			}}
+
+			ev := validation.Evaluator{Sink: GinkgoWriter}
+			res := ev.Evaluate(rules, vmCirros)
+			Expect(res.Succeeded()).To(BeFalse())
+			Expect(len(res.Status)).To(Equal(1))
+			Expect(res.Status[0].Skipped).To(BeFalse())
+		})
+
+		It("Should parse conditions", func() {
+			text := `[{
+            "name": "secureboot-needs-smm",
+            "path": "jsonpath::.spec.domain.features.smm.enabled",
+            "rule": "bool",
+            "message": "SMM must be enabled with SecureBoot",
+            "when": [{
+              "path": "jsonpath::.spec.domain.firmware.bootloader.efi.secureBoot",
+              "equals": true
+            }, {
+              "labelSelector": {"matchLabels": {"workload": "high-performance"}}
+            }]
+          }]`
+			rules, err := validation.ParseRules([]byte(text))
+			Expect(err).To(Not(HaveOccurred()))
+			Expect(len(rules)).To(Equal(1))
+			Expect(len(rules[0].When)).To(Equal(2))
+			Expect(rules[0].When[0].Equals).To(Equal(true))
+			Expect(rules[0].When[1].LabelSelector.MatchLabels).To(HaveKeyWithValue("workload", "high-performance"))
+		})
+	})
+})
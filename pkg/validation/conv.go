@@ -20,6 +20,9 @@ package validation
 
 import (
 	"math"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/api/resource"
 )
 
 func toInt64(obj interface{}) (int64, bool) {
@@ -43,3 +46,47 @@ func toInt64(obj interface{}) (int64, bool) {
 	}
 	return 0, false
 }
+
+func toBool(obj interface{}) (bool, bool) {
+	switch val := obj.(type) {
+	case bool:
+		return val, true
+	case *bool:
+		if val == nil {
+			return false, false
+		}
+		return *val, true
+	}
+	return false, false
+}
+
+func toQuantity(obj interface{}) (resource.Quantity, bool) {
+	switch val := obj.(type) {
+	case resource.Quantity:
+		return val, true
+	case *resource.Quantity:
+		if val == nil {
+			return resource.Quantity{}, false
+		}
+		return *val, true
+	case string:
+		q, err := resource.ParseQuantity(val)
+		if err != nil {
+			return resource.Quantity{}, false
+		}
+		return q, true
+	case float32:
+		return toQuantity(float64(val))
+	case float64:
+		// JSON numbers are always decoded as float64, so we need to handle
+		// both integral and fractional values here.
+		if val == math.Trunc(val) && math.Abs(val) < math.MaxInt64 {
+			return *resource.NewQuantity(int64(val), resource.DecimalSI), true
+		}
+		return toQuantity(strconv.FormatFloat(val, 'f', -1, 64))
+	}
+	if intVal, ok := toInt64(obj); ok {
+		return *resource.NewQuantity(intVal, resource.DecimalSI), true
+	}
+	return resource.Quantity{}, false
+}
@@ -28,8 +28,6 @@ import (
 
 	k6tv1 "kubevirt.io/client-go/api/v1"
 	"kubevirt.io/client-go/log"
-
-	k6tobjs "github.com/kubevirt/kubevirt-template-validator/pkg/kubevirtobjs"
 )
 
 var (
@@ -37,35 +35,71 @@ var (
 	ErrDuplicateRuleName    = errors.New("duplicate Rule Name")
 	ErrMissingRequiredKey   = errors.New("missing required key")
 	ErrUnsatisfiedRule      = errors.New("rule is not satisfied")
+	ErrInvalidSeverity      = errors.New("unrecognized Rule severity")
 )
 
 func isValidRule(r string) bool {
-	validRules := []string{"integer", "string", "regex", "enum"}
+	validRules := []string{"integer", "quantity", "string", "regex", "enum", "bool", "required", "forbidden", ruleCEL, ruleForEach, ruleAggregate, ruleUnique, ruleReferences, ruleFormat, ruleSchema, ruleImmutable, ruleTransition}
 	for _, v := range validRules {
 		if r == v {
 			return true
 		}
 	}
-	return false
+	return isCompositeRule(r)
 }
 
 type Report struct {
-	Ref       *Rule
-	Skipped   bool   // because not valid, with `valid` defined as per spec
-	Satisfied bool   // applied rule, with this result
-	Message   string // human-friendly application output (debug/troubleshooting)
-	Error     error  // *internal* error
+	Ref         *Rule
+	Skipped     bool        // because not valid, with `valid` defined as per spec
+	SkipReason  string      // why the rule was skipped, e.g. "not appliable"
+	Satisfied   bool        // applied rule, with this result
+	Message     string      // human-friendly application output (debug/troubleshooting)
+	Error       error       // *internal* error
+	Nested      []Report    // reports of the nested rules, if any (e.g. composite rules)
+	Element     string      // the list element the rule was applied on, if any (e.g. forEach rules)
+	Violations  []Violation // the fields at fault, if the rule knows them (e.g. schema rules)
+	Reason      string      // the reason code of the failure, see the Reason constants
+	Description string      // the message of the rule for the user, with the placeholders replaced (if any)
 }
 
 type Result struct {
-	Status []Report
-	failed bool
+	Status   []Report
+	Source   string   // where the rules come from, e.g. the template, see RuleSet.Source
+	Warnings []string // to be reported back to the user, but not failing the evaluation
+	// the causes tolerated because the previous version of the VM had them already, see EvaluateRuleSetRatcheting
+	Ratcheted []Cause
+	failed    bool
 }
 
-//Warn logs warnings into pod's log.
-//Warnings are not included in result response.
+// Warn records a warning, which is both logged and reported back to the user.
 func (r *Result) Warn(message string, e error) {
-	log.Log.Warningf(fmt.Sprintf("%s: %s", message, e.Error()))
+	r.warn(fmt.Sprintf("%s: %s", message, e.Error()))
+}
+
+func (r *Result) warn(warning string) {
+	log.Log.Warning(warning)
+	r.Warnings = append(r.Warnings, warning)
+}
+
+// Info only logs the message. Infos are not included in result response.
+func (r *Result) Info(message string, e error) {
+	log.Log.Infof("%s: %s", message, e.Error())
+}
+
+// Notice reports a problem according to the severity of the rule.
+func (r *Result) Notice(ru *Rule, e error) {
+	r.notice(ru, ru.describe(ru.Message, e.Error()))
+}
+
+func (r *Result) notice(ru *Rule, text string) {
+	switch ru.GetSeverity() {
+	case SeverityWarning:
+		r.warn(text)
+	case SeverityInfo:
+		log.Log.Info(text)
+	default:
+		r.failed = true
+	}
 }
 
 func (r *Result) Fail(ru *Rule, e error) {
@@ -78,26 +112,38 @@ func (r *Result) Fail(ru *Rule, e error) {
 	r.failed = true
 }
 
-func (r *Result) Skip(ru *Rule) {
+// Skip records that the rule was not applied, and why, e.g. "not appliable".
+func (r *Result) Skip(ru *Rule, reason string) {
 	r.Status = append(r.Status, Report{
-		Ref:     ru,
-		Skipped: true,
+		Ref:        ru,
+		Skipped:    true,
+		SkipReason: reason,
 	})
 }
 
 func (r *Result) Applied(ru *Rule, satisfied bool, message string) {
-	r.Status = append(r.Status, Report{
+	r.AppliedNested(ru, satisfied, message, nil)
+}
+
+func (r *Result) AppliedNested(ru *Rule, satisfied bool, message string, nested []Report) {
+	r.applied(Report{
 		Ref:       ru,
 		Satisfied: satisfied,
 		Message:   message,
+		Nested:    nested,
 	})
+}
 
-	if !satisfied {
-		if ru.JustWarning {
-			r.Warn(ru.Message, ErrUnsatisfiedRule)
-		} else {
-			r.failed = true
+func (r *Result) applied(rr Report) {
+	r.Status = append(r.Status, rr)
+
+	if !rr.Satisfied {
+		// explained like the causes, so the warnings are just as useful
+		details := rr.Message
+		if details == "" {
+			details = ErrUnsatisfiedRule.Error()
 		}
+		r.notice(rr.Ref, causeMessage(&rr, details))
 	}
 }
 
@@ -113,29 +159,95 @@ func needsCause(rr *Report) (bool, string) {
 		return true, fmt.Sprintf("%v", rr.Error)
 	}
 	// rules we should check, and which failed (external errors?)
-	if !rr.Skipped && !rr.Satisfied {
+	// warnings and infos never reject the VM, so they are not causes.
+	if !rr.Skipped && !rr.Satisfied && rr.Ref.GetSeverity() == SeverityError {
 		return true, rr.Message
 	}
 	return false, ""
 }
 
+// ToStatusCauses returns the causes of the rejection of the VM, for the admission response.
 func (r *Result) ToStatusCauses() []metav1.StatusCause {
 	var causes []metav1.StatusCause
+	for _, c := range r.Causes() {
+		causes = append(causes, c.ToStatusCause())
+	}
+	return causes
+}
+
+// Causes returns the causes of the rejection of the VM, one for each value at fault when the rules can tell.
+func (r *Result) Causes() []Cause {
+	var causes []Cause
 	if !r.failed {
 		return causes
 	}
-	for _, rr := range r.Status {
-		if ok, message := needsCause(&rr); ok {
-			causes = append(causes, metav1.StatusCause{
-				Type:    metav1.CauseTypeFieldValueInvalid,
-				Field:   TrimJSONPath(rr.Ref.Path),
-				Message: fmt.Sprintf("%s: %s", rr.Ref.Message, message),
-			})
+	for i := range r.Status {
+		for _, c := range reportCauses(&r.Status[i], r.Source) {
+			if !r.isRatcheted(c) {
+				causes = append(causes, c)
+			}
 		}
 	}
 	return causes
 }
 
+func reportCauses(rr *Report, source string) []Cause {
+	ok, message := needsCause(rr)
+	if !ok {
+		return nil
+	}
+	if rr.Error == nil && rr.Ref.Rule == ruleForEach {
+		// point at the offending elements, rather than at the whole list
+		var causes []Cause
+		for i := range rr.Nested {
+			causes = append(causes, reportCauses(&rr.Nested[i], source)...)
+		}
+		if len(causes) > 0 {
+			return causes
+		}
+	}
+	if rr.Error == nil && len(rr.Violations) > 0 {
+		causes := make([]Cause, 0, len(rr.Violations))
+		for _, v := range rr.Violations {
+			text := rr.Ref.withHints(fmt.Sprintf("%s: %s", description(rr), v.Message))
+			if v.Description != "" {
+				text = rr.Ref.describe(v.Description, v.Message)
+			}
+			causes = append(causes, Cause{
+				Reason:  reportReason(rr),
+				Field:   fieldPath(v.Field),
+				Message: text,
+				Rule:    rr.Ref.Name,
+				Source:  source,
+			})
+		}
+		return causes
+	}
+	return []Cause{{
+		Reason:  reportReason(rr),
+		Field:   fieldPath(TrimJSONPath(rr.Ref.Path)),
+		Message: causeMessage(rr, message),
+		Rule:    rr.Ref.Name,
+		Source:  source,
+	}}
+}
+
+// causeMessage explains to the user why the rule rejected the VM.
+// Internal errors are always explained by the error itself.
+func causeMessage(rr *Report, details string) string {
+	if rr.Error != nil {
+		return fmt.Sprintf("%s: %s", rr.Ref.Message, details)
+	}
+	return rr.Ref.describe(rr.Description, details)
+}
+
+func description(rr *Report) string {
+	if rr.Description != "" {
+		return rr.Description
+	}
+	return rr.Ref.Message
+}
+
 type Evaluator struct {
 	Sink io.Writer
 }
@@ -156,10 +268,38 @@ func (ev *Evaluator) isRuleWellFormed(r *Rule, names map[string]int) (bool, erro
 		return false, ErrUnrecognizedRuleType
 	}
 
-	if r.Path == "" || r.Message == "" {
+	if (r.Path == "" && !isCompositeRule(r.Rule) && r.Rule != ruleCEL) || r.Message == "" {
 		fmt.Fprintf(ev.Sink, "%s failed: missing keys\n", r.Name)
 		return false, ErrMissingRequiredKey
 	}
+
+	if !isValidSeverity(r.Severity) {
+		fmt.Fprintf(ev.Sink, "%s failed: invalid severity\n", r.Name)
+		return false, ErrInvalidSeverity
+	}
+
+	if !isValidQuantifier(r.Quantifier) {
+		fmt.Fprintf(ev.Sink, "%s failed: invalid quantifier\n", r.Name)
+		return false, ErrInvalidQuantifier
+	}
+
+	if !isValidOnMissing(r.OnMissing) {
+		fmt.Fprintf(ev.Sink, "%s failed: invalid onMissing policy\n", r.Name)
+		return false, ErrInvalidOnMissing
+	}
+
+	for _, op := range r.Operations {
+		if !isValidOperation(op) {
+			fmt.Fprintf(ev.Sink, "%s failed: invalid operation\n", r.Name)
+			return false, ErrInvalidOperation
+		}
+	}
+
+	// the rules are compiled beforehand (see NewRuleSet): they may be shared by concurrent evaluations
+	if r.compileErr != nil {
+		fmt.Fprintf(ev.Sink, "%s failed: %v\n", r.Name, r.compileErr)
+		return false, r.compileErr
+	}
 	return true, nil
 }
 
@@ -170,13 +310,23 @@ func (ev *Evaluator) isRuleWellFormed(r *Rule, names map[string]int) (bool, erro
 // The 'error' return value signals *internal* evaluation error.
 // IOW 'false' evaluation *DOES NOT* imply error != nil
 func (ev *Evaluator) Evaluate(rules []Rule, vm *k6tv1.VirtualMachine) *Result {
+	return ev.EvaluateWithOldVM(rules, vm, nil)
+}
+
+// EvaluateWithOldVM is like Evaluate, but it also lets the rules access the
+// previous version of the VM, which is expected to be nil unless on updates.
+// The rules are compiled first, like NewRuleSet does; use EvaluateRuleSet to evaluate
+// the same rules many times.
+func (ev *Evaluator) EvaluateWithOldVM(rules []Rule, vm, oldVM *k6tv1.VirtualMachine) *Result {
+	return ev.EvaluateRuleSet(NewRuleSet(rules), vm, oldVM)
+}
+
+func (ev *Evaluator) evaluate(rules []Rule, vm, oldVM, refVm *k6tv1.VirtualMachine, vars *celVars) *Result {
 	// We can argue that this stage is needed because the parsing layer is too poor/dumb
 	// still, we need to do what we need to do.
 	names := make(map[string]int)
 	result := Result{}
 
-	refVm := k6tobjs.NewDefaultVirtualMachine()
-
 	for i := range rules {
 		r := &rules[i]
 
@@ -189,25 +339,44 @@ func (ev *Evaluator) Evaluate(rules []Rule, vm *k6tv1.VirtualMachine) *Result {
 			continue
 		}
 
+		if !r.isOperationSelected(oldVM) {
+			reason := fmt.Sprintf("not for %s", operation(oldVM))
+			fmt.Fprintf(ev.Sink, "%s SKIPPED: %s\n", r.Name, reason)
+			result.Skip(r, reason)
+			continue
+		}
+
 		// Specialize() may be costly, so we do this before.
 		ok, err := r.IsAppliableOn(vm)
+		if mse, isMissing := err.(*missingSkipError); isMissing {
+			// e.g. a condition dividing by a missing value
+			fmt.Fprintf(ev.Sink, "%s SKIPPED: %s\n", r.Name, mse.Error())
+			result.Skip(r, mse.Error())
+			continue
+		}
 		if err != nil {
 			fmt.Fprintf(ev.Sink, "%s failed: not appliable: %v\n", r.Name, err)
-			if r.JustWarning {
-				result.Warn(r.Message, err)
-			} else {
+			if r.GetSeverity() == SeverityError {
 				result.Fail(r, err)
+			} else {
+				result.Notice(r, err)
 			}
 			continue
 		}
 		if !ok {
 			// Legit case. Nothing to do or to complain.
 			fmt.Fprintf(ev.Sink, "%s SKIPPED: not appliable\n", r.Name)
-			result.Skip(r)
+			result.Skip(r, "not appliable")
 			continue
 		}
 
-		ra, err := r.Specialize(vm, refVm)
+		ra, err := r.specialize(vm, oldVM, refVm, vars)
+		if mse, ok := err.(*missingSkipError); ok {
+			// e.g. a bound dividing by a missing value
+			fmt.Fprintf(ev.Sink, "%s SKIPPED: %s\n", r.Name, mse.Error())
+			result.Skip(r, mse.Error())
+			continue
+		}
 		if err != nil {
 			fmt.Fprintf(ev.Sink, "%s failed: cannot specialize: %v\n", r.Name, err)
 			result.Fail(r, err)
@@ -215,15 +384,41 @@ func (ev *Evaluator) Evaluate(rules []Rule, vm *k6tv1.VirtualMachine) *Result {
 		}
 
 		satisfied, err := ra.Apply(vm, refVm)
+		if mse, ok := err.(*missingSkipError); ok {
+			fmt.Fprintf(ev.Sink, "%s SKIPPED: %s\n", r.Name, mse.Error())
+			result.Skip(r, mse.Error())
+			continue
+		}
 		if err != nil {
 			fmt.Fprintf(ev.Sink, "%s failed: cannot apply: %v\n", r.Name, err)
 			result.Fail(r, err)
 			continue
 		}
 
+		var nested []Report
+		if nr, ok := ra.(nestedReporter); ok {
+			nested = nr.NestedReports()
+			result.Warnings = append(result.Warnings, nr.NestedWarnings()...)
+		}
+
+		var violations []Violation
+		if vr, ok := ra.(violationReporter); ok {
+			violations = vr.Violations()
+		} else if !satisfied && r.GetSeverity() == SeverityError {
+			violations = valueViolations(r, ra, vm, oldVM, refVm)
+		}
+
 		applicationText := ra.String()
 		fmt.Fprintf(ev.Sink, "%s applied: %v, %s\n", r.Name, boolAsStatus(satisfied), applicationText)
-		result.Applied(r, satisfied, applicationText)
+		result.applied(Report{
+			Ref:         r,
+			Satisfied:   satisfied,
+			Message:     applicationText,
+			Nested:      nested,
+			Violations:  violations,
+			Description: r.renderMessage(ra),
+			Reason:      ruleReason(r, ra),
+		})
 	}
 
 	return &result
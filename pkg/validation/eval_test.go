@@ -368,3 +368,119 @@ var _ = Describe("Eval", func() {
 // TODO:
 // test with 2+ rules failed
 // test to exercise the translation logic
+
+var _ = Describe("Severity", func() {
+	var vmCirros *k6tv1.VirtualMachine
+
+	BeforeEach(func() {
+		vmCirros = NewVMCirros()
+	})
+
+	newBusRule := func(severity string) validation.Rule {
+		return validation.Rule{
+			Name:     "disk bus",
+			Rule:     "enum",
+			Path:     "jsonpath::.spec.domain.devices.disks[*].disk.bus",
+			Message:  "disks should use sata",
+			Values:   []string{"sata"},
+			Severity: severity,
+		}
+	}
+
+	It("Should fail by default", func() {
+		rules := []validation.Rule{newBusRule("")}
+
+		ev := validation.Evaluator{Sink: GinkgoWriter}
+		res := ev.Evaluate(rules, vmCirros)
+
+		Expect(res.Succeeded()).To(BeFalse())
+		Expect(res.Warnings).To(BeEmpty())
+		// one cause for each disk
+		Expect(len(res.ToStatusCauses())).To(Equal(2))
+	})
+
+	It("Should report warnings", func() {
+		rules := []validation.Rule{newBusRule(validation.SeverityWarning)}
+
+		ev := validation.Evaluator{Sink: GinkgoWriter}
+		res := ev.Evaluate(rules, vmCirros)
+
+		Expect(res.Succeeded()).To(BeTrue())
+		Expect(res.Warnings).To(Equal([]string{"disks should use sata: Some of [virtio, virtio] are not in [sata]"}))
+	})
+
+	It("Should report justWarning rules as warnings", func() {
+		rules := []validation.Rule{newBusRule("")}
+		rules[0].JustWarning = true
+
+		ev := validation.Evaluator{Sink: GinkgoWriter}
+		res := ev.Evaluate(rules, vmCirros)
+
+		Expect(res.Succeeded()).To(BeTrue())
+		Expect(len(res.Warnings)).To(Equal(1))
+	})
+
+	It("Should prefer severity over justWarning", func() {
+		rules := []validation.Rule{newBusRule(validation.SeverityError)}
+		rules[0].JustWarning = true
+
+		ev := validation.Evaluator{Sink: GinkgoWriter}
+		res := ev.Evaluate(rules, vmCirros)
+
+		Expect(res.Succeeded()).To(BeFalse())
+		Expect(res.Warnings).To(BeEmpty())
+	})
+
+	It("Should not report infos", func() {
+		rules := []validation.Rule{newBusRule(validation.SeverityInfo)}
+
+		ev := validation.Evaluator{Sink: GinkgoWriter}
+		res := ev.Evaluate(rules, vmCirros)
+
+		Expect(res.Succeeded()).To(BeTrue())
+		Expect(res.Warnings).To(BeEmpty())
+	})
+
+	It("Should not turn warnings into causes", func() {
+		rules := []validation.Rule{newBusRule(validation.SeverityWarning), {
+			Name:    "machine type",
+			Rule:    "regex",
+			Path:    "jsonpath::.spec.domain.machine.type",
+			Message: "machine type must be pc",
+			Regex:   "^pc$",
+		}}
+
+		ev := validation.Evaluator{Sink: GinkgoWriter}
+		res := ev.Evaluate(rules, vmCirros)
+
+		Expect(res.Succeeded()).To(BeFalse())
+		Expect(len(res.Warnings)).To(Equal(1))
+		causes := res.ToStatusCauses()
+		Expect(len(causes)).To(Equal(1))
+		Expect(causes[0].Field).To(Equal("spec.template.spec.domain.machine.type"))
+	})
+
+	It("Should report the warnings of nested rules", func() {
+		rules := []validation.Rule{{
+			Name:    "all",
+			Rule:    "allOf",
+			Message: "all rules must be satisfied",
+			Rules:   []validation.Rule{newBusRule(validation.SeverityWarning)},
+		}}
+
+		ev := validation.Evaluator{Sink: GinkgoWriter}
+		res := ev.Evaluate(rules, vmCirros)
+
+		Expect(len(res.Warnings)).To(Equal(1))
+	})
+
+	It("Should reject unknown severities", func() {
+		rules := []validation.Rule{newBusRule("fatal")}
+
+		ev := validation.Evaluator{Sink: GinkgoWriter}
+		res := ev.Evaluate(rules, vmCirros)
+
+		Expect(res.Succeeded()).To(BeFalse())
+		Expect(res.Status[0].Error).To(Equal(validation.ErrInvalidSeverity))
+	})
+})
@@ -0,0 +1,532 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2019 Red Hat, Inc.
+ */
+
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+	"unicode"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	k6tv1 "kubevirt.io/client-go/api/v1"
+)
+
+// Expressions let rules compute values from one or more fields, e.g.
+//   expr::{.spec.domain.cpu.sockets} * {.spec.domain.cpu.cores} * {.spec.domain.cpu.threads}
+// Operands are either numbers, quantities (e.g. 2Gi, 500m) or JSONPaths enclosed in
+// braces, which follow the same rules of the "jsonpath::" paths and must resolve to
+// exactly one value; they may start with a path prefix too, e.g. {vm::.spec.template.spec.domain.cpu.cores}.
+// Supported operators are + - * / and parentheses.
+// Expressions are evaluated using exact rational arithmetic.
+// The operands without value read as their zero value, like the "jsonpath::" paths; when that
+// makes the expression undefined, e.g. a division by a missing value, the rule is skipped.
+
+var (
+	ErrDivisionByZero = errors.New("division by zero")
+)
+
+const (
+	ExpressionPrefix string = "expr::"
+)
+
+func isExpression(s string) bool {
+	return strings.HasPrefix(s, ExpressionPrefix)
+}
+
+func isExpressionParam(obj interface{}) bool {
+	if _, ok := obj.(*Expression); ok {
+		return true
+	}
+	s, ok := obj.(string)
+	return ok && isExpression(s)
+}
+
+// compiledExpressions are the expressions among the parameters of a rule, parsed once, by source.
+type compiledExpressions map[string]*Expression
+
+// compileExpressions parses the parameters which are expressions. The malformed ones are left out:
+// they are reported by the linter, and they fail on evaluation like any other malformed parameter.
+func compileExpressions(params ...interface{}) compiledExpressions {
+	var ret compiledExpressions
+	for _, param := range params {
+		s, ok := param.(string)
+		if !ok || !isExpression(s) {
+			continue
+		}
+		e, err := NewExpression(s)
+		if err != nil {
+			continue
+		}
+		if ret == nil {
+			ret = make(compiledExpressions)
+		}
+		ret[s] = e
+	}
+	return ret
+}
+
+// param returns the compiled expression of the parameter, if any, or else the parameter as is.
+func (ce compiledExpressions) param(obj interface{}) interface{} {
+	if s, ok := obj.(string); ok {
+		if e, ok := ce[s]; ok {
+			return e
+		}
+	}
+	return obj
+}
+
+// scope returns the expressions with their JSONPaths made relative to element, see scopePath.
+func (ce compiledExpressions) scope(element string) compiledExpressions {
+	if len(ce) == 0 {
+		return ce
+	}
+	ret := make(compiledExpressions, len(ce))
+	for s, e := range ce {
+		ret[scopePath(s, element)] = e.rewritePaths(func(path string) string {
+			return scopeExprPath(path, element)
+		})
+	}
+	return ret
+}
+
+type exprNode interface {
+	eval(env *exprEnv) (*big.Rat, error)
+}
+
+type exprEnv struct {
+	vm       *k6tv1.VirtualMachine
+	ref      *k6tv1.VirtualMachine
+	binary   bool
+	operands []string
+	missing  []string // the operands without value, see pathNode
+}
+
+type Expression struct {
+	Source string
+	root   exprNode
+}
+
+type ExpressionResult struct {
+	Value  *big.Rat
+	Binary bool // true if any operand used binary SI units
+	// Explanation reports the values of all the operands, to make the result easy to understand
+	Explanation string
+}
+
+func NewExpression(s string) (*Expression, error) {
+	if !isExpression(s) {
+		return nil, fmt.Errorf("not an expression: %s", s)
+	}
+	src := strings.TrimSpace(strings.TrimPrefix(s, ExpressionPrefix))
+	p := exprParser{src: src}
+	root, err := p.parseSum()
+	if err != nil {
+		return nil, fmt.Errorf("malformed expression %q: %v", src, err)
+	}
+	p.skipSpaces()
+	if p.pos < len(p.src) {
+		return nil, fmt.Errorf("malformed expression %q: unexpected %q at offset %d", src, p.src[p.pos:], p.pos)
+	}
+	return &Expression{Source: src, root: root}, nil
+}
+
+func (e *Expression) Evaluate(vm, ref *k6tv1.VirtualMachine) (*ExpressionResult, error) {
+	env := exprEnv{vm: vm, ref: ref}
+	val, err := e.root.eval(&env)
+	if err == ErrDivisionByZero && len(env.missing) > 0 {
+		return nil, &missingSkipError{Path: exprPath(env.missing[0])}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot evaluate %s: %v", e.explain("?", env.operands), err)
+	}
+	res := ExpressionResult{Value: val, Binary: env.binary}
+	res.Explanation = e.explain(res.String(), env.operands)
+	return &res, nil
+}
+
+// Paths returns the JSONPaths used as operands, in order of appearance.
+func (e *Expression) Paths() []string {
+	var paths []string
+	collectExprPaths(e.root, &paths)
+	return paths
+}
+
+func collectExprPaths(node exprNode, paths *[]string) {
+	switch n := node.(type) {
+	case *pathNode:
+		*paths = append(*paths, n.path)
+	case *negNode:
+		collectExprPaths(n.operand, paths)
+	case *binaryNode:
+		collectExprPaths(n.left, paths)
+		collectExprPaths(n.right, paths)
+	}
+}
+
+// rewritePaths returns a copy of the expression with each JSONPath operand replaced by fn(operand).
+func (e *Expression) rewritePaths(fn func(path string) string) *Expression {
+	return &Expression{
+		Source: rewriteExpressionPaths(e.Source, fn),
+		root:   rewriteExprNode(e.root, fn),
+	}
+}
+
+func rewriteExprNode(node exprNode, fn func(path string) string) exprNode {
+	switch n := node.(type) {
+	case *pathNode:
+		return &pathNode{path: fn(n.path)}
+	case *negNode:
+		return &negNode{operand: rewriteExprNode(n.operand, fn)}
+	case *binaryNode:
+		return &binaryNode{op: n.op, left: rewriteExprNode(n.left, fn), right: rewriteExprNode(n.right, fn)}
+	}
+	return node
+}
+
+// rewriteExpressionPaths returns the expression s with each JSONPath operand replaced by fn(operand).
+// The rest of the source is preserved as is.
+func rewriteExpressionPaths(s string, fn func(path string) string) string {
+	var sb strings.Builder
+	start, depth := -1, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '{':
+			if depth == 0 {
+				start = i
+			}
+			depth++
+		case '}':
+			if depth == 0 {
+				break
+			}
+			depth--
+			if depth == 0 {
+				sb.WriteString("{" + fn(strings.TrimSpace(s[start+1:i])) + "}")
+				start = -1
+				continue
+			}
+		}
+		if start == -1 {
+			sb.WriteByte(s[i])
+		}
+	}
+	if start != -1 {
+		// unterminated: leave it to the parser to complain
+		sb.WriteString(s[start:])
+	}
+	return sb.String()
+}
+
+func (e *Expression) explain(result string, operands []string) string {
+	if len(operands) == 0 {
+		return fmt.Sprintf("%s = %s", e.Source, result)
+	}
+	return fmt.Sprintf("%s = %s with %s", e.Source, result, strings.Join(operands, ", "))
+}
+
+// compiledExpression returns the expression of the parameter, either compiled along with
+// its rule (see Rule.param) or the source of one, which is parsed on the spot.
+func compiledExpression(obj interface{}) (*Expression, error) {
+	if e, ok := obj.(*Expression); ok {
+		return e, nil
+	}
+	s, _ := obj.(string)
+	return NewExpression(s)
+}
+
+// evaluateExpression evaluates the parameter, see compiledExpression.
+func evaluateExpression(obj interface{}, vm, ref *k6tv1.VirtualMachine) (*ExpressionResult, error) {
+	e, err := compiledExpression(obj)
+	if err != nil {
+		return nil, err
+	}
+	return e.Evaluate(vm, ref)
+}
+
+// explainExpressions returns the explanations of the parameters which are expressions
+func explainExpressions(vm, ref *k6tv1.VirtualMachine, params ...interface{}) []string {
+	var ret []string
+	for _, param := range params {
+		if !isExpressionParam(param) {
+			continue
+		}
+		res, err := evaluateExpression(param, vm, ref)
+		if err != nil {
+			continue
+		}
+		ret = append(ret, res.Explanation)
+	}
+	return ret
+}
+
+func (r *ExpressionResult) AsQuantity() resource.Quantity {
+	format := resource.DecimalSI
+	if r.Binary {
+		format = resource.BinarySI
+	}
+	if r.Value.IsInt() && r.Value.Num().IsInt64() {
+		return *resource.NewQuantity(r.Value.Num().Int64(), format)
+	}
+	// quantities can't represent arbitrary rationals, so we settle for milli precision
+	milli := new(big.Rat).Mul(r.Value, big.NewRat(1000, 1))
+	f, _ := milli.Float64()
+	return *resource.NewMilliQuantity(int64(math.Round(f)), resource.DecimalSI)
+}
+
+func (r *ExpressionResult) String() string {
+	q := r.AsQuantity()
+	return q.String()
+}
+
+func quantityToRat(q resource.Quantity) *big.Rat {
+	dec := q.AsDec()
+	scale := int64(dec.Scale())
+	ret := new(big.Rat).SetInt(dec.UnscaledBig())
+	pow := new(big.Int).Exp(big.NewInt(10), big.NewInt(absInt64(scale)), nil)
+	if scale > 0 {
+		return ret.Quo(ret, new(big.Rat).SetInt(pow))
+	}
+	return ret.Mul(ret, new(big.Rat).SetInt(pow))
+}
+
+func absInt64(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+type literalNode struct {
+	value resource.Quantity
+}
+
+func (n *literalNode) eval(env *exprEnv) (*big.Rat, error) {
+	if n.value.Format == resource.BinarySI {
+		env.binary = true
+	}
+	return quantityToRat(n.value), nil
+}
+
+// exprPath returns the rule path of an operand: the operands without prefix are relative to the VM spec.template.
+func exprPath(path string) string {
+	if isJSONPath(path) {
+		return path
+	}
+	return JSONPathPrefix + path
+}
+
+type pathNode struct {
+	path string
+}
+
+func (n *pathNode) eval(env *exprEnv) (*big.Rat, error) {
+	present, err := findPresentValues(exprPath(n.path), env.vm, env.ref)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", n.path, err)
+	}
+	if len(present) == 0 {
+		env.missing = append(env.missing, n.path)
+	}
+	v, err := decodeQuantity(exprPath(n.path), env.vm, env.ref)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", n.path, err)
+	}
+	if v.Format == resource.BinarySI {
+		env.binary = true
+	}
+	env.operands = append(env.operands, fmt.Sprintf("%s=%s", n.path, v.String()))
+	return quantityToRat(v), nil
+}
+
+type negNode struct {
+	operand exprNode
+}
+
+func (n *negNode) eval(env *exprEnv) (*big.Rat, error) {
+	v, err := n.operand.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Rat).Neg(v), nil
+}
+
+type binaryNode struct {
+	op          byte
+	left, right exprNode
+}
+
+func (n *binaryNode) eval(env *exprEnv) (*big.Rat, error) {
+	l, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	r, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case '+':
+		return new(big.Rat).Add(l, r), nil
+	case '-':
+		return new(big.Rat).Sub(l, r), nil
+	case '*':
+		return new(big.Rat).Mul(l, r), nil
+	case '/':
+		if r.Sign() == 0 {
+			return nil, ErrDivisionByZero
+		}
+		return new(big.Rat).Quo(l, r), nil
+	}
+	return nil, fmt.Errorf("unknown operator %q", n.op)
+}
+
+// exprParser is a simple recursive descent parser. The grammar is
+//
+//	sum     := product (('+' | '-') product)*
+//	product := unary (('*' | '/') unary)*
+//	unary   := '-' unary | '(' sum ')' | operand
+type exprParser struct {
+	src string
+	pos int
+}
+
+func (p *exprParser) skipSpaces() {
+	for p.pos < len(p.src) && unicode.IsSpace(rune(p.src[p.pos])) {
+		p.pos++
+	}
+}
+
+func (p *exprParser) peek() byte {
+	p.skipSpaces()
+	if p.pos >= len(p.src) {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *exprParser) parseSum() (exprNode, error) {
+	left, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		if op != '+' && op != '-' {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseProduct() (exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		if op != '*' && op != '/' {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	switch c := p.peek(); {
+	case c == 0:
+		return nil, fmt.Errorf("unexpected end of expression")
+	case c == '-':
+		p.pos++
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &negNode{operand: operand}, nil
+	case c == '(':
+		p.pos++
+		node, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, fmt.Errorf("missing ')' at offset %d", p.pos)
+		}
+		p.pos++
+		return node, nil
+	case c == '{':
+		return p.parsePath()
+	case c == '.' || (c >= '0' && c <= '9'):
+		return p.parseLiteral()
+	default:
+		return nil, fmt.Errorf("unexpected %q at offset %d", c, p.pos)
+	}
+}
+
+func (p *exprParser) parsePath() (exprNode, error) {
+	start := p.pos
+	depth := 0
+	for ; p.pos < len(p.src); p.pos++ {
+		switch p.src[p.pos] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		}
+		if depth == 0 {
+			path := strings.TrimSpace(p.src[start+1 : p.pos])
+			p.pos++
+			if path == "" {
+				return nil, fmt.Errorf("empty JSONPath at offset %d", start)
+			}
+			return &pathNode{path: path}, nil
+		}
+	}
+	return nil, fmt.Errorf("unterminated JSONPath at offset %d", start)
+}
+
+func (p *exprParser) parseLiteral() (exprNode, error) {
+	start := p.pos
+	for p.pos < len(p.src) && (p.src[p.pos] == '.' || unicode.IsDigit(rune(p.src[p.pos]))) {
+		p.pos++
+	}
+	// unit suffix (e.g. Gi, m, k) or exponent (e.g. e3)
+	for p.pos < len(p.src) && (unicode.IsLetter(rune(p.src[p.pos])) || unicode.IsDigit(rune(p.src[p.pos]))) {
+		p.pos++
+	}
+	q, err := resource.ParseQuantity(p.src[start:p.pos])
+	if err != nil {
+		return nil, fmt.Errorf("bad value %q at offset %d: %v", p.src[start:p.pos], start, err)
+	}
+	return &literalNode{value: q}, nil
+}
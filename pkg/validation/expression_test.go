@@ -0,0 +1,229 @@
+package validation_test
+
+import (
+	"math/big"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	k8sv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	k6tv1 "kubevirt.io/client-go/api/v1"
+
+	k6tobjs "github.com/kubevirt/kubevirt-template-validator/pkg/kubevirtobjs"
+	"github.com/kubevirt/kubevirt-template-validator/pkg/validation"
+)
+
+var _ = Describe("Expression", func() {
+	var (
+		vmCirros *k6tv1.VirtualMachine
+		vmRef    *k6tv1.VirtualMachine
+	)
+
+	BeforeEach(func() {
+		vmCirros = NewVMCirros()
+		vmCirros.Spec.Template.Spec.Domain.CPU = &k6tv1.CPU{
+			Sockets: 2,
+			Cores:   4,
+			Threads: 8,
+		}
+		vmRef = k6tobjs.NewDefaultVirtualMachine()
+	})
+
+	Context("When parsing", func() {
+		It("Should detect malformed expressions", func() {
+			testStrings := []string{
+				"expr::(1 + 2",
+				"expr::1 +",
+				"expr::{.spec.domain.cpu.cores",
+				"expr::{}",
+				"expr::cores * 2",
+				"expr::1 2",
+				"jsonpath::.spec.domain.cpu.cores",
+			}
+			for _, s := range testStrings {
+				e, err := validation.NewExpression(s)
+				Expect(err).To(HaveOccurred(), s)
+				Expect(e).To(BeNil())
+			}
+		})
+	})
+
+	Context("When evaluating", func() {
+		It("Should respect precedence", func() {
+			e, err := validation.NewExpression("expr::2 * (3 + 4) - -6 / 3")
+			Expect(err).ToNot(HaveOccurred())
+
+			res, err := e.Evaluate(vmCirros, vmRef)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(res.Value.Cmp(big.NewRat(16, 1))).To(BeZero())
+		})
+
+		It("Should keep units of quantities", func() {
+			e, err := validation.NewExpression("expr::1Gi * 2")
+			Expect(err).ToNot(HaveOccurred())
+
+			res, err := e.Evaluate(vmCirros, vmRef)
+			Expect(err).ToNot(HaveOccurred())
+			q := res.AsQuantity()
+			Expect(q.String()).To(Equal("2Gi"))
+		})
+
+		It("Should explain the operands", func() {
+			e, err := validation.NewExpression("expr::{.spec.domain.cpu.sockets} * {.spec.domain.cpu.cores}")
+			Expect(err).ToNot(HaveOccurred())
+
+			res, err := e.Evaluate(vmCirros, vmRef)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(res.Explanation).To(Equal("{.spec.domain.cpu.sockets} * {.spec.domain.cpu.cores} = 8 with .spec.domain.cpu.sockets=2, .spec.domain.cpu.cores=4"))
+		})
+
+		It("Should detect division by zero", func() {
+			e, err := validation.NewExpression("expr::{.spec.domain.cpu.cores} / ({.spec.domain.cpu.sockets} - 2)")
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = e.Evaluate(vmCirros, vmRef)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring(validation.ErrDivisionByZero.Error()))
+		})
+	})
+
+	Context("In rules", func() {
+		It("Should limit the total number of vCPUs", func() {
+			r := validation.Rule{
+				Rule:    "integer",
+				Name:    "LimitVCPUs",
+				Path:    "expr::{.spec.domain.cpu.sockets} * {.spec.domain.cpu.cores} * {.spec.domain.cpu.threads}",
+				Message: "too many vCPUs",
+				Max:     64,
+			}
+			expectRuleApplicationSuccess(&r, vmCirros, vmRef)
+
+			vmCirros.Spec.Template.Spec.Domain.CPU.Sockets = 4
+			ra, err := r.Specialize(vmCirros, vmRef)
+			Expect(err).ToNot(HaveOccurred())
+			ok, err := ra.Apply(vmCirros, vmRef)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ok).To(BeFalse())
+			Expect(ra.String()).To(Equal("value 128 is higher than maximum [64] " +
+				"({.spec.domain.cpu.sockets} * {.spec.domain.cpu.cores} * {.spec.domain.cpu.threads} = 128 " +
+				"with .spec.domain.cpu.sockets=4, .spec.domain.cpu.cores=4, .spec.domain.cpu.threads=8)"))
+		})
+
+		It("Should compare against other fields", func() {
+			guest := resource.MustParse("2Gi")
+			vmCirros.Spec.Template.Spec.Domain.Memory = &k6tv1.Memory{Guest: &guest}
+			vmCirros.Spec.Template.Spec.Domain.Resources.Limits = k8sv1.ResourceList{
+				k8sv1.ResourceMemory: resource.MustParse("4Gi"),
+			}
+			r := validation.Rule{
+				Rule:    "quantity",
+				Name:    "GuestMemoryWithinLimits",
+				Path:    "jsonpath::.spec.domain.memory.guest",
+				Message: "guest memory exceeds the limits",
+				Max:     "expr::{.spec.domain.resources.limits.memory} - 1Gi",
+			}
+			expectRuleApplicationSuccess(&r, vmCirros, vmRef)
+
+			r.Max = "expr::{.spec.domain.resources.limits.memory} / 4"
+			expectRuleApplicationFailure(&r, vmCirros, vmRef)
+		})
+
+		It("Should check memory per vCPU", func() {
+			vmCirros.Spec.Template.Spec.Domain.Resources.Requests[k8sv1.ResourceMemory] = resource.MustParse("16Gi")
+			r := validation.Rule{
+				Rule:    "quantity",
+				Name:    "MemoryPerVCPU",
+				Path:    "expr::{.spec.domain.resources.requests.memory} / ({.spec.domain.cpu.sockets} * {.spec.domain.cpu.cores})",
+				Message: "not enough memory per vCPU",
+				Min:     "2Gi",
+			}
+			expectRuleApplicationSuccess(&r, vmCirros, vmRef)
+
+			r.Min = "4Gi"
+			ra, err := r.Specialize(vmCirros, vmRef)
+			Expect(err).ToNot(HaveOccurred())
+			ok, err := ra.Apply(vmCirros, vmRef)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ok).To(BeFalse())
+			Expect(ra.String()).To(HavePrefix("value 2Gi is lower than minimum [4Gi]"))
+			Expect(ra.String()).To(ContainSubstring(".spec.domain.resources.requests.memory=16Gi"))
+		})
+
+		It("Should compare the fractions exactly", func() {
+			r := validation.Rule{
+				Rule:    "integer",
+				Name:    "CoresPerThird",
+				Path:    "expr::{.spec.domain.cpu.cores} / 3",
+				Message: "too many cores",
+				Max:     1,
+			}
+			ra, err := r.Specialize(vmCirros, vmRef)
+			Expect(err).ToNot(HaveOccurred())
+			ok, err := ra.Apply(vmCirros, vmRef)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ok).To(BeFalse())
+			Expect(ra.String()).To(HavePrefix("value 1.333 is higher than maximum [1]"))
+
+			r.Max = "expr::{.spec.domain.cpu.threads} / 6"
+			expectRuleApplicationSuccess(&r, vmCirros, vmRef)
+		})
+
+		It("Should skip the rules dividing by a missing value", func() {
+			vmCirros.Spec.Template.Spec.Domain.CPU = nil
+			vmCirros.Spec.Template.Spec.Domain.Resources.Limits = k8sv1.ResourceList{
+				k8sv1.ResourceMemory: resource.MustParse("4Gi"),
+			}
+			rules := []validation.Rule{
+				{
+					Rule:    "integer",
+					Name:    "CoresPerSocket",
+					Path:    "expr::{.spec.domain.cpu.cores} / {.spec.domain.cpu.sockets}",
+					Message: "too many cores per socket",
+					Max:     4,
+				},
+				{
+					Rule:    "quantity",
+					Name:    "MemoryPerSocket",
+					Path:    "jsonpath::.spec.domain.resources.requests.memory",
+					Message: "too much memory per socket",
+					Max:     "expr::{.spec.domain.resources.limits.memory} / {.spec.domain.cpu.sockets}",
+				},
+			}
+			res := validation.NewEvaluator().Evaluate(rules, vmCirros)
+			Expect(res.Succeeded()).To(BeTrue())
+			Expect(res.Status).To(HaveLen(2))
+			Expect(res.Status[0].Skipped).To(BeTrue())
+			Expect(res.Status[0].SkipReason).To(Equal("no value set at .spec.domain.cpu.cores"))
+			Expect(res.Status[1].Skipped).To(BeTrue())
+			Expect(res.Status[1].SkipReason).To(Equal("no value set at .spec.domain.cpu.sockets"))
+		})
+
+		It("Should evaluate the expressions compiled along with the rules", func() {
+			rules, err := validation.ParseRules([]byte(`[{
+				"name": "LimitVCPUs",
+				"rule": "integer",
+				"path": "expr::{.spec.domain.cpu.sockets} * {.spec.domain.cpu.cores}",
+				"message": "too many vCPUs",
+				"max": "expr::{.spec.domain.cpu.threads} * 2",
+				"when": [{"path": "jsonpath::.spec.domain.cpu.sockets", "min": "expr::{.spec.domain.cpu.cores} / 4"}]
+			}]`))
+			Expect(err).ToNot(HaveOccurred())
+
+			ev := validation.NewEvaluator()
+			res := ev.Evaluate(rules, vmCirros)
+			Expect(res.Succeeded()).To(BeTrue())
+			Expect(res.Status[0].Message).To(ContainSubstring("{.spec.domain.cpu.threads} * 2 = 16 with .spec.domain.cpu.threads=8"))
+
+			// the same compiled rules, against another VM
+			vmCirros.Spec.Template.Spec.Domain.CPU.Threads = 2
+			res = ev.Evaluate(rules, vmCirros)
+			Expect(res.Succeeded()).To(BeFalse())
+			Expect(res.Status[0].Message).To(ContainSubstring("value 8 is higher than maximum [4]"))
+
+			vmCirros.Spec.Template.Spec.Domain.CPU.Cores = 12
+			res = ev.Evaluate(rules, vmCirros)
+			Expect(res.Status[0].Skipped).To(BeTrue())
+		})
+	})
+})
@@ -0,0 +1,271 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2019 Red Hat, Inc.
+ */
+
+package validation
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	k6tv1 "kubevirt.io/client-go/api/v1"
+)
+
+// forEach rules evaluate their nested rules on each element of the list found at their path.
+// The paths of the nested rules are relative to the element, e.g.
+//   {"rule": "forEach", "path": "jsonpath::.spec.domain.devices.disks", "rules": [{
+//     "rule": "enum", "path": "jsonpath::.cdrom.bus", "values": ["sata"], ...
+//   }]}
+// Before the evaluation, the nested paths are rewritten using the index of each element,
+// e.g. ".spec.domain.devices.disks[3].cdrom.bus", so the reports point at the exact field.
+// CEL expressions are not rewritten: they always see the whole VM.
+
+const (
+	ruleForEach string = "forEach"
+
+	// the elements beyond are scoped on each evaluation, see scopedRules
+	maxScopedElements int = 256
+)
+
+type forEachRule struct {
+	Ref       *Rule
+	OldVM     *k6tv1.VirtualMachine
+	Vars      *celVars
+	Count     int
+	Failed    []string // elements with unsatisfied nested rules
+	Reports   []Report
+	Warnings  []string
+	Satisfied bool
+}
+
+func NewForEachRule(r *Rule, oldVM *k6tv1.VirtualMachine, vars *celVars) (RuleApplier, error) {
+	if len(r.Rules) == 0 {
+		return nil, fmt.Errorf("%s rule without nested rules", r.Rule)
+	}
+	if !isJSONPath(r.Path) {
+		return nil, fmt.Errorf("%s rule requires a JSONPath, found %q", r.Rule, r.Path)
+	}
+	return &forEachRule{Ref: r, OldVM: oldVM, Vars: vars}, nil
+}
+
+func (fr *forEachRule) Apply(vm, ref *k6tv1.VirtualMachine) (bool, error) {
+	count, err := countElements(fr.Ref.Path, vm, ref)
+	if err != nil {
+		return false, err
+	}
+	fr.Count = count
+
+	for i := 0; i < count; i++ {
+		element := elementPath(fr.Ref.Path, i)
+		res := NewEvaluator().evaluate(fr.Ref.scoped.get(fr.Ref, i), vm, fr.OldVM, ref, fr.Vars)
+		for j := range res.Status {
+			rr := &res.Status[j]
+			if rr.Error != nil {
+				return false, fmt.Errorf("element %s: nested rule %s: %v", element, rr.Ref.Name, rr.Error)
+			}
+			rr.Element = element
+		}
+		if !res.Succeeded() {
+			fr.Failed = append(fr.Failed, element)
+		}
+		fr.Reports = append(fr.Reports, res.Status...)
+		fr.Warnings = append(fr.Warnings, res.Warnings...)
+	}
+
+	fr.Satisfied = len(fr.Failed) == 0
+	return fr.Satisfied, nil
+}
+
+func (fr *forEachRule) NestedReports() []Report {
+	return fr.Reports
+}
+
+func (fr *forEachRule) NestedWarnings() []string {
+	return fr.Warnings
+}
+
+func (fr *forEachRule) String() string {
+	path := TrimJSONPath(fr.Ref.Path)
+	if fr.Satisfied {
+		return fmt.Sprintf("All the %d elements of %s satisfy the rules", fr.Count, path)
+	}
+	var failures []string
+	for _, rr := range fr.Reports {
+		if !rr.Skipped && !rr.Satisfied && rr.Ref.GetSeverity() == SeverityError {
+			failures = append(failures, fmt.Sprintf("%s (%s)", rr.Ref.Name, rr.Message))
+		}
+	}
+	return fmt.Sprintf("Elements %s do not satisfy the rules: %s", strings.Join(fr.Failed, ", "), strings.Join(failures, "; "))
+}
+
+// countElements returns the length of the list found at path.
+// A missing list has no elements, unless the path is bogus.
+func countElements(path string, vm, ref *k6tv1.VirtualMachine) (int, error) {
+	p, err := NewPath(path)
+	if err != nil {
+		return 0, err
+	}
+	err = p.Find(vm)
+	if err == ErrInvalidJSONPath {
+		// missing optional subpath or bogus path?
+		if refErr := checkMissingPath(path, ref); refErr != nil {
+			return 0, refErr
+		}
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if p.Len() != 1 {
+		return 0, fmt.Errorf("%s must point to exactly one list, found %d values", TrimJSONPath(path), p.Len())
+	}
+	val := p.results[0][0]
+	for val.Kind() == reflect.Ptr || val.Kind() == reflect.Interface {
+		if val.IsNil() {
+			return 0, nil
+		}
+		val = val.Elem()
+	}
+	if val.Kind() != reflect.Slice && val.Kind() != reflect.Array {
+		return 0, fmt.Errorf("%s is not a list", TrimJSONPath(path))
+	}
+	return val.Len(), nil
+}
+
+// elementPath returns the path (without prefix) of the element of the list at path.
+func elementPath(path string, index int) string {
+	return fmt.Sprintf("%s[%d]", TrimJSONPath(path), index)
+}
+
+// scopedRules caches the nested rules of a forEach rule scoped to each element, by index:
+// the rules are evaluated over and over on the same elements, so their scoped paths are
+// rewritten once, and stay the same strings for the cache of the parsed paths.
+type scopedRules struct {
+	lock    sync.Mutex
+	byIndex [][]Rule
+}
+
+// get returns the nested rules of r scoped to its index-th element.
+// Without cache, e.g. for the rules which were never compiled, they are scoped each time.
+func (sr *scopedRules) get(r *Rule, index int) []Rule {
+	element := elementPath(r.Path, index)
+	if sr == nil || index >= maxScopedElements {
+		return scopeRules(r.Rules, element)
+	}
+	sr.lock.Lock()
+	defer sr.lock.Unlock()
+	for len(sr.byIndex) <= index {
+		sr.byIndex = append(sr.byIndex, nil)
+	}
+	if sr.byIndex[index] == nil {
+		sr.byIndex[index] = scopeRules(r.Rules, element)
+	}
+	return sr.byIndex[index]
+}
+
+// scopeRules returns a copy of the rules, with all the paths made relative to element.
+func scopeRules(rules []Rule, element string) []Rule {
+	ret := make([]Rule, len(rules))
+	for i := range rules {
+		ret[i] = scopeRule(rules[i], element)
+	}
+	return ret
+}
+
+func scopeRule(r Rule, element string) Rule {
+	r.element = element
+	r.Path = scopePath(r.Path, element)
+	r.Valid = scopePath(r.Valid, element)
+	r.Target = scopePath(r.Target, element)
+	r.Min = scopeParam(r.Min, element)
+	r.Max = scopeParam(r.Max, element)
+	r.MinLength = scopeParam(r.MinLength, element)
+	r.MaxLength = scopeParam(r.MaxLength, element)
+	r.Value = scopeParam(r.Value, element)
+	r.Default = scopeParam(r.Default, element)
+	if len(r.Values) > 0 {
+		values := make([]string, len(r.Values))
+		for i, v := range r.Values {
+			values[i] = scopePath(v, element)
+		}
+		r.Values = values
+	}
+	r.expressions = r.expressions.scope(element)
+	if r.scoped != nil {
+		// a nested forEach rule: its elements are not the same from one element to another
+		r.scoped = &scopedRules{}
+	}
+	if len(r.When) > 0 {
+		when := make([]Condition, len(r.When))
+		for i, c := range r.When {
+			c.Path = scopePath(c.Path, element)
+			c.Min = scopeParam(c.Min, element)
+			c.Max = scopeParam(c.Max, element)
+			when[i] = c
+		}
+		r.When = when
+	}
+	// the rules nested in a forEach rule are relative to its own elements, they are scoped later
+	if len(r.Rules) > 0 && r.Rule != ruleForEach {
+		r.Rules = scopeRules(r.Rules, element)
+	}
+	return r
+}
+
+func scopeParam(obj interface{}, element string) interface{} {
+	if s, ok := obj.(string); ok {
+		return scopePath(s, element)
+	}
+	return obj
+}
+
+// scopePath rewrites JSONPaths and the JSONPaths within expressions. Anything else is returned unchanged,
+// like the paths rooted elsewhere than the VM spec.template, which are never relative to the element.
+func scopePath(s, element string) string {
+	switch {
+	case isJSONPath(s):
+		return scopeJSONPath(s, element)
+	case isExpression(s):
+		return rewriteExpressionPaths(s, func(path string) string {
+			return scopeExprPath(path, element)
+		})
+	}
+	return s
+}
+
+// scopeExprPath rewrites a JSONPath operand of an expression, keeping it without prefix if it had none.
+func scopeExprPath(path, element string) string {
+	scoped := scopeJSONPath(exprPath(path), element)
+	if isJSONPath(path) {
+		return scoped
+	}
+	return strings.TrimPrefix(scoped, JSONPathPrefix)
+}
+
+func scopeJSONPath(path, element string) string {
+	root, expr := splitPath(path)
+	if root.prefix != JSONPathPrefix {
+		return path
+	}
+	if isJSONPath(element) {
+		// the element of a list rooted elsewhere, e.g. "vm::.spec.dataVolumeTemplates[0]"
+		return element + expr
+	}
+	return JSONPathPrefix + element + expr
+}
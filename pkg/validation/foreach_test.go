@@ -0,0 +1,319 @@
+package validation_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	k6tv1 "kubevirt.io/client-go/api/v1"
+
+	"github.com/kubevirt/kubevirt-template-validator/pkg/validation"
+)
+
+var _ = Describe("ForEach", func() {
+	var (
+		vmCirros  *k6tv1.VirtualMachine
+		sataCdrom validation.Rule
+	)
+
+	BeforeEach(func() {
+		vmCirros = NewVMCirros()
+		sataCdrom = validation.Rule{
+			Rule:    "forEach",
+			Name:    "disks",
+			Path:    "jsonpath::.spec.domain.devices.disks",
+			Message: "invalid disks",
+			Rules: []validation.Rule{{
+				Rule:    "enum",
+				Name:    "sata-cdrom",
+				Path:    "jsonpath::.cdrom.bus",
+				When:    []validation.Condition{{Path: "jsonpath::.cdrom"}},
+				Message: "cdroms must use sata",
+				Values:  []string{"sata"},
+			}},
+		}
+	})
+
+	addCdrom := func(bus string) {
+		disks := &vmCirros.Spec.Template.Spec.Domain.Devices.Disks
+		*disks = append(*disks, k6tv1.Disk{
+			Name: "cdrom",
+			DiskDevice: k6tv1.DiskDevice{
+				CDRom: &k6tv1.CDRomTarget{Bus: bus},
+			},
+		})
+	}
+
+	It("Should be satisfied when all the elements satisfy the nested rules", func() {
+		addCdrom("sata")
+		ev := validation.NewEvaluator()
+		res := ev.Evaluate([]validation.Rule{sataCdrom}, vmCirros)
+		Expect(res.Succeeded()).To(BeTrue())
+		Expect(res.Status[0].Nested).To(HaveLen(3))
+		Expect(res.Status[0].Nested[2].Element).To(Equal(".spec.domain.devices.disks[2]"))
+	})
+
+	It("Should point at the failing element", func() {
+		addCdrom("ide")
+		ev := validation.NewEvaluator()
+		res := ev.Evaluate([]validation.Rule{sataCdrom}, vmCirros)
+		Expect(res.Succeeded()).To(BeFalse())
+		Expect(res.Status[0].Message).To(ContainSubstring("disks[2]"))
+
+		causes := res.ToStatusCauses()
+		Expect(causes).To(HaveLen(1))
+		Expect(causes[0].Field).To(Equal("spec.template.spec.domain.devices.disks[2].cdrom.bus"))
+		Expect(causes[0].Message).To(HavePrefix("cdroms must use sata: "))
+	})
+
+	It("Should apply the nested rules only to the elements having their valid path", func() {
+		addCdrom("ide")
+		sataCdrom.Rules[0].When = nil
+		sataCdrom.Rules[0].Valid = "jsonpath::.cdrom"
+		ev := validation.NewEvaluator()
+		res := ev.Evaluate([]validation.Rule{sataCdrom}, vmCirros)
+		Expect(res.Succeeded()).To(BeFalse())
+		Expect(res.Status[0].Nested).To(HaveLen(3))
+		Expect(res.Status[0].Nested[0].Skipped).To(BeTrue())
+		Expect(res.Status[0].Nested[1].Skipped).To(BeTrue())
+		Expect(res.Status[0].Nested[2].Skipped).To(BeFalse())
+
+		causes := res.ToStatusCauses()
+		Expect(causes).To(HaveLen(1))
+		Expect(causes[0].Field).To(Equal("spec.template.spec.domain.devices.disks[2].cdrom.bus"))
+	})
+
+	It("Should rewrite the paths within the expressions", func() {
+		vmCirros.Spec.Template.Spec.Domain.Devices.Interfaces = []k6tv1.Interface{
+			{Name: "default"},
+			{Name: "http", Ports: []k6tv1.Port{{Port: 80}}},
+		}
+		r := validation.Rule{
+			Rule:    "forEach",
+			Name:    "interfaces",
+			Path:    "jsonpath::.spec.domain.devices.interfaces",
+			Message: "invalid interfaces",
+			Rules: []validation.Rule{{
+				Rule:    "integer",
+				Name:    "first-port",
+				Path:    "jsonpath::.ports[0].port",
+				When:    []validation.Condition{{Path: "jsonpath::.ports"}},
+				Message: "port out of range",
+				Max:     "expr::{.ports[0].port} - 1",
+			}},
+		}
+		ev := validation.NewEvaluator()
+		res := ev.Evaluate([]validation.Rule{r}, vmCirros)
+		Expect(res.Succeeded()).To(BeFalse())
+		causes := res.ToStatusCauses()
+		Expect(causes).To(HaveLen(1))
+		Expect(causes[0].Field).To(Equal("spec.template.spec.domain.devices.interfaces[1].ports[0].port"))
+		Expect(causes[0].Message).To(ContainSubstring("{.spec.domain.devices.interfaces[1].ports[0].port}"))
+	})
+
+	It("Should rewrite the paths within the compiled expressions", func() {
+		vmCirros.Spec.Template.Spec.Domain.Devices.Interfaces = []k6tv1.Interface{
+			{Name: "http", Ports: []k6tv1.Port{{Port: 80}, {Port: 443}}},
+			{Name: "dns", Ports: []k6tv1.Port{{Port: 53}, {Port: 53}}},
+		}
+		rules, err := validation.ParseRules([]byte(`[{
+			"rule": "forEach",
+			"name": "interfaces",
+			"path": "jsonpath::.spec.domain.devices.interfaces",
+			"message": "invalid interfaces",
+			"rules": [{
+				"rule": "integer",
+				"name": "ports-order",
+				"path": "jsonpath::.ports[1].port",
+				"message": "ports must be sorted",
+				"min": "expr::{.ports[0].port} + 1"
+			}]
+		}]`))
+		Expect(err).ToNot(HaveOccurred())
+
+		ev := validation.NewEvaluator()
+		res := ev.Evaluate(rules, vmCirros)
+		Expect(res.Succeeded()).To(BeFalse())
+		causes := res.ToStatusCauses()
+		Expect(causes).To(HaveLen(1))
+		Expect(causes[0].Field).To(Equal("spec.template.spec.domain.devices.interfaces[1].ports[1].port"))
+		Expect(causes[0].Message).To(ContainSubstring("{.spec.domain.devices.interfaces[1].ports[0].port} + 1 = 54"))
+	})
+
+	It("Should rewrite the paths of the values and of the defaults", func() {
+		addCdrom("sata")
+		rules, err := validation.ParseRules([]byte(`[{
+			"rule": "forEach",
+			"name": "disks",
+			"path": "jsonpath::.spec.domain.devices.disks",
+			"message": "invalid disks",
+			"rules": [{
+				"rule": "enum",
+				"name": "same-name",
+				"path": "jsonpath::.name",
+				"message": "the names must not change",
+				"values": ["jsonpath::.name"]
+			}, {
+				"rule": "enum",
+				"name": "cdrom-bus",
+				"path": "jsonpath::.cdrom.bus",
+				"message": "the disks must use virtio, and the cdroms sata",
+				"values": ["virtio", "sata"],
+				"onMissing": "default",
+				"default": "jsonpath::.disk.bus"
+			}]
+		}]`))
+		Expect(err).ToNot(HaveOccurred())
+
+		ev := validation.NewEvaluator()
+		res := ev.Evaluate(rules, vmCirros)
+		Expect(res.Succeeded()).To(BeTrue())
+		Expect(res.Status[0].Nested).To(HaveLen(6))
+		for _, rr := range res.Status[0].Nested {
+			Expect(rr.Error).ToNot(HaveOccurred())
+			Expect(rr.Satisfied).To(BeTrue())
+		}
+
+		vmCirros.Spec.Template.Spec.Domain.Devices.Disks[1].Disk.Bus = "scsi"
+		res = ev.Evaluate(rules, vmCirros)
+		Expect(res.Succeeded()).To(BeFalse())
+		causes := res.ToStatusCauses()
+		Expect(causes).To(HaveLen(1))
+		Expect(causes[0].Field).To(Equal("spec.template.spec.domain.devices.disks[1].cdrom.bus"))
+	})
+
+	It("Should reuse the rules scoped to each element", func() {
+		rules, err := validation.ParseRules([]byte(`[{
+			"rule": "forEach",
+			"name": "disks",
+			"path": "jsonpath::.spec.domain.devices.disks",
+			"message": "invalid disks",
+			"rules": [{
+				"rule": "string",
+				"name": "short-name",
+				"path": "jsonpath::.name",
+				"message": "the names must be short",
+				"maxLength": 13
+			}]
+		}]`))
+		Expect(err).ToNot(HaveOccurred())
+
+		ev := validation.NewEvaluator()
+		res := ev.Evaluate(rules, vmCirros)
+		Expect(res.Succeeded()).To(BeTrue())
+		first := res.Status[0].Nested
+
+		addCdrom("sata")
+		vmCirros.Spec.Template.Spec.Domain.Devices.Disks[2].Name = "a-very-long-name"
+		res = ev.Evaluate(rules, vmCirros)
+		Expect(res.Succeeded()).To(BeFalse())
+		nested := res.Status[0].Nested
+		Expect(nested).To(HaveLen(3))
+		Expect(nested[0].Ref).To(BeIdenticalTo(first[0].Ref))
+		Expect(nested[1].Ref).To(BeIdenticalTo(first[1].Ref))
+		Expect(nested[2].Ref.Path).To(Equal("jsonpath::.spec.domain.devices.disks[2].name"))
+		Expect(nested[2].Satisfied).To(BeFalse())
+	})
+
+	It("Should scope the nested forEach rules to each element", func() {
+		vmCirros.Spec.Template.Spec.Domain.Devices.Interfaces = []k6tv1.Interface{
+			{Name: "http", Ports: []k6tv1.Port{{Port: 80}}},
+			{Name: "dns", Ports: []k6tv1.Port{{Port: 53}, {Port: 0}}},
+		}
+		rules, err := validation.ParseRules([]byte(`[{
+			"rule": "forEach",
+			"name": "interfaces",
+			"path": "jsonpath::.spec.domain.devices.interfaces",
+			"message": "invalid interfaces",
+			"rules": [{
+				"rule": "forEach",
+				"name": "ports",
+				"path": "jsonpath::.ports",
+				"message": "invalid ports",
+				"rules": [{
+					"rule": "integer",
+					"name": "port-set",
+					"path": "jsonpath::.port",
+					"message": "the ports must be set",
+					"min": 1
+				}]
+			}]
+		}]`))
+		Expect(err).ToNot(HaveOccurred())
+
+		ev := validation.NewEvaluator()
+		for i := 0; i < 2; i++ {
+			res := ev.Evaluate(rules, vmCirros)
+			Expect(res.Succeeded()).To(BeFalse())
+			interfaces := res.Status[0].Nested
+			Expect(interfaces).To(HaveLen(2))
+			Expect(interfaces[0].Satisfied).To(BeTrue())
+			Expect(interfaces[0].Nested).To(HaveLen(1))
+			Expect(interfaces[0].Nested[0].Ref.Path).To(Equal("jsonpath::.spec.domain.devices.interfaces[0].ports[0].port"))
+			Expect(interfaces[1].Satisfied).To(BeFalse())
+			Expect(interfaces[1].Nested).To(HaveLen(2))
+			Expect(interfaces[1].Nested[1].Ref.Path).To(Equal("jsonpath::.spec.domain.devices.interfaces[1].ports[1].port"))
+			Expect(interfaces[1].Nested[1].Satisfied).To(BeFalse())
+		}
+	})
+
+	It("Should report the warnings of the nested rules", func() {
+		addCdrom("ide")
+		sataCdrom.Rules[0].Severity = validation.SeverityWarning
+		ev := validation.NewEvaluator()
+		res := ev.Evaluate([]validation.Rule{sataCdrom}, vmCirros)
+		Expect(res.Succeeded()).To(BeTrue())
+		Expect(res.Warnings).To(HaveLen(1))
+		Expect(res.ToStatusCauses()).To(BeEmpty())
+	})
+
+	It("Should be satisfied by missing lists", func() {
+		sataCdrom.Path = "jsonpath::.spec.domain.devices.interfaces"
+		ev := validation.NewEvaluator()
+		res := ev.Evaluate([]validation.Rule{sataCdrom}, vmCirros)
+		Expect(res.Succeeded()).To(BeTrue())
+		Expect(res.Status[0].Nested).To(BeEmpty())
+	})
+
+	It("Should fail with bogus paths", func() {
+		sataCdrom.Path = "jsonpath::.spec.domain.devices.floppies"
+		ev := validation.NewEvaluator()
+		res := ev.Evaluate([]validation.Rule{sataCdrom}, vmCirros)
+		Expect(res.Succeeded()).To(BeFalse())
+		Expect(res.Status[0].Error).To(HaveOccurred())
+	})
+
+	It("Should fail with paths not pointing to lists", func() {
+		sataCdrom.Path = "jsonpath::.spec.domain.machine"
+		ev := validation.NewEvaluator()
+		res := ev.Evaluate([]validation.Rule{sataCdrom}, vmCirros)
+		Expect(res.Succeeded()).To(BeFalse())
+		Expect(res.Status[0].Error).To(HaveOccurred())
+	})
+
+	It("Should fail without nested rules", func() {
+		sataCdrom.Rules = nil
+		ev := validation.NewEvaluator()
+		res := ev.Evaluate([]validation.Rule{sataCdrom}, vmCirros)
+		Expect(res.Succeeded()).To(BeFalse())
+		Expect(res.Status[0].Error).To(HaveOccurred())
+	})
+
+	It("Should lint the nested paths relative to the elements", func() {
+		Expect(validation.LintRules([]validation.Rule{sataCdrom})).To(BeEmpty())
+
+		sataCdrom.Rules[0].Path = "jsonpath::.cdrom.buss"
+		issues := validation.LintRules([]validation.Rule{sataCdrom})
+		Expect(issues).To(HaveLen(1))
+		Expect(issues[0].Location).To(Equal("rules[0].rules[0]"))
+		Expect(issues[0].Key).To(Equal("path"))
+	})
+
+	It("Should lint paths not pointing to lists", func() {
+		sataCdrom.Path = "jsonpath::.spec.domain.machine"
+		sataCdrom.Rules = nil
+		issues := validation.LintRules([]validation.Rule{sataCdrom})
+		Expect(issues).To(HaveLen(2))
+		Expect(issues[0].Key).To(Equal("path"))
+		Expect(issues[1].Key).To(Equal("rules"))
+	})
+})
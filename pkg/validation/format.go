@@ -0,0 +1,183 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2019 Red Hat, Inc.
+ */
+
+package validation
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	k8svalidation "k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	k6tv1 "kubevirt.io/client-go/api/v1"
+)
+
+// format rules check that all the values found at their path are well formed, using a
+// catalogue of validators, so the templates don't need to carry their own regexes, e.g.
+//   {"rule": "format", "path": "jsonpath::.spec.domain.devices.interfaces[*].macAddress", "format": "mac"}
+// Like for the unique rules, the values which are not set are not checked.
+
+const (
+	ruleFormat string = "format"
+)
+
+var (
+	pciAddressRegex = regexp.MustCompile(`^[0-9a-fA-F]{4}:[0-9a-fA-F]{2}:[0-9a-fA-F]{2}\.[0-7]$`)
+	uuidRegex       = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	// see https://semver.org/#is-there-a-suggested-regular-expression-regex-to-check-a-semver-string
+	semverRegex = regexp.MustCompile(`^(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)` +
+		`(?:-((?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*)(?:\.(?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*))*))?` +
+		`(?:\+([0-9a-zA-Z-]+(?:\.[0-9a-zA-Z-]+)*))?$`)
+)
+
+// formatValidators return the reasons why the value is not well formed, if any.
+var formatValidators = map[string]func(string) []string{
+	"mac": func(s string) []string {
+		if hw, err := net.ParseMAC(s); err != nil || len(hw) != 6 {
+			return []string{"must be a valid MAC-48 address (e.g. 02:00:00:00:00:01)"}
+		}
+		return nil
+	},
+	"ipv4": func(s string) []string {
+		return errorDetails(k8svalidation.IsValidIPv4Address(nil, s))
+	},
+	"ipv6": func(s string) []string {
+		return errorDetails(k8svalidation.IsValidIPv6Address(nil, s))
+	},
+	"cidr": func(s string) []string {
+		if _, _, err := net.ParseCIDR(s); err != nil {
+			return []string{"must be a valid CIDR (e.g. 10.0.0.0/8 or fd00::/64)"}
+		}
+		return nil
+	},
+	"dns1123-label":     k8svalidation.IsDNS1123Label,
+	"dns1123-subdomain": k8svalidation.IsDNS1123Subdomain,
+	"pci-address": func(s string) []string {
+		if !pciAddressRegex.MatchString(s) {
+			return []string{"must be a valid PCI address (e.g. 0000:81:01.0)"}
+		}
+		return nil
+	},
+	"uuid": func(s string) []string {
+		if !uuidRegex.MatchString(s) {
+			return []string{"must be a valid UUID (e.g. 0f5c5eea-8b9a-4c8b-9c5c-1d2e3f4a5b6c)"}
+		}
+		return nil
+	},
+	"quantity": func(s string) []string {
+		if _, err := resource.ParseQuantity(s); err != nil {
+			return []string{"must be a valid quantity (e.g. 128Mi or 1.5)"}
+		}
+		return nil
+	},
+	"semver": func(s string) []string {
+		if !semverRegex.MatchString(s) {
+			return []string{"must be a valid semantic version (e.g. 1.2.3-rc.1)"}
+		}
+		return nil
+	},
+}
+
+func isValidFormat(f string) bool {
+	_, ok := formatValidators[f]
+	return ok
+}
+
+// Formats returns the names of the supported formats.
+func Formats() []string {
+	ret := make([]string, 0, len(formatValidators))
+	for f := range formatValidators {
+		ret = append(ret, f)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+type formatRule struct {
+	Ref        *Rule
+	Quantifier quantifier
+	Current    []string
+	Invalid    []string // the reasons why each malformed value is malformed
+	Matched    int
+	Satisfied  bool
+}
+
+func NewFormatRule(r *Rule) (RuleApplier, error) {
+	if !isValidFormat(r.Format) {
+		return nil, fmt.Errorf("unsupported format %q", r.Format)
+	}
+	q, err := r.getQuantifier()
+	if err != nil {
+		return nil, err
+	}
+	return &formatRule{Ref: r, Quantifier: q}, nil
+}
+
+func (fr *formatRule) Apply(vm, ref *k6tv1.VirtualMachine) (bool, error) {
+	values, err := findPresentValues(fr.Ref.Path, vm, ref)
+	if err != nil {
+		return false, err
+	}
+
+	validate := formatValidators[fr.Ref.Format]
+	fr.Current = make([]string, 0, len(values))
+	fr.Invalid = nil
+	fr.Matched = 0
+	for _, obj := range values {
+		s, ok := obj.(string)
+		if !ok {
+			return false, fmt.Errorf("mismatching type: %T, not string", obj)
+		}
+		if s == "" {
+			// an optional string field omitted from the VM: there is no format to check
+			continue
+		}
+		fr.Current = append(fr.Current, s)
+		if errs := validate(s); len(errs) > 0 {
+			fr.Invalid = append(fr.Invalid, fmt.Sprintf("%q %s", s, strings.Join(errs, ", ")))
+		} else {
+			fr.Matched++
+		}
+	}
+
+	fr.Satisfied = fr.Quantifier.holds(fr.Matched, len(fr.Current))
+	return fr.Satisfied, nil
+}
+
+func (fr *formatRule) String() string {
+	if !fr.Quantifier.isAll() {
+		return fr.Quantifier.explain(fr.Matched, strings.Join(fr.Current, ", "), fmt.Sprintf("are valid %s", fr.Ref.Format))
+	}
+	if fr.Satisfied {
+		return fmt.Sprintf("All [%s] are valid %s", strings.Join(fr.Current, ", "), fr.Ref.Format)
+	}
+	return fmt.Sprintf("Invalid %s: %s", fr.Ref.Format, strings.Join(fr.Invalid, "; "))
+}
+
+func errorDetails(errs field.ErrorList) []string {
+	var ret []string
+	for _, err := range errs {
+		ret = append(ret, err.Detail)
+	}
+	return ret
+}
@@ -0,0 +1,128 @@
+package validation_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	k6tv1 "kubevirt.io/client-go/api/v1"
+
+	k6tobjs "github.com/kubevirt/kubevirt-template-validator/pkg/kubevirtobjs"
+	"github.com/kubevirt/kubevirt-template-validator/pkg/validation"
+)
+
+var _ = Describe("Format", func() {
+	var (
+		vmCirros *k6tv1.VirtualMachine
+		vmRef    *k6tv1.VirtualMachine
+	)
+
+	BeforeEach(func() {
+		vmCirros = NewVMCirros()
+		vmRef = k6tobjs.NewDefaultVirtualMachine()
+	})
+
+	// the values are checked as VM labels, which can hold any string
+	checkFormat := func(format, value string) bool {
+		vmCirros.Spec.Template.ObjectMeta.Labels["value"] = value
+		r := validation.Rule{
+			Rule:    "format",
+			Name:    "format-" + format,
+			Path:    "jsonpath::.metadata.labels.value",
+			Message: "malformed value",
+			Format:  format,
+		}
+		ra, err := r.Specialize(vmCirros, vmRef)
+		Expect(err).ToNot(HaveOccurred())
+		ok, err := ra.Apply(vmCirros, vmRef)
+		Expect(err).ToNot(HaveOccurred())
+		return ok
+	}
+
+	It("Should validate all the formats", func() {
+		samples := map[string]struct {
+			valid   []string
+			invalid []string
+		}{
+			"mac":               {[]string{"02:00:00:00:00:01", "02-00-00-AB-CD-EF"}, []string{"02:00:00:00:00", "02:00:00:00:00:00:00:01", "zz:00:00:00:00:01"}},
+			"ipv4":              {[]string{"10.0.0.1"}, []string{"10.0.0.256", "fd00::1"}},
+			"ipv6":              {[]string{"fd00::1", "2001:db8::ffff"}, []string{"10.0.0.1", "fd00:::1"}},
+			"cidr":              {[]string{"10.0.0.0/8", "fd00::/64"}, []string{"10.0.0.0", "10.0.0.0/33"}},
+			"dns1123-label":     {[]string{"vm-1"}, []string{"VM-1", "vm.1", "-vm"}},
+			"dns1123-subdomain": {[]string{"vm-1.example.com"}, []string{"vm_1.example.com", "Example.com"}},
+			"pci-address":       {[]string{"0000:81:01.0", "0000:00:1f.7"}, []string{"81:01.0", "0000:81:01.8", "0000:81:1.0"}},
+			"uuid":              {[]string{"0f5c5eea-8b9a-4c8b-9c5c-1d2e3f4a5b6c"}, []string{"0f5c5eea8b9a4c8b9c5c1d2e3f4a5b6c", "{0f5c5eea-8b9a-4c8b-9c5c-1d2e3f4a5b6c}"}},
+			"quantity":          {[]string{"128Mi", "1.5", "250m"}, []string{"128MB", "1,5"}},
+			"semver":            {[]string{"1.2.3", "1.2.3-rc.1+build.5"}, []string{"v1.2.3", "1.2", "01.2.3"}},
+		}
+		Expect(len(samples)).To(Equal(len(validation.Formats())))
+
+		for format, sample := range samples {
+			for _, value := range sample.valid {
+				Expect(checkFormat(format, value)).To(BeTrue(), "%s should be a valid %s", value, format)
+			}
+			for _, value := range sample.invalid {
+				Expect(checkFormat(format, value)).To(BeFalse(), "%s should not be a valid %s", value, format)
+			}
+		}
+	})
+
+	It("Should report every malformed value", func() {
+		vmCirros.Spec.Template.Spec.Domain.Devices.Interfaces = []k6tv1.Interface{
+			{Name: "default", MacAddress: "02:00:00:00:00:01"},
+			{Name: "secondary", MacAddress: "02:00:00:00:00"},
+			{Name: "third"},
+			{Name: "fourth", MacAddress: "02:00:00:00:00:0g"},
+		}
+		r := validation.Rule{
+			Rule:    "format",
+			Name:    "mac-addresses",
+			Path:    "jsonpath::.spec.domain.devices.interfaces[*].macAddress",
+			Message: "malformed MAC address",
+			Format:  "mac",
+		}
+		ra, err := r.Specialize(vmCirros, vmRef)
+		Expect(err).ToNot(HaveOccurred())
+		ok, err := ra.Apply(vmCirros, vmRef)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ok).To(BeFalse())
+		Expect(ra.String()).To(Equal(`Invalid mac: "02:00:00:00:00" must be a valid MAC-48 address (e.g. 02:00:00:00:00:01); ` +
+			`"02:00:00:00:00:0g" must be a valid MAC-48 address (e.g. 02:00:00:00:00:01)`))
+	})
+
+	It("Should reject unknown formats", func() {
+		r := validation.Rule{
+			Rule:    "format",
+			Name:    "format-ip",
+			Path:    "jsonpath::.spec.domain.devices.interfaces[*].macAddress",
+			Message: "malformed value",
+			Format:  "ip",
+		}
+		_, err := r.Specialize(vmCirros, vmRef)
+		Expect(err).To(HaveOccurred())
+
+		issues := validation.LintRules([]validation.Rule{r})
+		Expect(issues).To(HaveLen(1))
+		Expect(issues[0].Key).To(Equal("format"))
+	})
+
+	It("Should be published in the JSON Schema", func() {
+		data, err := ioutil.ReadFile("../../api/validations.schema.json")
+		Expect(err).ToNot(HaveOccurred())
+		var schema struct {
+			Definitions map[string]struct {
+				Properties map[string]struct {
+					Enum []string `json:"enum"`
+				} `json:"properties"`
+			} `json:"definitions"`
+		}
+		Expect(json.Unmarshal(data, &schema)).To(Succeed())
+
+		formats := schema.Definitions["rule"].Properties["format"].Enum
+		sort.Strings(formats)
+		Expect(formats).To(Equal(validation.Formats()))
+	})
+})
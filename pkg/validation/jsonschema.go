@@ -0,0 +1,178 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2019 Red Hat, Inc.
+ */
+
+package validation
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+
+	k6tv1 "kubevirt.io/client-go/api/v1"
+)
+
+// schema rules check the objects found at their path against a JSON Schema fragment,
+// for the constraints which are about the shape of an object rather than about a value, e.g.
+//   {"rule": "schema", "path": "jsonpath::.spec.domain.cpu",
+//    "schema": {"properties": {"cores": {"maximum": 4}}, "additionalProperties": false}}
+// The objects are checked as they are serialized in the VM, so the schema uses the JSON names.
+// Each violation is reported on the field at fault.
+
+const (
+	ruleSchema string = "schema"
+)
+
+// schemaRootField is the field the gojsonschema library reports for the violations of the whole object.
+const schemaRootField = "(root)"
+
+// Violation is a failure of a rule on a specific field, more precise than the path of the rule.
+type Violation struct {
+	Field       string
+	Message     string
+	Description string // the message of the rule rendered for this field, if any
+}
+
+// violationReporter is implemented by the RuleAppliers which know the fields at fault,
+// to let the Evaluator report them instead of the path of the rule.
+type violationReporter interface {
+	Violations() []Violation
+}
+
+// compileSchema compiles the schema fragment once, when the rule is parsed.
+// Only the local references ("#/definitions/...") are allowed: fetching documents
+// while a VM is being admitted is neither reliable nor safe.
+func compileSchema(schema interface{}) (*gojsonschema.Schema, error) {
+	if schema == nil {
+		return nil, ErrMissingRequiredKey
+	}
+	if err := checkSchemaRefs(schema); err != nil {
+		return nil, err
+	}
+	return gojsonschema.NewSchema(gojsonschema.NewGoLoader(schema))
+}
+
+func checkSchemaRefs(node interface{}) error {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		for key, val := range n {
+			if ref, ok := val.(string); ok && key == "$ref" && !strings.HasPrefix(ref, "#") {
+				return fmt.Errorf("unsupported schema reference %q, only local references are allowed", ref)
+			}
+			if err := checkSchemaRefs(val); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, val := range n {
+			if err := checkSchemaRefs(val); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+type schemaRule struct {
+	Ref       *Rule
+	Schema    *gojsonschema.Schema
+	Checked   int
+	Violated  []Violation
+	Satisfied bool
+}
+
+func NewSchemaRule(r *Rule) (RuleApplier, error) {
+	if r.compileErr != nil {
+		return nil, r.compileErr
+	}
+	if !isJSONPath(r.Path) {
+		return nil, fmt.Errorf("%s rule requires a JSONPath path, found %q", r.Rule, r.Path)
+	}
+	return &schemaRule{Ref: r, Schema: r.jsonSchema}, nil
+}
+
+func (sr *schemaRule) Apply(vm, ref *k6tv1.VirtualMachine) (bool, error) {
+	values, err := findPresentValues(sr.Ref.Path, vm, ref)
+	if err != nil {
+		return false, err
+	}
+
+	field := TrimJSONPath(sr.Ref.Path)
+	sr.Checked = len(values)
+	sr.Violated = nil
+	for _, obj := range values {
+		// round trip through JSON, so the schema sees the API names and omits the unset fields
+		data, err := json.Marshal(obj)
+		if err != nil {
+			return false, err
+		}
+		res, err := sr.Schema.Validate(gojsonschema.NewBytesLoader(data))
+		if err != nil {
+			return false, err
+		}
+		for _, re := range res.Errors() {
+			sr.Violated = append(sr.Violated, Violation{
+				Field:   field + violationField(re),
+				Message: re.Description(),
+			})
+		}
+	}
+
+	sr.Satisfied = len(sr.Violated) == 0
+	return sr.Satisfied, nil
+}
+
+func (sr *schemaRule) Violations() []Violation {
+	return sr.Violated
+}
+
+func (sr *schemaRule) String() string {
+	if sr.Satisfied {
+		return fmt.Sprintf("%d objects match the schema", sr.Checked)
+	}
+	var descs []string
+	for _, v := range sr.Violated {
+		descs = append(descs, fmt.Sprintf("%s: %s", v.Field, v.Message))
+	}
+	return fmt.Sprintf("Objects don't match the schema: %s", strings.Join(descs, "; "))
+}
+
+// violationField turns the field reported by gojsonschema (e.g. "interfaces.1.bridge")
+// into a path relative to the object checked (e.g. ".interfaces[1].bridge").
+// The missing and unexpected properties are reported on the properties themselves.
+func violationField(re gojsonschema.ResultError) string {
+	var b strings.Builder
+	if f := re.Field(); f != schemaRootField {
+		for _, seg := range strings.Split(f, ".") {
+			if _, err := strconv.Atoi(seg); err == nil {
+				fmt.Fprintf(&b, "[%s]", seg)
+			} else {
+				fmt.Fprintf(&b, ".%s", seg)
+			}
+		}
+	}
+	switch re.Type() {
+	case "required", "additional_property_not_allowed":
+		if prop, ok := re.Details()["property"].(string); ok {
+			fmt.Fprintf(&b, ".%s", prop)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,154 @@
+package validation_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	k6tv1 "kubevirt.io/client-go/api/v1"
+
+	k6tobjs "github.com/kubevirt/kubevirt-template-validator/pkg/kubevirtobjs"
+	"github.com/kubevirt/kubevirt-template-validator/pkg/validation"
+)
+
+var _ = Describe("Schema", func() {
+	var (
+		vmCirros *k6tv1.VirtualMachine
+		vmRef    *k6tv1.VirtualMachine
+	)
+
+	BeforeEach(func() {
+		vmCirros = NewVMCirros()
+		vmRef = k6tobjs.NewDefaultVirtualMachine()
+		vmCirros.Spec.Template.Spec.Domain.CPU = &k6tv1.CPU{Cores: 2, Sockets: 1}
+		vmCirros.Spec.Template.Spec.Domain.Devices.Interfaces = []k6tv1.Interface{
+			{Name: "default", InterfaceBindingMethod: k6tv1.InterfaceBindingMethod{Masquerade: &k6tv1.InterfaceMasquerade{}}},
+			{Name: "secondary", InterfaceBindingMethod: k6tv1.InterfaceBindingMethod{Bridge: &k6tv1.InterfaceBridge{}}},
+		}
+	})
+
+	parseRules := func(data string) []validation.Rule {
+		rules, err := validation.ParseRules([]byte(data))
+		Expect(err).ToNot(HaveOccurred())
+		return rules
+	}
+
+	cpuRules := `
+- name: cpu-topology
+  rule: schema
+  path: jsonpath::.spec.domain.cpu
+  message: only cores and sockets may be set
+  schema:
+    properties:
+      cores:
+        maximum: 4
+      sockets:
+        maximum: 2
+    additionalProperties: false
+`
+
+	interfaceRules := `
+- name: interface-binding
+  rule: schema
+  path: jsonpath::.spec.domain.devices
+  message: interfaces must use exactly one binding
+  schema:
+    properties:
+      interfaces:
+        items:
+          oneOf:
+          - required: [bridge]
+          - required: [masquerade]
+          - required: [sriov]
+`
+
+	It("Should accept the matching objects", func() {
+		rules := parseRules(cpuRules)
+		expectRuleApplicationSuccess(&rules[0], vmCirros, vmRef)
+
+		rules = parseRules(interfaceRules)
+		expectRuleApplicationSuccess(&rules[0], vmCirros, vmRef)
+	})
+
+	It("Should ignore the objects which are not set", func() {
+		vmCirros.Spec.Template.Spec.Domain.CPU = nil
+		rules := parseRules(cpuRules)
+		expectRuleApplicationSuccess(&rules[0], vmCirros, vmRef)
+	})
+
+	It("Should report the unexpected properties", func() {
+		vmCirros.Spec.Template.Spec.Domain.CPU.Threads = 2
+		rules := parseRules(cpuRules)
+
+		ev := validation.NewEvaluator()
+		res := ev.Evaluate(rules, vmCirros)
+		Expect(res.Succeeded()).To(BeFalse())
+		causes := res.ToStatusCauses()
+		Expect(causes).To(HaveLen(1))
+		Expect(causes[0].Field).To(Equal("spec.template.spec.domain.cpu.threads"))
+		Expect(causes[0].Message).To(HavePrefix("only cores and sockets may be set: "))
+	})
+
+	It("Should report the invalid values", func() {
+		vmCirros.Spec.Template.Spec.Domain.CPU.Cores = 8
+		rules := parseRules(cpuRules)
+
+		ev := validation.NewEvaluator()
+		res := ev.Evaluate(rules, vmCirros)
+		Expect(res.Succeeded()).To(BeFalse())
+		causes := res.ToStatusCauses()
+		Expect(causes).To(HaveLen(1))
+		Expect(causes[0].Field).To(Equal("spec.template.spec.domain.cpu.cores"))
+	})
+
+	It("Should report the list elements at fault", func() {
+		vmCirros.Spec.Template.Spec.Domain.Devices.Interfaces[1].Masquerade = &k6tv1.InterfaceMasquerade{}
+		rules := parseRules(interfaceRules)
+
+		ev := validation.NewEvaluator()
+		res := ev.Evaluate(rules, vmCirros)
+		Expect(res.Succeeded()).To(BeFalse())
+		causes := res.ToStatusCauses()
+		Expect(causes).To(HaveLen(1))
+		Expect(causes[0].Field).To(Equal("spec.template.spec.domain.devices.interfaces[1]"))
+	})
+
+	It("Should reject malformed schemas", func() {
+		_, err := validation.ParseRules([]byte(`
+- name: cpu-topology
+  rule: schema
+  path: jsonpath::.spec.domain.cpu
+  message: only cores and sockets may be set
+  schema:
+    properties:
+      cores:
+        maximum: many
+`))
+		Expect(err).ToNot(HaveOccurred())
+
+		issues := validation.Lint([]byte(`
+- name: cpu-topology
+  rule: schema
+  path: jsonpath::.spec.domain.cpu
+  message: only cores and sockets may be set
+  schema:
+    properties:
+      cores:
+        maximum: many
+`))
+		Expect(issues).To(HaveLen(1))
+		Expect(issues[0].Key).To(Equal("schema"))
+	})
+
+	It("Should reject remote references", func() {
+		r := validation.Rule{
+			Rule:    "schema",
+			Name:    "cpu-topology",
+			Path:    "jsonpath::.spec.domain.cpu",
+			Message: "only cores and sockets may be set",
+			Schema:  map[string]interface{}{"$ref": "https://example.com/cpu.json"},
+		}
+		_, err := r.Specialize(vmCirros, vmRef)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("only local references"))
+	})
+})
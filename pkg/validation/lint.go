@@ -0,0 +1,548 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2019 Red Hat, Inc.
+ */
+
+package validation
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// The linter checks the rules statically, without a VM to evaluate them against.
+// The Evaluator detects most of these errors too, but only lazily, at admission time,
+// when the only option left is to reject the VM.
+
+// LintIssue describes a problem found in a rule.
+type LintIssue struct {
+	Location string `json:"location"` // e.g. rules[1].rules[0]
+	Name     string `json:"name,omitempty"`
+	Key      string `json:"key,omitempty"`
+	Message  string `json:"message"`
+}
+
+func (li LintIssue) String() string {
+	return formatIssue(li.Location, li.Name, li.Key, li.Message)
+}
+
+// the argument keys each rule type accepts
+var ruleArgKeys = map[string][]string{
+	"integer":      {"min", "max", "quantifier", "onMissing", "default"},
+	"quantity":     {"min", "max", "quantifier", "onMissing", "default"},
+	"string":       {"minLength", "maxLength", "quantifier", "onMissing", "default"},
+	"regex":        {"regex", "quantifier", "onMissing", "default"},
+	"enum":         {"values", "quantifier", "onMissing", "default"},
+	"bool":         {"value", "quantifier", "onMissing", "default"},
+	"required":     {"quantifier"},
+	"forbidden":    {"quantifier"},
+	ruleCEL:        {"expression"},
+	ruleAllOf:      {"rules"},
+	ruleAnyOf:      {"rules"},
+	ruleOneOf:      {"rules"},
+	ruleNot:        {"rules"},
+	ruleForEach:    {"rules"},
+	ruleAggregate:  {"function", "min", "max"},
+	ruleUnique:     nil,
+	ruleReferences: {"target"},
+	ruleFormat:     {"format", "quantifier"},
+	ruleSchema:     {"schema"},
+	ruleImmutable:  nil,
+	ruleTransition: {"transitions"},
+}
+
+// setArgKeys returns the argument keys which are set in the rule
+func (r *Rule) setArgKeys() []string {
+	set := map[string]bool{
+		"min":         r.Min != nil,
+		"max":         r.Max != nil,
+		"minLength":   r.MinLength != nil,
+		"maxLength":   r.MaxLength != nil,
+		"regex":       r.Regex != "",
+		"values":      len(r.Values) > 0,
+		"value":       r.Value != nil,
+		"expression":  r.Expression != "",
+		"rules":       len(r.Rules) > 0,
+		"quantifier":  r.Quantifier != "",
+		"function":    r.Function != "",
+		"target":      r.Target != "",
+		"format":      r.Format != "",
+		"onMissing":   r.OnMissing != "",
+		"default":     r.Default != nil,
+		"schema":      r.Schema != nil,
+		"transitions": len(r.Transitions) > 0,
+	}
+	var keys []string
+	for key, ok := range set {
+		if ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Lint checks the rules found in data, reporting all the issues found.
+// Unlike ParseRules, it also detects the keys which are not recognized.
+func Lint(data []byte) []LintIssue {
+	items, err := splitRules(data, true)
+	if err != nil {
+		return []LintIssue{toLintIssue(err)}
+	}
+	raw := make([]interface{}, len(items))
+	for i, item := range items {
+		json.Unmarshal(item, &raw[i])
+	}
+	// unknown keys are reported by the linter itself, to report all of them
+	rules, err := parseRuleList("rules", items, false)
+	if err != nil {
+		return []LintIssue{toLintIssue(err)}
+	}
+	l := linter{}
+	l.lintRules("rules", rules, raw)
+	return l.issues
+}
+
+func toLintIssue(err error) LintIssue {
+	if pe, ok := err.(*ParseError); ok {
+		return LintIssue{Location: pe.Location, Name: pe.Name, Key: pe.Key, Message: pe.Message}
+	}
+	return LintIssue{Location: "rules", Message: err.Error()}
+}
+
+// LintRules checks the rules, reporting all the issues found.
+func LintRules(rules []Rule) []LintIssue {
+	l := linter{}
+	l.lintRules("rules", rules, nil)
+	return l.issues
+}
+
+type linter struct {
+	issues []LintIssue
+}
+
+func (l *linter) report(loc string, r *Rule, key, format string, args ...interface{}) {
+	l.issues = append(l.issues, LintIssue{
+		Location: loc,
+		Name:     r.Name,
+		Key:      key,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// raw is the decoded JSON of the rules, if available, to detect unknown keys.
+func (l *linter) lintRules(loc string, rules []Rule, raw []interface{}) {
+	names := make(map[string]int)
+	for i := range rules {
+		r := &rules[i]
+		ruleLoc := fmt.Sprintf("%s[%d]", loc, i)
+
+		var rawRule map[string]interface{}
+		if i < len(raw) {
+			rawRule, _ = raw[i].(map[string]interface{})
+		}
+		l.lintUnknownKeys(ruleLoc, r, rawRule)
+
+		if r.Name != "" {
+			names[r.Name]++
+			if names[r.Name] == 2 {
+				l.report(ruleLoc, r, "name", "%v", ErrDuplicateRuleName)
+			}
+		}
+		l.lintRule(ruleLoc, r)
+
+		if len(r.Rules) > 0 {
+			rawNested, _ := rawRule["rules"].([]interface{})
+			nested := r.Rules
+			if r.Rule == ruleForEach && isJSONPath(r.Path) {
+				// the nested paths are relative to the elements, so check them on any element
+				nested = scopeRules(r.Rules, TrimJSONPath(r.Path)+"[*]")
+			}
+			l.lintRules(ruleLoc+".rules", nested, rawNested)
+		}
+	}
+}
+
+func (l *linter) lintUnknownKeys(loc string, r *Rule, rawRule map[string]interface{}) {
+	for _, key := range unknownKeys(rawRule, reflect.TypeOf(Rule{})) {
+		l.report(loc, r, key, "unknown key")
+	}
+	rawConds, _ := rawRule["when"].([]interface{})
+	for i, rawCond := range rawConds {
+		cond, _ := rawCond.(map[string]interface{})
+		for _, key := range unknownKeys(cond, reflect.TypeOf(Condition{})) {
+			l.report(loc, r, fmt.Sprintf("when[%d].%s", i, key), "unknown key")
+		}
+	}
+	rawTransitions, _ := rawRule["transitions"].([]interface{})
+	for i, rawTransition := range rawTransitions {
+		transition, _ := rawTransition.(map[string]interface{})
+		for _, key := range unknownKeys(transition, reflect.TypeOf(Transition{})) {
+			l.report(loc, r, fmt.Sprintf("transitions[%d].%s", i, key), "unknown key")
+		}
+	}
+}
+
+// lintAllUnknownKeys reports the unknown keys of the rules and of their nested rules, only.
+func (l *linter) lintAllUnknownKeys(loc string, rules []Rule, raw []interface{}) {
+	for i := range rules {
+		ruleLoc := fmt.Sprintf("%s[%d]", loc, i)
+		var rawRule map[string]interface{}
+		if i < len(raw) {
+			rawRule, _ = raw[i].(map[string]interface{})
+		}
+		l.lintUnknownKeys(ruleLoc, &rules[i], rawRule)
+		rawNested, _ := rawRule["rules"].([]interface{})
+		l.lintAllUnknownKeys(ruleLoc+".rules", rules[i].Rules, rawNested)
+	}
+}
+
+func unknownKeys(obj map[string]interface{}, t reflect.Type) []string {
+	known := jsonKeys(t)
+	var ret []string
+	for key := range obj {
+		if !known[key] {
+			ret = append(ret, key)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func (l *linter) lintRule(loc string, r *Rule) {
+	if r.Name == "" {
+		l.report(loc, r, "name", "%v", ErrMissingRequiredKey)
+	}
+	if r.Message == "" {
+		l.report(loc, r, "message", "%v", ErrMissingRequiredKey)
+	}
+	if !isValidSeverity(r.Severity) {
+		l.report(loc, r, "severity", "%v %q", ErrInvalidSeverity, r.Severity)
+	}
+	if !isValidQuantifier(r.Quantifier) {
+		l.report(loc, r, "quantifier", "%v %q", ErrInvalidQuantifier, r.Quantifier)
+	}
+	if r.DocURL != "" {
+		if u, err := url.Parse(r.DocURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			l.report(loc, r, "docURL", "must be an absolute http(s) URL, not %q", r.DocURL)
+		}
+	}
+	if !isValidOnMissing(r.OnMissing) {
+		l.report(loc, r, "onMissing", "%v %q", ErrInvalidOnMissing, r.OnMissing)
+	}
+	for i, op := range r.Operations {
+		if !isValidOperation(op) {
+			l.report(loc, r, fmt.Sprintf("operations[%d]", i), "%v %q", ErrInvalidOperation, op)
+		}
+	}
+	if (r.Rule == ruleImmutable || r.Rule == ruleTransition) && len(r.Operations) > 0 && !containsString(r.Operations, OperationUpdate) {
+		l.report(loc, r, "operations", "%s rules only check updates", r.Rule)
+	}
+	if r.Rule == "" {
+		l.report(loc, r, "rule", "%v", ErrMissingRequiredKey)
+		return
+	}
+	argKeys, ok := ruleArgKeys[r.Rule]
+	if !ok {
+		l.report(loc, r, "rule", "%v %q", ErrUnrecognizedRuleType, r.Rule)
+		return
+	}
+
+	for _, key := range r.setArgKeys() {
+		if !containsString(argKeys, key) {
+			l.report(loc, r, key, "not used by %s rules", r.Rule)
+		}
+	}
+
+	l.lintPaths(loc, r)
+	l.lintArgs(loc, r)
+	if containsString(argKeys, "default") {
+		l.lintDefault(loc, r)
+	}
+
+	r.compile()
+	if r.compileErr != nil {
+		l.report(loc, r, compileErrorKey(r), "%v", r.compileErr)
+	}
+}
+
+// compileErrorKey returns the key at fault when the rule can't be compiled.
+func compileErrorKey(r *Rule) string {
+	switch {
+	case r.messageTemplate == nil && isMessageTemplate(r.Message):
+		return "message"
+	case r.Rule == ruleCEL:
+		return "expression"
+	case r.Rule == ruleSchema:
+		return "schema"
+	}
+	return "regex"
+}
+
+// CompileErrors returns the rules of the RuleSet which can't be compiled (e.g. a broken regex),
+// reported like the linter does. Unlike the other lint issues, these always break the evaluation.
+func (rs *RuleSet) CompileErrors() []LintIssue {
+	l := linter{}
+	l.reportCompileErrors("rules", rs.Rules)
+	return l.issues
+}
+
+func (l *linter) reportCompileErrors(loc string, rules []Rule) {
+	for i := range rules {
+		r := &rules[i]
+		ruleLoc := fmt.Sprintf("%s[%d]", loc, i)
+		if r.compileErr != nil {
+			l.report(ruleLoc, r, compileErrorKey(r), "%v", r.compileErr)
+		}
+		l.reportCompileErrors(ruleLoc+".rules", r.Rules)
+	}
+}
+
+// the rules whose path can't be an expression
+var jsonPathRules = []string{ruleForEach, ruleSchema, ruleImmutable, ruleTransition}
+
+func (l *linter) lintPaths(loc string, r *Rule) {
+	needsPath := !isCompositeRule(r.Rule) && r.Rule != ruleCEL
+	switch {
+	case r.Path == "" && needsPath:
+		l.report(loc, r, "path", "%v", ErrMissingRequiredKey)
+	case r.Path != "" && !needsPath:
+		l.report(loc, r, "path", "not used by %s rules", r.Rule)
+	case containsString(jsonPathRules, r.Rule) && !isJSONPath(r.Path):
+		l.report(loc, r, "path", "must start with %s", describePathPrefixes())
+	case isJSONPath(r.Path):
+		sn, err := checkSchemaPath(r.Path)
+		if err != nil {
+			l.report(loc, r, "path", "%v", err)
+		} else if !isCompatibleSchema(r.Rule, sn) {
+			l.report(loc, r, "path", "%s rules can't check %s values", r.Rule, sn.describe())
+		}
+	case isExpression(r.Path):
+		l.lintParam(loc, r, "path", r.Path)
+	case r.Path != "":
+		l.report(loc, r, "path", "must start with %s or %q", describePathPrefixes(), ExpressionPrefix)
+	}
+
+	if r.Valid != "" {
+		if !isJSONPath(r.Valid) {
+			l.report(loc, r, "valid", "must start with %s", describePathPrefixes())
+		} else {
+			l.lintParam(loc, r, "valid", r.Valid)
+		}
+	}
+
+	for i := range r.When {
+		c := &r.When[i]
+		key := fmt.Sprintf("when[%d]", i)
+		if c.Path == "" && c.LabelSelector == nil {
+			l.report(loc, r, key, "condition without path and labelSelector")
+		}
+		if c.Path != "" {
+			if !isJSONPath(c.Path) {
+				l.report(loc, r, key+".path", "must start with %s", describePathPrefixes())
+			} else {
+				l.lintParam(loc, r, key+".path", c.Path)
+			}
+		}
+		l.lintQuantityParam(loc, r, key+".min", c.Min)
+		l.lintQuantityParam(loc, r, key+".max", c.Max)
+	}
+}
+
+func (l *linter) lintArgs(loc string, r *Rule) {
+	switch r.Rule {
+	case "integer":
+		l.lintAtLeastOne(loc, r, "min", "max")
+		l.lintIntParam(loc, r, "min", r.Min)
+		l.lintIntParam(loc, r, "max", r.Max)
+	case "quantity":
+		l.lintAtLeastOne(loc, r, "min", "max")
+		l.lintQuantityParam(loc, r, "min", r.Min)
+		l.lintQuantityParam(loc, r, "max", r.Max)
+	case ruleReferences:
+		if r.Target == "" {
+			l.report(loc, r, "target", "%v", ErrMissingRequiredKey)
+		} else if !isJSONPath(r.Target) {
+			l.report(loc, r, "target", "must start with %s", describePathPrefixes())
+		} else {
+			l.lintParam(loc, r, "target", r.Target)
+		}
+	case ruleFormat:
+		if r.Format == "" {
+			l.report(loc, r, "format", "%v", ErrMissingRequiredKey)
+		} else if !isValidFormat(r.Format) {
+			l.report(loc, r, "format", "unsupported format %q, expected one of %s", r.Format, strings.Join(Formats(), ", "))
+		}
+	case ruleAggregate:
+		if r.Function == "" {
+			l.report(loc, r, "function", "%v", ErrMissingRequiredKey)
+		} else if !isValidAggregate(r.Function) {
+			l.report(loc, r, "function", "unsupported aggregate function %q", r.Function)
+		}
+		l.lintAtLeastOne(loc, r, "min", "max")
+		l.lintQuantityParam(loc, r, "min", r.Min)
+		l.lintQuantityParam(loc, r, "max", r.Max)
+	case "string":
+		l.lintAtLeastOne(loc, r, "minLength", "maxLength")
+		l.lintIntParam(loc, r, "minLength", r.MinLength)
+		l.lintIntParam(loc, r, "maxLength", r.MaxLength)
+	case "regex":
+		if r.Regex == "" {
+			l.report(loc, r, "regex", "%v", ErrMissingRequiredKey)
+		}
+	case "enum":
+		if len(r.Values) == 0 {
+			l.report(loc, r, "values", "%v", ErrMissingRequiredKey)
+		}
+	case "bool":
+		if s, ok := r.Value.(string); ok {
+			l.lintParam(loc, r, "value", s)
+		} else if _, ok := r.Value.(bool); r.Value != nil && !ok {
+			l.report(loc, r, "value", "must be a bool or a JSONPath, not %v", r.Value)
+		}
+	case ruleCEL:
+		if r.Expression == "" {
+			l.report(loc, r, "expression", "%v", ErrMissingRequiredKey)
+		}
+	case ruleTransition:
+		if len(r.Transitions) == 0 {
+			l.report(loc, r, "transitions", "%v", ErrMissingRequiredKey)
+		}
+		for i, t := range r.Transitions {
+			if t.From == t.To && t.From != anyValue {
+				l.report(loc, r, fmt.Sprintf("transitions[%d]", i), "keeping the same value is always allowed")
+			}
+		}
+	case ruleAllOf, ruleAnyOf, ruleOneOf, ruleForEach:
+		if len(r.Rules) == 0 {
+			l.report(loc, r, "rules", "%v", ErrMissingRequiredKey)
+		}
+	case ruleNot:
+		if len(r.Rules) != 1 {
+			l.report(loc, r, "rules", "expects exactly one nested rule, found %d", len(r.Rules))
+		}
+	}
+}
+
+func (l *linter) lintAtLeastOne(loc string, r *Rule, keys ...string) {
+	set := r.setArgKeys()
+	for _, key := range keys {
+		if containsString(set, key) {
+			return
+		}
+	}
+	l.report(loc, r, strings.Join(keys, "/"), "%v: expected at least one", ErrMissingRequiredKey)
+}
+
+// lintDefault checks that the default value is set when it is needed, and that it is a literal of the right type.
+func (l *linter) lintDefault(loc string, r *Rule) {
+	if r.Default == nil {
+		if r.OnMissing == OnMissingDefault {
+			l.report(loc, r, "default", "%v", ErrMissingRequiredKey)
+		}
+		return
+	}
+	if r.OnMissing != OnMissingDefault {
+		l.report(loc, r, "default", "only used with onMissing %q", OnMissingDefault)
+		return
+	}
+	if s, ok := r.Default.(string); ok && (isJSONPath(s) || isExpression(s)) {
+		l.report(loc, r, "default", "must be a literal value, not %q", s)
+		return
+	}
+	switch r.Rule {
+	case "integer":
+		l.lintIntParam(loc, r, "default", r.Default)
+	case "quantity":
+		l.lintQuantityParam(loc, r, "default", r.Default)
+	case "bool":
+		if _, ok := toBool(r.Default); !ok {
+			l.report(loc, r, "default", "must be a boolean, not %v", r.Default)
+		}
+	}
+}
+
+func (l *linter) lintIntParam(loc string, r *Rule, key string, obj interface{}) {
+	switch v := obj.(type) {
+	case nil:
+	case string:
+		l.lintParam(loc, r, key, v)
+	case float64:
+		if v != math.Trunc(v) {
+			l.report(loc, r, key, "must be an integer, not %v", v)
+		}
+	default:
+		if _, ok := toInt64(obj); !ok {
+			l.report(loc, r, key, "must be an integer, not %v", obj)
+		}
+	}
+}
+
+func (l *linter) lintQuantityParam(loc string, r *Rule, key string, obj interface{}) {
+	s, ok := obj.(string)
+	if !ok {
+		if _, ok := toQuantity(obj); obj != nil && !ok {
+			l.report(loc, r, key, "must be a quantity, not %v", obj)
+		}
+		return
+	}
+	if isJSONPath(s) || isExpression(s) {
+		l.lintParam(loc, r, key, s)
+		return
+	}
+	if _, err := resource.ParseQuantity(s); err != nil {
+		l.report(loc, r, key, "%v", err)
+	}
+}
+
+// lintParam checks the JSONPaths and expressions against the schema. Plain values are not checked.
+func (l *linter) lintParam(loc string, r *Rule, key, s string) {
+	var paths []string
+	switch {
+	case isJSONPath(s):
+		paths = append(paths, s)
+	case isExpression(s):
+		e, err := NewExpression(s)
+		if err != nil {
+			l.report(loc, r, key, "%v", err)
+			return
+		}
+		for _, p := range e.Paths() {
+			paths = append(paths, exprPath(p))
+		}
+	}
+	for _, p := range paths {
+		if _, err := checkSchemaPath(p); err != nil {
+			l.report(loc, r, key, "%v", err)
+		}
+	}
+}
+
+func containsString(items []string, s string) bool {
+	for _, item := range items {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,191 @@
+package validation_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/kubevirt/kubevirt-template-validator/pkg/validation"
+)
+
+func lintMessages(issues []validation.LintIssue) []string {
+	var ret []string
+	for _, issue := range issues {
+		ret = append(ret, issue.String())
+	}
+	return ret
+}
+
+var _ = Describe("Lint", func() {
+	It("Should accept well formed rules", func() {
+		issues := validation.Lint([]byte(`[{
+			"name": "core-limits",
+			"valid": "jsonpath::.spec.domain.cpu.cores",
+			"path": "jsonpath::.spec.domain.cpu.cores",
+			"rule": "integer",
+			"message": "cpu cores must be limited",
+			"min": 1,
+			"max": "expr::{.spec.domain.cpu.sockets} * 4"
+		}, {
+			"name": "memory",
+			"path": "jsonpath::.spec.domain.resources.requests.memory",
+			"rule": "quantity",
+			"message": "memory must be at least 1Gi",
+			"min": "1Gi",
+			"when": [{"path": "jsonpath::.metadata.labels.os", "equals": "fedora"}]
+		}, {
+			"name": "supported-bus",
+			"path": "jsonpath::.spec.domain.devices.disks[*].disk.bus",
+			"rule": "enum",
+			"message": "the disk bus must be virtio",
+			"values": ["virtio"]
+		}, {
+			"name": "default-nic",
+			"path": "jsonpath::.spec.domain.devices.interfaces[?(@.name=='default')].model",
+			"rule": "enum",
+			"message": "the default NIC must be virtio",
+			"values": ["virtio"]
+		}, {
+			"name": "graphics",
+			"rule": "anyOf",
+			"message": "graphics must be explicitly set",
+			"rules": [{
+				"name": "autoattach",
+				"path": "jsonpath::.spec.domain.devices.autoattachGraphicsDevice",
+				"rule": "bool",
+				"message": "graphics must be attached"
+			}]
+		}]`))
+		Expect(issues).To(BeEmpty())
+	})
+
+	It("Should detect malformed JSON", func() {
+		issues := validation.Lint([]byte(`[{"name": "broken"`))
+		Expect(issues).To(HaveLen(1))
+	})
+
+	It("Should detect unknown keys", func() {
+		issues := validation.Lint([]byte(`[{
+			"name": "typo",
+			"path": "jsonpath::.spec.domain.cpu.cores",
+			"rule": "integer",
+			"message": "cpu cores must be limited",
+			"maximum": 8,
+			"max": 8,
+			"when": [{"path": "jsonpath::.spec.domain.cpu", "equal": 1}]
+		}]`))
+		Expect(lintMessages(issues)).To(Equal([]string{
+			"rules[0] (typo) maximum: unknown key",
+			"rules[0] (typo) when[0].equal: unknown key",
+		}))
+	})
+
+	It("Should detect missing keys, unknown types and duplicate names", func() {
+		issues := validation.LintRules([]validation.Rule{{
+			Name: "dup",
+			Rule: "integer",
+			Path: "jsonpath::.spec.domain.cpu.cores",
+			Max:  8,
+		}, {
+			Name:    "dup",
+			Rule:    "number",
+			Path:    "jsonpath::.spec.domain.cpu.cores",
+			Message: "unknown type",
+		}})
+		Expect(lintMessages(issues)).To(Equal([]string{
+			"rules[0] (dup) message: missing required key",
+			"rules[1] (dup) name: duplicate Rule Name",
+			"rules[1] (dup) rule: unrecognized Rule type \"number\"",
+		}))
+	})
+
+	It("Should detect keys not used by the rule type", func() {
+		issues := validation.LintRules([]validation.Rule{{
+			Name:      "mismatch",
+			Rule:      "integer",
+			Path:      "jsonpath::.spec.domain.cpu.cores",
+			Message:   "cpu cores must be limited",
+			Max:       8,
+			MinLength: 2,
+		}})
+		Expect(lintMessages(issues)).To(Equal([]string{
+			"rules[0] (mismatch) minLength: not used by integer rules",
+		}))
+	})
+
+	It("Should detect malformed arguments", func() {
+		issues := validation.LintRules([]validation.Rule{{
+			Name:    "bad-regex",
+			Rule:    "regex",
+			Path:    "jsonpath::.spec.domain.machine.type",
+			Message: "machine type",
+			Regex:   "([",
+		}, {
+			Name:    "bad-quantity",
+			Rule:    "quantity",
+			Path:    "jsonpath::.spec.domain.resources.requests.memory",
+			Message: "memory",
+			Min:     "1 Gi",
+		}, {
+			Name:    "bad-int",
+			Rule:    "integer",
+			Path:    "jsonpath::.spec.domain.cpu.cores",
+			Message: "cores",
+			Max:     2.5,
+		}})
+		Expect(issues).To(HaveLen(3))
+		Expect(issues[0].Key).To(Equal("regex"))
+		Expect(issues[1].Key).To(Equal("min"))
+		Expect(issues[2].Key).To(Equal("max"))
+	})
+
+	It("Should check the paths against the schema", func() {
+		issues := validation.LintRules([]validation.Rule{{
+			Name:    "typo",
+			Rule:    "integer",
+			Path:    "jsonpath::.spec.domain.cpu.coers",
+			Message: "cores",
+			Max:     8,
+		}, {
+			Name:    "typo-in-expression",
+			Rule:    "integer",
+			Path:    "jsonpath::.spec.domain.cpu.cores",
+			Message: "cores",
+			Max:     "expr::{.spec.domain.cpu.socket} * 4",
+		}, {
+			Name:    "not-an-array",
+			Rule:    "enum",
+			Path:    "jsonpath::.spec.domain.machine[*].type",
+			Message: "machine",
+			Values:  []string{"q35"},
+		}, {
+			Name:    "wrong-type",
+			Rule:    "integer",
+			Path:    "jsonpath::.spec.domain.machine.type",
+			Message: "machine",
+			Min:     1,
+		}})
+		Expect(lintMessages(issues)).To(Equal([]string{
+			"rules[0] (typo) path: .spec.domain.cpu: unknown field \"coers\" in CPU",
+			"rules[1] (typo-in-expression) max: .spec.domain.cpu: unknown field \"socket\" in CPU",
+			"rules[2] (not-an-array) path: .spec.domain.machine: cannot index Machine, not an array",
+			"rules[3] (wrong-type) path: integer rules can't check string values",
+		}))
+	})
+
+	It("Should lint nested rules", func() {
+		issues := validation.LintRules([]validation.Rule{{
+			Name:    "composite",
+			Rule:    "not",
+			Message: "composite",
+			Rules: []validation.Rule{{
+				Name:    "nested",
+				Rule:    "bool",
+				Path:    "jsonpath::.spec.domain.devices.autoattachGraphicDevice",
+				Message: "nested",
+			}},
+		}})
+		Expect(lintMessages(issues)).To(Equal([]string{
+			"rules[0].rules[0] (nested) path: .spec.domain.devices: unknown field \"autoattachGraphicDevice\" in Devices",
+		}))
+	})
+})
@@ -0,0 +1,200 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2019 Red Hat, Inc.
+ */
+
+package validation
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"kubevirt.io/client-go/log"
+)
+
+// The message of a rule is shown to the user as-is, followed by what the rule found, e.g.
+//   invalid number of cores: value 0 is lower than minimum [1]
+// Messages with placeholders are templates instead, rendered with what the rule found, e.g.
+//   "{{.Path}} must be at least {{.Min}}, found {{.Value}}"
+// The optional hint and docURL keys are added to the message, to tell how to fix the VM.
+
+// messageData are the values the message templates can use.
+type messageData struct {
+	Name     string // the name of the rule
+	Path     string // the path of the rule, without the jsonpath:: prefix
+	Index    string // the index of the list element, for the rules nested in forEach rules
+	Value    string // the values found, comma separated
+	Previous string // the values found in the previous version of the VM (immutable and transition rules)
+	Min      string
+	Max      string
+	Allowed  string // what the values are checked against: the enum values, the regex, the format...
+}
+
+// messageFiller is implemented by the RuleAppliers which have values to show in the message templates.
+type messageFiller interface {
+	fillMessage(md *messageData)
+}
+
+func isMessageTemplate(s string) bool {
+	return strings.Contains(s, "{{")
+}
+
+// compileMessage parses the message template, and tries it once, so the unknown placeholders
+// are reported along with the syntax errors, when the rule is parsed.
+func compileMessage(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid message template: %v", err)
+	}
+	if err := tmpl.Execute(ioutil.Discard, messageData{}); err != nil {
+		return nil, fmt.Errorf("invalid message template: %v", err)
+	}
+	return tmpl, nil
+}
+
+// renderMessage returns the message of the rule, with the placeholders replaced by what ra found.
+func (r *Rule) renderMessage(ra RuleApplier) string {
+	if r.messageTemplate == nil {
+		return r.Message
+	}
+	md := messageData{
+		Name:  r.Name,
+		Path:  TrimJSONPath(r.Path),
+		Index: elementIndex(r.element),
+	}
+	if mf, ok := ra.(messageFiller); ok {
+		mf.fillMessage(&md)
+	}
+	var b strings.Builder
+	if err := r.messageTemplate.Execute(&b, md); err != nil {
+		log.Log.Warningf("cannot render the message of rule %s: %v", r.Name, err)
+		return r.Message
+	}
+	return b.String()
+}
+
+// describe returns the text shown to the user about the rule: its message followed by
+// the details, unless the message is a template which tells them already, and the hints.
+func (r *Rule) describe(message, details string) string {
+	if message == "" {
+		message = r.Message
+	}
+	if r.messageTemplate == nil && details != "" {
+		message = fmt.Sprintf("%s: %s", message, details)
+	}
+	return r.withHints(message)
+}
+
+func (r *Rule) withHints(message string) string {
+	switch {
+	case r.Hint != "" && r.DocURL != "":
+		return fmt.Sprintf("%s (hint: %s, see %s)", message, r.Hint, r.DocURL)
+	case r.Hint != "":
+		return fmt.Sprintf("%s (hint: %s)", message, r.Hint)
+	case r.DocURL != "":
+		return fmt.Sprintf("%s (see %s)", message, r.DocURL)
+	}
+	return message
+}
+
+// elementIndex returns the index of the list element (e.g. "2" for ".spec.domain.devices.disks[2]").
+func elementIndex(element string) string {
+	if !strings.HasSuffix(element, "]") {
+		return ""
+	}
+	pos := strings.LastIndex(element, "[")
+	if pos == -1 {
+		return ""
+	}
+	return element[pos+1 : len(element)-1]
+}
+
+func formatRange(r Range) (string, string) {
+	var min, max string
+	if r.MinSet {
+		min = formatNumber(r.Min)
+	}
+	if r.MaxSet {
+		max = formatNumber(r.Max)
+	}
+	return min, max
+}
+
+func formatQuantityRange(r QuantityRange) (string, string) {
+	var min, max string
+	if r.MinSet {
+		min = r.Min.String()
+	}
+	if r.MaxSet {
+		max = r.Max.String()
+	}
+	return min, max
+}
+
+func (ir *intRule) fillMessage(md *messageData) {
+	md.Value = strings.Join(formatNumbers(ir.Current), ", ")
+	md.Min, md.Max = formatRange(ir.Value)
+}
+
+func (qr *quantityRule) fillMessage(md *messageData) {
+	md.Value = strings.Join(quantitiesToStrings(qr.Current), ", ")
+	md.Min, md.Max = formatQuantityRange(qr.Value)
+}
+
+func (sr *stringRule) fillMessage(md *messageData) {
+	md.Value = strings.Join(sr.Current, ", ")
+	md.Min, md.Max = formatRange(sr.Length)
+}
+
+func (er *enumRule) fillMessage(md *messageData) {
+	md.Value = strings.Join(er.Current, ", ")
+	md.Allowed = strings.Join(er.Values, ", ")
+}
+
+func (rr *regexRule) fillMessage(md *messageData) {
+	md.Value = strings.Join(rr.Current, ", ")
+	md.Allowed = rr.Regex.String()
+}
+
+func (br *boolRule) fillMessage(md *messageData) {
+	md.Value = joinValues(br.Current)
+	md.Allowed = strconv.FormatBool(br.Expected)
+}
+
+func (ar *aggregateRule) fillMessage(md *messageData) {
+	md.Value = ar.Result.String()
+	md.Min, md.Max = formatQuantityRange(ar.Value)
+	md.Allowed = ar.Ref.Function
+}
+
+func (fr *formatRule) fillMessage(md *messageData) {
+	md.Value = strings.Join(fr.Current, ", ")
+	md.Allowed = fr.Ref.Format
+}
+
+func (ir *immutableRule) fillMessage(md *messageData) {
+	md.Value = strings.Join(ir.Current, ", ")
+	md.Previous = strings.Join(ir.Previous, ", ")
+}
+
+func (tr *transitionRule) fillMessage(md *messageData) {
+	md.Value = tr.Current
+	md.Previous = tr.Previous
+	md.Allowed = tr.allowed()
+}
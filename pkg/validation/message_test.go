@@ -0,0 +1,114 @@
+package validation_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	k6tv1 "kubevirt.io/client-go/api/v1"
+
+	"github.com/kubevirt/kubevirt-template-validator/pkg/validation"
+)
+
+var _ = Describe("Messages", func() {
+	var vmCirros *k6tv1.VirtualMachine
+
+	BeforeEach(func() {
+		vmCirros = NewVMCirros()
+		vmCirros.Spec.Template.Spec.Domain.CPU = &k6tv1.CPU{Cores: 16}
+	})
+
+	newCoreRule := func(message string) validation.Rule {
+		return validation.Rule{
+			Rule:    "integer",
+			Name:    "core-limits",
+			Path:    "jsonpath::.spec.domain.cpu.cores",
+			Message: message,
+			Max:     8,
+		}
+	}
+
+	evaluate := func(rules ...validation.Rule) *validation.Result {
+		return validation.NewEvaluator().Evaluate(rules, vmCirros)
+	}
+
+	It("Should append the details to plain messages", func() {
+		res := evaluate(newCoreRule("cpu cores must be limited"))
+		causes := res.Causes()
+		Expect(causes).To(HaveLen(1))
+		Expect(causes[0].Message).To(Equal("cpu cores must be limited: value 16 is higher than maximum [8]"))
+	})
+
+	It("Should render the message templates", func() {
+		res := evaluate(newCoreRule("{{.Value}} cpu cores requested at {{.Path}}, at most {{.Max}} are supported"))
+		causes := res.Causes()
+		Expect(causes).To(HaveLen(1))
+		Expect(causes[0].Message).To(Equal("16 cpu cores requested at .spec.domain.cpu.cores, at most 8 are supported"))
+	})
+
+	It("Should add the hints to the causes", func() {
+		r := newCoreRule("{{.Value}} cpu cores requested, at most {{.Max}} are supported")
+		r.Hint = "use more sockets instead"
+		r.DocURL = "https://kubevirt.io/user-guide/"
+		causes := evaluate(r).Causes()
+		Expect(causes).To(HaveLen(1))
+		Expect(causes[0].Message).To(Equal("16 cpu cores requested, at most 8 are supported (hint: use more sockets instead, see https://kubevirt.io/user-guide/)"))
+
+		r = newCoreRule("cpu cores must be limited")
+		r.Hint = "use more sockets instead"
+		causes = evaluate(r).Causes()
+		Expect(causes).To(HaveLen(1))
+		Expect(causes[0].Message).To(Equal("cpu cores must be limited: value 16 is higher than maximum [8] (hint: use more sockets instead)"))
+	})
+
+	It("Should add the hints to the warnings", func() {
+		r := newCoreRule("{{.Value}} cpu cores are not recommended")
+		r.Severity = validation.SeverityWarning
+		r.DocURL = "https://kubevirt.io/user-guide/"
+		res := evaluate(r)
+		Expect(res.Succeeded()).To(BeTrue())
+		Expect(res.Warnings).To(Equal([]string{"16 cpu cores are not recommended (see https://kubevirt.io/user-guide/)"}))
+
+		r = newCoreRule("too many cpu cores")
+		r.Severity = validation.SeverityWarning
+		r.Hint = "use more sockets instead"
+		res = evaluate(r)
+		Expect(res.Succeeded()).To(BeTrue())
+		Expect(res.Warnings).To(Equal([]string{"too many cpu cores: value 16 is higher than maximum [8] (hint: use more sockets instead)"}))
+	})
+
+	It("Should tell the index of the list elements", func() {
+		res := evaluate(validation.Rule{
+			Rule:    "forEach",
+			Name:    "disk-bus",
+			Path:    "jsonpath::.spec.domain.devices.disks",
+			Message: "invalid disks",
+			Rules: []validation.Rule{{
+				Rule:    "enum",
+				Name:    "disk-bus",
+				Path:    "jsonpath::.disk.bus",
+				Message: "disk {{.Index}} uses the {{.Value}} bus, expected {{.Allowed}}",
+				Values:  []string{"sata", "scsi"},
+			}},
+		})
+		causes := res.Causes()
+		Expect(causes).To(HaveLen(2))
+		Expect(causes[0].Message).To(Equal("disk 0 uses the virtio bus, expected sata, scsi"))
+		Expect(causes[1].Message).To(Equal("disk 1 uses the virtio bus, expected sata, scsi"))
+	})
+
+	It("Should lint the message templates and the links", func() {
+		issues := validation.LintRules([]validation.Rule{newCoreRule("{{.Value} cpu cores")})
+		Expect(issues).To(HaveLen(1))
+		Expect(issues[0].Key).To(Equal("message"))
+
+		issues = validation.LintRules([]validation.Rule{newCoreRule("{{.Cores}} cpu cores")})
+		Expect(issues).To(HaveLen(1))
+		Expect(issues[0].Key).To(Equal("message"))
+
+		r := newCoreRule("cpu cores must be limited")
+		r.DocURL = "kubevirt.io/user-guide"
+		issues = validation.LintRules([]validation.Rule{r})
+		Expect(issues).To(HaveLen(1))
+		Expect(issues[0].Key).To(Equal("docURL"))
+	})
+})
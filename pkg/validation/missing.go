@@ -0,0 +1,148 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2019 Red Hat, Inc.
+ */
+
+package validation
+
+import (
+	"errors"
+	"fmt"
+
+	k6tv1 "kubevirt.io/client-go/api/v1"
+)
+
+// The value rules look up the missing values in the zero-initialized reference VM, so a VM
+// which omits an optional field is checked as if the field was set to its zero value.
+// The onMissing key tells what to do instead when the path has no value:
+// - "skip": the rule is not applied, like when its `valid` path is not found;
+// - "fail": the rule is not satisfied;
+// - "default": the rule is applied to the `default` value.
+// The operands of the expressions are missing values too, e.g. {.spec.domain.cpu.threads} in
+//   expr::{.spec.domain.cpu.cores} * {.spec.domain.cpu.threads}
+// When the zero value of an operand makes an expression undefined (a division by zero),
+// the rule is skipped: there is nothing to check.
+
+const (
+	OnMissingSkip    string = "skip"
+	OnMissingFail    string = "fail"
+	OnMissingDefault string = "default"
+)
+
+var ErrInvalidOnMissing = errors.New("unrecognized onMissing policy")
+
+// missingSkipError tells the Evaluator to skip the rule, because a value it needs is not set.
+type missingSkipError struct {
+	Path string // the path without value
+}
+
+func (e *missingSkipError) Error() string {
+	return fmt.Sprintf("no value set at %s", TrimJSONPath(e.Path))
+}
+
+func isValidOnMissing(s string) bool {
+	return s == "" || s == OnMissingSkip || s == OnMissingFail || s == OnMissingDefault
+}
+
+// missingValue records if the path of a rule had no value, and how that was handled.
+type missingValue struct {
+	Missing bool
+	Path    string
+	Policy  string
+	Default interface{}
+}
+
+// resolveMissing checks if the path of the rule has a value, applying the onMissing policy if not.
+// It returns what the rule should check: either its path or its default value.
+// Only JSONPaths, and the operands of the expressions, can be missing: literals always have a value.
+func resolveMissing(r *Rule, vm, ref *k6tv1.VirtualMachine) (interface{}, missingValue, error) {
+	mv := missingValue{Path: r.Path, Policy: r.OnMissing, Default: r.Default}
+	missingPath, err := findMissingPath(r, vm, ref)
+	if err != nil {
+		return nil, mv, err
+	}
+	if missingPath == "" {
+		return r.Path, mv, nil
+	}
+
+	mv.Missing = true
+	mv.Path = missingPath
+	switch r.OnMissing {
+	case OnMissingSkip:
+		return nil, mv, &missingSkipError{Path: missingPath}
+	case OnMissingDefault:
+		if r.Default == nil {
+			return nil, mv, fmt.Errorf("onMissing %q requires a default value", r.OnMissing)
+		}
+		return r.Default, mv, nil
+	}
+	return r.Path, mv, nil
+}
+
+// findMissingPath returns the path of the rule if it has no value, or the first operand
+// without value if the path is an expression. Returns "" if nothing is missing.
+func findMissingPath(r *Rule, vm, ref *k6tv1.VirtualMachine) (string, error) {
+	var paths []string
+	switch {
+	case isJSONPath(r.Path):
+		paths = []string{r.Path}
+	case isExpression(r.Path):
+		e, err := compiledExpression(r.param(r.Path))
+		if err != nil {
+			return "", err
+		}
+		for _, path := range e.Paths() {
+			paths = append(paths, exprPath(path))
+		}
+	}
+	for _, path := range paths {
+		values, err := findPresentValues(path, vm, ref)
+		if err != nil {
+			return "", err
+		}
+		if len(values) == 0 {
+			return path, nil
+		}
+	}
+	return "", nil
+}
+
+// fails tells if the rule must fail without looking any further.
+func (mv missingValue) fails() bool {
+	return mv.Missing && mv.Policy == OnMissingFail
+}
+
+func (mv missingValue) describe() string {
+	path := TrimJSONPath(mv.Path)
+	switch mv.Policy {
+	case OnMissingFail:
+		return fmt.Sprintf("no value set at %s", path)
+	case OnMissingDefault:
+		return fmt.Sprintf("no value set at %s, using the default %v", path, mv.Default)
+	}
+	return fmt.Sprintf("no value set at %s, using the zero value", path)
+}
+
+// annotate makes clear in the message of a rule that its value was missing, if so.
+func (mv missingValue) annotate(message string) string {
+	if !mv.Missing {
+		return message
+	}
+	if mv.fails() {
+		return mv.describe()
+	}
+	return fmt.Sprintf("%s (%s)", message, mv.describe())
+}
@@ -0,0 +1,193 @@
+package validation_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	k6tv1 "kubevirt.io/client-go/api/v1"
+
+	k6tobjs "github.com/kubevirt/kubevirt-template-validator/pkg/kubevirtobjs"
+	"github.com/kubevirt/kubevirt-template-validator/pkg/validation"
+)
+
+var _ = Describe("OnMissing", func() {
+	var (
+		vmCirros *k6tv1.VirtualMachine
+		vmRef    *k6tv1.VirtualMachine
+	)
+
+	BeforeEach(func() {
+		vmCirros = NewVMCirros()
+		vmRef = k6tobjs.NewDefaultVirtualMachine()
+	})
+
+	newGuestMemoryRule := func(onMissing string, def interface{}) *validation.Rule {
+		return &validation.Rule{
+			Rule:      "quantity",
+			Name:      "minimal-guest-memory",
+			Path:      "jsonpath::.spec.domain.memory.guest",
+			Message:   "the guest needs at least 64Mi of memory",
+			Min:       "64Mi",
+			OnMissing: onMissing,
+			Default:   def,
+		}
+	}
+
+	applyRule := func(r *validation.Rule) (bool, string) {
+		ra, err := r.Specialize(vmCirros, vmRef)
+		Expect(err).ToNot(HaveOccurred())
+		ok, err := ra.Apply(vmCirros, vmRef)
+		Expect(err).ToNot(HaveOccurred())
+		return ok, ra.String()
+	}
+
+	It("Should tell when the zero value is used", func() {
+		ok, message := applyRule(newGuestMemoryRule("", nil))
+		Expect(ok).To(BeFalse())
+		Expect(message).To(Equal("value 0 is lower than minimum [64Mi] (no value set at .spec.domain.memory.guest, using the zero value)"))
+	})
+
+	It("Should tell when the zero value is used for a nil leaf", func() {
+		vmCirros.Spec.Template.Spec.Domain.Memory = &k6tv1.Memory{}
+		ok, message := applyRule(newGuestMemoryRule("", nil))
+		Expect(ok).To(BeFalse())
+		Expect(message).To(Equal("value 0 is lower than minimum [64Mi] (no value set at .spec.domain.memory.guest, using the zero value)"))
+
+		ok, message = applyRule(newGuestMemoryRule("default", "128Mi"))
+		Expect(ok).To(BeTrue())
+		Expect(message).To(HaveSuffix("(no value set at .spec.domain.memory.guest, using the default 128Mi)"))
+
+		rules := []validation.Rule{*newGuestMemoryRule("skip", nil)}
+		res := validation.NewEvaluator().Evaluate(rules, vmCirros)
+		Expect(res.Succeeded()).To(BeTrue())
+		Expect(res.Status[0].Skipped).To(BeTrue())
+	})
+
+	It("Should skip the rule", func() {
+		rules := []validation.Rule{*newGuestMemoryRule("skip", nil)}
+		res := validation.NewEvaluator().Evaluate(rules, vmCirros)
+		Expect(res.Succeeded()).To(BeTrue())
+		Expect(res.Status).To(HaveLen(1))
+		Expect(res.Status[0].Skipped).To(BeTrue())
+	})
+
+	It("Should fail the rule", func() {
+		ok, message := applyRule(newGuestMemoryRule("fail", nil))
+		Expect(ok).To(BeFalse())
+		Expect(message).To(Equal("no value set at .spec.domain.memory.guest"))
+	})
+
+	It("Should use the default value", func() {
+		ok, message := applyRule(newGuestMemoryRule("default", "128Mi"))
+		Expect(ok).To(BeTrue())
+		Expect(message).To(HaveSuffix("(no value set at .spec.domain.memory.guest, using the default 128Mi)"))
+
+		ok, _ = applyRule(newGuestMemoryRule("default", "32Mi"))
+		Expect(ok).To(BeFalse())
+	})
+
+	It("Should check the values which are set", func() {
+		guest := resource.MustParse("32Mi")
+		vmCirros.Spec.Template.Spec.Domain.Memory = &k6tv1.Memory{Guest: &guest}
+		for _, onMissing := range []string{"skip", "fail"} {
+			ok, message := applyRule(newGuestMemoryRule(onMissing, nil))
+			Expect(ok).To(BeFalse())
+			Expect(message).To(Equal("value 32Mi is lower than minimum [64Mi]"))
+		}
+	})
+
+	It("Should apply to strings and booleans", func() {
+		r := validation.Rule{
+			Rule:      "enum",
+			Name:      "machine-type",
+			Path:      "jsonpath::.spec.domain.machine.type",
+			Message:   "unsupported machine type",
+			Values:    []string{"q35"},
+			OnMissing: "default",
+			Default:   "q35",
+		}
+		ok, _ := applyRule(&r)
+		Expect(ok).To(BeTrue())
+
+		r = validation.Rule{
+			Rule:      "bool",
+			Name:      "dedicated-cpus",
+			Path:      "jsonpath::.spec.domain.cpu.dedicatedCpuPlacement",
+			Message:   "dedicated CPUs are required",
+			OnMissing: "default",
+			Default:   false,
+		}
+		ok, message := applyRule(&r)
+		Expect(ok).To(BeFalse())
+		Expect(message).To(HaveSuffix("(no value set at .spec.domain.cpu.dedicatedCpuPlacement, using the default false)"))
+	})
+
+	It("Should judge the empty strings", func() {
+		vmCirros.Spec.Template.Spec.Domain.Machine.Type = ""
+		r := validation.Rule{
+			Rule:      "enum",
+			Name:      "machine-type",
+			Path:      "jsonpath::.spec.domain.machine.type",
+			Message:   "unsupported machine type",
+			Values:    []string{"q35"},
+			OnMissing: "default",
+			Default:   "q35",
+		}
+		ok, message := applyRule(&r)
+		Expect(ok).To(BeFalse())
+		Expect(message).ToNot(ContainSubstring("no value set"))
+
+		r.OnMissing = "fail"
+		r.Default = nil
+		ok, message = applyRule(&r)
+		Expect(ok).To(BeFalse())
+		Expect(message).ToNot(ContainSubstring("no value set"))
+	})
+
+	It("Should apply the policies to the operands of the expressions", func() {
+		newRule := func(onMissing string, def interface{}) *validation.Rule {
+			r := newGuestMemoryRule(onMissing, def)
+			r.Path = "expr::{.spec.domain.memory.guest} * 2"
+			return r
+		}
+
+		ok, message := applyRule(newRule("", nil))
+		Expect(ok).To(BeFalse())
+		Expect(message).To(HaveSuffix("(no value set at .spec.domain.memory.guest, using the zero value)"))
+
+		ok, message = applyRule(newRule("fail", nil))
+		Expect(ok).To(BeFalse())
+		Expect(message).To(Equal("no value set at .spec.domain.memory.guest"))
+
+		ok, _ = applyRule(newRule("default", "128Mi"))
+		Expect(ok).To(BeTrue())
+
+		res := validation.NewEvaluator().Evaluate([]validation.Rule{*newRule("skip", nil)}, vmCirros)
+		Expect(res.Succeeded()).To(BeTrue())
+		Expect(res.Status[0].Skipped).To(BeTrue())
+		Expect(res.Status[0].SkipReason).To(Equal("no value set at .spec.domain.memory.guest"))
+	})
+
+	It("Should lint the policies", func() {
+		r := newGuestMemoryRule("ignore", nil)
+		issues := validation.LintRules([]validation.Rule{*r})
+		Expect(issues).To(HaveLen(1))
+		Expect(issues[0].Key).To(Equal("onMissing"))
+
+		r = newGuestMemoryRule("default", nil)
+		issues = validation.LintRules([]validation.Rule{*r})
+		Expect(issues).To(HaveLen(1))
+		Expect(issues[0].Key).To(Equal("default"))
+
+		r = newGuestMemoryRule("fail", "128Mi")
+		issues = validation.LintRules([]validation.Rule{*r})
+		Expect(issues).To(HaveLen(1))
+		Expect(issues[0].Key).To(Equal("default"))
+
+		r = newGuestMemoryRule("default", "jsonpath::.spec.domain.resources.requests.memory")
+		issues = validation.LintRules([]validation.Rule{*r})
+		Expect(issues).To(HaveLen(1))
+		Expect(issues[0].Key).To(Equal("default"))
+	})
+})
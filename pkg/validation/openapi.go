@@ -0,0 +1,214 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2019 Red Hat, Inc.
+ */
+
+package validation
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/go-openapi/spec"
+	"k8s.io/client-go/util/jsonpath"
+	"k8s.io/kube-openapi/pkg/common"
+
+	k6tv1 "kubevirt.io/client-go/api/v1"
+)
+
+// The rule paths are checked against the OpenAPI schema of the KubeVirt types,
+// to catch the typos which would otherwise silently resolve on the reference VM.
+
+const (
+	// the roots of the rule paths, see pathRoots
+	schemaRootTemplate string = "kubevirt.io/client-go/api/v1.VirtualMachineInstanceTemplateSpec"
+	schemaRootVM       string = "kubevirt.io/client-go/api/v1.VirtualMachine"
+	schemaRootMetadata string = "k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"
+	schemaQuantity     string = "k8s.io/apimachinery/pkg/api/resource.Quantity"
+	schemaIntOrString  string = "k8s.io/apimachinery/pkg/util/intstr.IntOrString"
+)
+
+var (
+	openAPIDefsOnce sync.Once
+	openAPIDefs     map[string]common.OpenAPIDefinition
+)
+
+func getOpenAPIDefinitions() map[string]common.OpenAPIDefinition {
+	openAPIDefsOnce.Do(func() {
+		openAPIDefs = k6tv1.GetOpenAPIDefinitions(func(path string) spec.Ref {
+			return spec.MustCreateRef(path)
+		})
+	})
+	return openAPIDefs
+}
+
+// schemaNode is a schema together with the name of its definition, if any.
+type schemaNode struct {
+	name   string
+	schema *spec.Schema
+}
+
+func resolveSchema(s *spec.Schema) schemaNode {
+	ref := s.Ref.String()
+	if ref == "" {
+		return schemaNode{schema: s}
+	}
+	def, ok := getOpenAPIDefinitions()[ref]
+	if !ok {
+		// unknown definition: we can't check any further
+		return schemaNode{name: ref}
+	}
+	return schemaNode{name: ref, schema: &def.Schema}
+}
+
+func (sn schemaNode) isType(t string) bool {
+	return sn.schema != nil && sn.schema.Type.Contains(t)
+}
+
+// describe returns a human-friendly representation of the type of the schema
+func (sn schemaNode) describe() string {
+	if sn.name != "" {
+		return sn.name[strings.LastIndex(sn.name, ".")+1:]
+	}
+	if sn.schema != nil && len(sn.schema.Type) > 0 {
+		return strings.Join(sn.schema.Type, "|")
+	}
+	return "unknown"
+}
+
+// checkSchemaPath checks that the given rule path exists in the schema of its root, e.g. the VM template.
+// Returns the schema of the value the path points to, or nil if it can't be told
+// (e.g. wildcards, recursive descent, free-form objects).
+func checkSchemaPath(path string) (*schemaNode, error) {
+	root, expr := splitPath(path)
+	parser, err := jsonpath.Parse(path, fmt.Sprintf("{%s}", expr))
+	if err != nil {
+		return nil, err
+	}
+	def, ok := getOpenAPIDefinitions()[root.schema]
+	if !ok {
+		return nil, nil
+	}
+	cur := &schemaNode{name: root.schema, schema: &def.Schema}
+	walked := ""
+	for _, node := range parser.Root.Nodes {
+		list, ok := node.(*jsonpath.ListNode)
+		if !ok {
+			continue
+		}
+		cur, walked, err = walkSchema(cur, list, walked)
+		if err != nil || cur == nil {
+			return nil, err
+		}
+	}
+	return cur, nil
+}
+
+func walkSchema(cur *schemaNode, list *jsonpath.ListNode, walked string) (*schemaNode, string, error) {
+	for _, node := range list.Nodes {
+		if cur == nil || cur.schema == nil {
+			return nil, walked, nil
+		}
+		switch n := node.(type) {
+		case *jsonpath.ListNode:
+			var err error
+			cur, walked, err = walkSchema(cur, n, walked)
+			if err != nil {
+				return nil, walked, err
+			}
+		case *jsonpath.FieldNode:
+			if n.Value == "" {
+				// the root "$" or "@"
+				continue
+			}
+			next, err := schemaField(*cur, n.Value)
+			if err != nil {
+				return nil, walked, fmt.Errorf("%s: %v", pathOrRoot(walked), err)
+			}
+			walked = walked + "." + n.Value
+			cur = next
+		case *jsonpath.ArrayNode, *jsonpath.FilterNode:
+			if !cur.isType("array") {
+				return nil, walked, fmt.Errorf("%s: cannot index %s, not an array", pathOrRoot(walked), cur.describe())
+			}
+			if cur.schema.Items == nil || cur.schema.Items.Schema == nil {
+				return nil, walked, nil
+			}
+			walked = walked + "[]"
+			next := resolveSchema(cur.schema.Items.Schema)
+			cur = &next
+		default:
+			// wildcards, recursive descents, unions: give up checking
+			return nil, walked, nil
+		}
+	}
+	return cur, walked, nil
+}
+
+func schemaField(cur schemaNode, field string) (*schemaNode, error) {
+	if prop, ok := cur.schema.Properties[field]; ok {
+		next := resolveSchema(&prop)
+		return &next, nil
+	}
+	if cur.schema.AdditionalProperties != nil {
+		if cur.schema.AdditionalProperties.Schema == nil {
+			return nil, nil
+		}
+		next := resolveSchema(cur.schema.AdditionalProperties.Schema)
+		return &next, nil
+	}
+	if !cur.isType("object") {
+		return nil, fmt.Errorf("cannot access field %q of %s, not an object", field, cur.describe())
+	}
+	if len(cur.schema.Properties) == 0 {
+		// free-form object
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unknown field %q in %s", field, cur.describe())
+}
+
+func pathOrRoot(walked string) string {
+	if walked == "" {
+		return "."
+	}
+	return walked
+}
+
+// isCompatibleSchema tells if values of the given schema can be checked by a rule type.
+// Types which can't be told are always compatible.
+func isCompatibleSchema(ruleType string, sn *schemaNode) bool {
+	if sn == nil || sn.schema == nil {
+		return true
+	}
+	isNumeric := sn.isType("integer") || sn.isType("number")
+	isQuantity := sn.name == schemaQuantity || sn.name == schemaIntOrString
+	switch ruleType {
+	case "integer":
+		return isNumeric || isQuantity
+	case "quantity":
+		return isNumeric || isQuantity
+	case "string", "regex", "enum", ruleFormat:
+		return sn.isType("string") || isQuantity
+	case "bool":
+		return sn.isType("boolean")
+	case ruleForEach:
+		return sn.isType("array")
+	case ruleTransition:
+		return sn.isType("string") || sn.isType("boolean") || isNumeric || isQuantity
+	}
+	return true
+}
@@ -0,0 +1,266 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2019 Red Hat, Inc.
+ */
+
+package validation
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// The rules can be either a bare list (the original format), or a versioned document:
+//   apiVersion: validation.kubevirt.io/v1alpha1
+//   rules:
+//   - name: ...
+// Both JSON and YAML are accepted. The JSON Schema of the document is published in
+// api/validations.schema.json.
+// Unknown keys are rejected, because a misspelled key would silently disable a check.
+// The VM admission is lenient instead, see CompileRulesLenient: by then, the rules were checked
+// when the template was admitted, and rejecting the VMs would not help their users.
+
+const (
+	RulesAPIVersion string = "validation.kubevirt.io/v1alpha1"
+)
+
+// ParseError reports where a problem was found in the rules.
+type ParseError struct {
+	Location string // e.g. rules[1].rules[0]
+	Name     string
+	Key      string
+	Message  string
+}
+
+func (e *ParseError) Error() string {
+	return formatIssue(e.Location, e.Name, e.Key, e.Message)
+}
+
+func formatIssue(location, name, key, message string) string {
+	var sb strings.Builder
+	sb.WriteString(location)
+	if name != "" {
+		fmt.Fprintf(&sb, " (%s)", name)
+	}
+	if key != "" {
+		fmt.Fprintf(&sb, " %s", key)
+	}
+	fmt.Fprintf(&sb, ": %s", message)
+	return sb.String()
+}
+
+type rulesDocument struct {
+	APIVersion string            `json:"apiVersion"`
+	Rules      []json.RawMessage `json:"rules"`
+}
+
+// toJSON converts YAML to JSON. JSON is returned unchanged, to preserve the error offsets.
+func toJSON(data []byte) ([]byte, error) {
+	if json.Valid(data) {
+		return data, nil
+	}
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && (trimmed[0] == '[' || trimmed[0] == '{') {
+		// looks like JSON, so report JSON errors
+		var obj interface{}
+		return nil, jsonSyntaxError(data, json.Unmarshal(data, &obj))
+	}
+	ret, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, &ParseError{Location: "rules", Message: err.Error()}
+	}
+	return ret, nil
+}
+
+func jsonSyntaxError(data []byte, err error) error {
+	if se, ok := err.(*json.SyntaxError); ok {
+		line := bytes.Count(data[:se.Offset], []byte("\n")) + 1
+		col := int(se.Offset) - bytes.LastIndexByte(data[:se.Offset], '\n') - 1
+		return &ParseError{Location: "rules", Message: fmt.Sprintf("line %d, column %d: %v", line, col, err)}
+	}
+	return &ParseError{Location: "rules", Message: err.Error()}
+}
+
+// splitRules returns the raw rules of a document, in either format. If strict, unknown keys are rejected.
+func splitRules(data []byte, strict bool) ([]json.RawMessage, error) {
+	data, err := toJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 || string(trimmed) == "null" {
+		return nil, nil
+	}
+
+	if trimmed[0] == '[' {
+		var items []json.RawMessage
+		if err := json.Unmarshal(trimmed, &items); err != nil {
+			return nil, &ParseError{Location: "rules", Message: err.Error()}
+		}
+		return items, nil
+	}
+
+	doc := rulesDocument{}
+	dec := json.NewDecoder(bytes.NewReader(trimmed))
+	if strict {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, &ParseError{Location: "document", Message: decodeErrorMessage(err)}
+	}
+	if doc.APIVersion != RulesAPIVersion {
+		return nil, &ParseError{Location: "document", Key: "apiVersion", Message: fmt.Sprintf("unsupported version %q, expected %q", doc.APIVersion, RulesAPIVersion)}
+	}
+	return doc.Rules, nil
+}
+
+// parseRules decodes the rules. If strict, unknown keys are rejected.
+func parseRules(data []byte, strict bool) ([]Rule, error) {
+	items, err := splitRules(data, strict)
+	if err != nil {
+		return nil, err
+	}
+	return parseRuleList("rules", items, strict)
+}
+
+func parseRuleList(loc string, items []json.RawMessage, strict bool) ([]Rule, error) {
+	var rules []Rule
+	for i, item := range items {
+		r, err := parseRule(fmt.Sprintf("%s[%d]", loc, i), item, strict)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+func parseRule(loc string, data json.RawMessage, strict bool) (Rule, error) {
+	r := Rule{}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return r, &ParseError{Location: loc, Message: decodeErrorMessage(err)}
+	}
+	var name string
+	json.Unmarshal(fields["name"], &name)
+
+	if strict {
+		if keys := unknownRawKeys(fields, reflect.TypeOf(r)); len(keys) > 0 {
+			return r, &ParseError{Location: loc, Name: name, Key: keys[0], Message: "unknown key"}
+		}
+	}
+
+	// the nested objects are decoded separately, to report their position
+	nested, hasNested := fields["rules"]
+	delete(fields, "rules")
+	conds, hasConds := fields["when"]
+	delete(fields, "when")
+
+	rest, err := json.Marshal(fields)
+	if err != nil {
+		return r, &ParseError{Location: loc, Name: name, Message: err.Error()}
+	}
+	if err := json.Unmarshal(rest, &r); err != nil {
+		return r, &ParseError{Location: loc, Name: name, Key: decodeErrorKey(err), Message: decodeErrorMessage(err)}
+	}
+
+	if hasConds {
+		var items []json.RawMessage
+		if err := json.Unmarshal(conds, &items); err != nil {
+			return r, &ParseError{Location: loc, Name: name, Key: "when", Message: decodeErrorMessage(err)}
+		}
+		for i, item := range items {
+			key := fmt.Sprintf("when[%d]", i)
+			c := Condition{}
+			dec := json.NewDecoder(bytes.NewReader(item))
+			if strict {
+				dec.DisallowUnknownFields()
+			}
+			if err := dec.Decode(&c); err != nil {
+				if k := decodeErrorKey(err); k != "" {
+					key = key + "." + k
+				}
+				return r, &ParseError{Location: loc, Name: name, Key: key, Message: decodeErrorMessage(err)}
+			}
+			r.When = append(r.When, c)
+		}
+	}
+
+	if hasNested {
+		var items []json.RawMessage
+		if err := json.Unmarshal(nested, &items); err != nil {
+			return r, &ParseError{Location: loc, Name: name, Key: "rules", Message: decodeErrorMessage(err)}
+		}
+		r.Rules, err = parseRuleList(loc+".rules", items, strict)
+		if err != nil {
+			return r, err
+		}
+	}
+	return r, nil
+}
+
+func unknownRawKeys(fields map[string]json.RawMessage, t reflect.Type) []string {
+	known := jsonKeys(t)
+	var ret []string
+	for key := range fields {
+		if !known[key] {
+			ret = append(ret, key)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// jsonKeys returns the JSON keys of the fields of the struct type t
+func jsonKeys(t reflect.Type) map[string]bool {
+	known := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		tag := t.Field(i).Tag.Get("json")
+		if name := strings.Split(tag, ",")[0]; name != "" && name != "-" {
+			known[name] = true
+		}
+	}
+	return known
+}
+
+func decodeErrorKey(err error) string {
+	switch e := err.(type) {
+	case *json.UnmarshalTypeError:
+		return e.Field
+	}
+	const unknownFieldPrefix = "json: unknown field "
+	if msg := err.Error(); strings.HasPrefix(msg, unknownFieldPrefix) {
+		return strings.Trim(strings.TrimPrefix(msg, unknownFieldPrefix), `"`)
+	}
+	return ""
+}
+
+func decodeErrorMessage(err error) string {
+	switch e := err.(type) {
+	case *json.UnmarshalTypeError:
+		return fmt.Sprintf("expected %s, found %s", e.Type, e.Value)
+	}
+	if strings.HasPrefix(err.Error(), "json: unknown field ") {
+		return "unknown key"
+	}
+	return strings.TrimPrefix(err.Error(), "json: ")
+}
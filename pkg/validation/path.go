@@ -21,6 +21,7 @@ package validation
 import (
 	"fmt"
 	"reflect"
+	"strconv"
 	"strings"
 
 	"k8s.io/apimachinery/pkg/api/resource"
@@ -33,12 +34,53 @@ var (
 	ErrInvalidJSONPath = fmt.Errorf("invalid JSONPath")
 )
 
+// The paths of the rules start with a prefix telling where they are rooted in the VM.
+// The expression following the prefix is either a JSONPath, e.g. ".spec.domain.cpu.cores",
+// or a JSON Pointer, e.g. "/spec/domain/cpu/cores".
 const (
-	JSONPathPrefix string = "jsonpath::"
+	JSONPathPrefix     string = "jsonpath::" // relative to the VM spec.template
+	VMPathPrefix       string = "vm::"       // relative to the whole VM
+	MetadataPathPrefix string = "metadata::" // relative to the VM metadata
+
+	maxParsedPaths int = 1024
 )
 
+type pathRoot struct {
+	prefix string
+	base   string // the JSONPath of the root in the VM
+	schema string // the OpenAPI definition of the root
+}
+
+var pathRoots = []pathRoot{
+	{prefix: JSONPathPrefix, base: ".spec.template", schema: schemaRootTemplate},
+	{prefix: VMPathPrefix, base: "", schema: schemaRootVM},
+	{prefix: MetadataPathPrefix, base: ".metadata", schema: schemaRootMetadata},
+}
+
+// parsedPaths caches the parsed JSONPaths, because the same rules are evaluated over and over.
+var parsedPaths = mustNewLRU(maxParsedPaths)
+
+func findPathRoot(s string) (pathRoot, bool) {
+	for _, root := range pathRoots {
+		if strings.HasPrefix(s, root.prefix) {
+			return root, true
+		}
+	}
+	return pathRoot{}, false
+}
+
 func isJSONPath(s string) bool {
-	return strings.HasPrefix(s, JSONPathPrefix)
+	_, ok := findPathRoot(s)
+	return ok
+}
+
+// describePathPrefixes returns the path prefixes, for the error messages.
+func describePathPrefixes() string {
+	prefixes := make([]string, len(pathRoots))
+	for i, root := range pathRoots {
+		prefixes[i] = strconv.Quote(root.prefix)
+	}
+	return strings.Join(prefixes, ", ")
 }
 
 type Path struct {
@@ -46,21 +88,59 @@ type Path struct {
 	results [][]reflect.Value
 }
 
-func TrimJSONPath(path string) string {
-	s := strings.TrimPrefix(path, JSONPathPrefix)
+// splitPath returns the root of the path and its expression, as a JSONPath relative to the root.
+func splitPath(path string) (pathRoot, string) {
+	root, _ := findPathRoot(path)
+	expr := strings.TrimPrefix(path, root.prefix)
+	if strings.HasPrefix(expr, "/") {
+		return root, pointerToJSONPath(expr)
+	}
 	// we always need to interpret the user-supplied path as relative path
-	return strings.TrimPrefix(s, "$")
+	return root, strings.TrimPrefix(expr, "$")
+}
+
+// pointerToJSONPath turns a JSON Pointer (RFC 6901) into the equivalent JSONPath,
+// e.g. "/metadata/labels/kubevirt.io~1os" into ".metadata.labels.kubevirt\.io/os".
+func pointerToJSONPath(pointer string) string {
+	var sb strings.Builder
+	for _, token := range strings.Split(pointer, "/")[1:] {
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+		if _, err := strconv.Atoi(token); err == nil {
+			fmt.Fprintf(&sb, "[%s]", token)
+			continue
+		}
+		sb.WriteString(".")
+		sb.WriteString(strings.Replace(token, ".", "\\.", -1))
+	}
+	return sb.String()
+}
+
+// TrimJSONPath returns the expression of the path, as a JSONPath. The prefixes of the paths
+// not rooted at the VM spec.template are kept, because the expression alone would be ambiguous.
+func TrimJSONPath(path string) string {
+	root, expr := splitPath(path)
+	if root.prefix == JSONPathPrefix {
+		return expr
+	}
+	return root.prefix + expr
 }
 
 func NewJSONPathFromString(path string) (string, error) {
 	if !isJSONPath(path) {
 		return "", ErrInvalidJSONPath
 	}
-	expr := TrimJSONPath(path)
-	return fmt.Sprintf("{.spec.template%s}", expr), nil
+	root, expr := splitPath(path)
+	return fmt.Sprintf("{%s%s}", root.base, expr), nil
 }
 
 func NewPath(expr string) (*Path, error) {
+	if cached, ok := parsedPaths.Get(expr); ok {
+		// the parsed tree is never modified, so we can share it, but the
+		// JSONPath object itself holds the evaluation state, so it can't be shared.
+		jp := *cached.(*jsonpath.JSONPath)
+		return &Path{jp: &jp}, nil
+	}
+
 	var err error
 	pathExpr, err := NewJSONPathFromString(expr)
 	if err != nil {
@@ -72,7 +152,10 @@ func NewPath(expr string) (*Path, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Path{jp: jp}, nil
+	parsedPaths.Add(expr, jp)
+
+	cp := *jp
+	return &Path{jp: &cp}, nil
 }
 
 func (p *Path) Find(vm *k6tv1.VirtualMachine) error {
@@ -114,7 +197,11 @@ func (p *Path) AsInt64() ([]int64, error) {
 	for i := range p.results {
 		res := p.results[i]
 		for j := range res {
-			obj := res[j].Interface()
+			obj, ok := indirect(res[j])
+			if !ok {
+				// unset optional value
+				continue
+			}
 			if intObj, ok := toInt64(obj); ok {
 				ret = append(ret, intObj)
 				continue
@@ -131,3 +218,96 @@ func (p *Path) AsInt64() ([]int64, error) {
 	}
 	return ret, nil
 }
+
+func (p *Path) AsQuantity() ([]resource.Quantity, error) {
+	var ret []resource.Quantity
+	for i := range p.results {
+		res := p.results[i]
+		for j := range res {
+			obj, ok := indirect(res[j])
+			if !ok {
+				// unset optional value
+				continue
+			}
+			if _, ok := obj.(string); !ok {
+				if quantityObj, ok := toQuantity(obj); ok {
+					ret = append(ret, quantityObj)
+					continue
+				}
+			}
+			return nil, fmt.Errorf("mismatching type: %v, not int or resource.Quantity", res[j].Type().Name())
+		}
+	}
+	return ret, nil
+}
+
+func (p *Path) AsBool() ([]bool, error) {
+	var ret []bool
+	for i := range p.results {
+		res := p.results[i]
+		for j := range res {
+			obj, ok := indirect(res[j])
+			if !ok {
+				// unset optional value
+				continue
+			}
+			if boolObj, ok := toBool(obj); ok {
+				ret = append(ret, boolObj)
+				continue
+			}
+			return nil, fmt.Errorf("mismatching type: %v, not bool", res[j].Type().Name())
+		}
+	}
+	return ret, nil
+}
+
+// indirect returns the value, dereferencing pointers. Nil pointers are not values.
+func indirect(val reflect.Value) (interface{}, bool) {
+	for val.Kind() == reflect.Ptr {
+		if val.IsNil() {
+			return nil, false
+		}
+		if _, ok := val.Interface().(*resource.Quantity); ok {
+			break
+		}
+		val = val.Elem()
+	}
+	return val.Interface(), true
+}
+
+// hasOnlyNilLeaves tells if values were found, but none of them is actually set.
+func (p *Path) hasOnlyNilLeaves() bool {
+	return p.Len() > 0 && len(p.presentValues()) == 0
+}
+
+// CountPresent returns how many of the values found are actually set, see isSet.
+func (p *Path) CountPresent() int {
+	return len(p.setValues())
+}
+
+// isPresent tells if the value found by the JSONPath lookup is a value the rules can judge:
+// only nil pointers and nil interfaces are missing, an empty string is a value.
+func isPresent(val reflect.Value) bool {
+	if !val.IsValid() {
+		return false
+	}
+	switch val.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return !val.IsNil()
+	}
+	return true
+}
+
+// isSet is stricter than isPresent: empty strings, slices or maps are not set either,
+// because a string field omitted from the VM decodes as "". The presence rules and
+// the conditions use this, since they tell if a field is set rather than judging its value.
+func isSet(val reflect.Value) bool {
+	if !isPresent(val) {
+		return false
+	}
+	switch val.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map:
+		return val.Len() > 0
+	}
+	return true
+}
@@ -6,6 +6,7 @@ import (
 
 	k6tv1 "kubevirt.io/client-go/api/v1"
 
+	k6tobjs "github.com/kubevirt/kubevirt-template-validator/pkg/kubevirtobjs"
 	"github.com/kubevirt/kubevirt-template-validator/pkg/validation"
 )
 
@@ -101,6 +102,34 @@ var _ = Describe("Path", func() {
 			Expect(vals[0]).To(BeNumerically(">", 1024))
 		})
 
+		It("Should provide some quantity results", func() {
+			s := "jsonpath::.spec.domain.resources.requests.memory"
+			p, err := validation.NewPath(s)
+			Expect(p).To(Not(BeNil()))
+			Expect(err).To(BeNil())
+
+			err = p.Find(vmCirros)
+			Expect(err).To(BeNil())
+
+			vals, err := p.AsQuantity()
+			Expect(err).To(BeNil())
+			Expect(len(vals)).To(Equal(1))
+			Expect(vals[0].String()).To(Equal("128M"))
+		})
+
+		It("Should not provide quantity results from strings", func() {
+			s := "jsonpath::.spec.domain.machine.type"
+			p, err := validation.NewPath(s)
+			Expect(p).To(Not(BeNil()))
+			Expect(err).To(BeNil())
+
+			err = p.Find(vmCirros)
+			Expect(err).To(BeNil())
+
+			_, err = p.AsQuantity()
+			Expect(err).To(HaveOccurred())
+		})
+
 		It("Should provide some string results", func() {
 			s := "jsonpath::.spec.domain.machine.type"
 			p, err := validation.NewPath(s)
@@ -132,4 +161,145 @@ var _ = Describe("Path", func() {
 		})
 		*/
 	})
+
+	Context("With path roots", func() {
+
+		var (
+			vmCirros *k6tv1.VirtualMachine
+			vmRef    *k6tv1.VirtualMachine
+		)
+
+		BeforeEach(func() {
+			vmCirros = NewVMCirros()
+			vmRef = k6tobjs.NewDefaultVirtualMachine()
+		})
+
+		applyRule := func(r *validation.Rule) (bool, error) {
+			ra, err := r.Specialize(vmCirros, vmRef)
+			Expect(err).ToNot(HaveOccurred())
+			return ra.Apply(vmCirros, vmRef)
+		}
+
+		It("Should mangle the paths of each root", func() {
+			testPaths := map[string]string{
+				"vm::.spec.running":                         "{.spec.running}",
+				"metadata::.labels":                         "{.metadata.labels}",
+				"jsonpath::/spec/domain/devices/disks/0":    "{.spec.template.spec.domain.devices.disks[0]}",
+				"metadata::/labels/kubevirt.io~1vm":         `{.metadata.labels.kubevirt\.io/vm}`,
+				"vm::/metadata/annotations/a~0b":            "{.metadata.annotations.a~b}",
+				"vm::$.spec.template.spec.domain.cpu.cores": "{.spec.template.spec.domain.cpu.cores}",
+			}
+			for s, expected := range testPaths {
+				p, err := validation.NewJSONPathFromString(s)
+				Expect(err).To(BeNil())
+				Expect(p).To(Equal(expected))
+			}
+		})
+
+		It("Should check the VM metadata and spec", func() {
+			ok, err := applyRule(&validation.Rule{
+				Rule:    "enum",
+				Name:    "vm-label",
+				Path:    "metadata::/labels/kubevirt.io~1vm",
+				Message: "unexpected VM label",
+				Values:  []string{"vm-cirros"},
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ok).To(BeTrue())
+
+			ok, err = applyRule(&validation.Rule{
+				Rule:    "bool",
+				Name:    "not-running",
+				Path:    "vm::.spec.running",
+				Message: "the VM must not be started",
+				Value:   false,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ok).To(BeTrue())
+		})
+
+		It("Should tell missing keys apart from bogus paths", func() {
+			ok, err := applyRule(&validation.Rule{
+				Rule:    "required",
+				Name:    "os-label",
+				Path:    "metadata::.labels.os",
+				Message: "the os label is required",
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ok).To(BeFalse())
+
+			_, err = applyRule(&validation.Rule{
+				Rule:    "required",
+				Name:    "os-label",
+				Path:    "metadata::.lables.os",
+				Message: "the os label is required",
+			})
+			Expect(err).To(Equal(validation.ErrInvalidJSONPath))
+		})
+
+		It("Should report the fields from the root of the VM", func() {
+			rules := []validation.Rule{{
+				Rule:    "required",
+				Name:    "os-label",
+				Path:    "metadata::.labels.os",
+				Message: "the os label is required",
+			}, {
+				Rule:    "bool",
+				Name:    "running",
+				Path:    "vm::.spec.running",
+				Message: "the VM must be started",
+				Value:   true,
+			}}
+			causes := validation.NewEvaluator().Evaluate(rules, vmCirros).Causes()
+			Expect(causes).To(HaveLen(2))
+			Expect(causes[0].Field).To(Equal("metadata.labels.os"))
+			Expect(causes[1].Field).To(Equal("spec.running"))
+		})
+
+		It("Should keep the roots of the nested rules", func() {
+			vmCirros.Spec.DataVolumeTemplates = []k6tv1.DataVolumeTemplateSpec{{}, {}}
+			vmCirros.Spec.DataVolumeTemplates[1].Name = "rootdisk"
+			rules := []validation.Rule{{
+				Rule:    "forEach",
+				Name:    "data-volumes",
+				Path:    "vm::.spec.dataVolumeTemplates",
+				Message: "invalid data volume templates",
+				Rules: []validation.Rule{{
+					Rule:    "required",
+					Name:    "data-volume-name",
+					Path:    "jsonpath::.metadata.name",
+					Message: "the data volume templates need a name",
+				}, {
+					Rule:    "required",
+					Name:    "vm-name",
+					Path:    "metadata::.name",
+					Message: "the VM needs a name",
+				}},
+			}}
+			causes := validation.NewEvaluator().Evaluate(rules, vmCirros).Causes()
+			Expect(causes).To(HaveLen(1))
+			Expect(causes[0].Field).To(Equal("spec.dataVolumeTemplates[0].metadata.name"))
+		})
+
+		It("Should lint the paths of each root", func() {
+			issues := validation.LintRules([]validation.Rule{{
+				Rule:    "required",
+				Name:    "vm-running",
+				Path:    "vm::.spec.runing",
+				Message: "the VM must be started",
+			}})
+			Expect(issues).To(HaveLen(1))
+			Expect(issues[0].Key).To(Equal("path"))
+
+			issues = validation.LintRules([]validation.Rule{{
+				Rule:    "integer",
+				Name:    "os-label",
+				Path:    "metadata::/labels/os",
+				Message: "the os label is required",
+				Min:     1,
+			}})
+			Expect(issues).To(HaveLen(1))
+			Expect(issues[0].Key).To(Equal("path"))
+		})
+	})
 })
@@ -0,0 +1,118 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2019 Red Hat, Inc.
+ */
+
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// A path may yield many values (e.g. ".spec.domain.devices.disks[*].disk.bus").
+// The quantifier tells how many of them must satisfy the rule:
+// - "all": every value (the default)
+// - "any": at least one value
+// - "none": no value
+// - "exactly-N": exactly N values, e.g. "exactly-1"
+// The presence rules are the exception: "required" defaults to "any", because any value
+// found is enough, and "forbidden" checks that "all" the values are missing.
+
+const (
+	QuantifierAll     string = "all"
+	QuantifierAny     string = "any"
+	QuantifierNone    string = "none"
+	QuantifierExactly string = "exactly-"
+)
+
+var (
+	ErrInvalidQuantifier = errors.New("unrecognized Rule quantifier")
+)
+
+type quantifier struct {
+	kind string
+	n    int // exactly-N only
+}
+
+func parseQuantifier(s, fallback string) (quantifier, error) {
+	if s == "" {
+		s = fallback
+	}
+	switch s {
+	case QuantifierAll, QuantifierAny, QuantifierNone:
+		return quantifier{kind: s}, nil
+	}
+	if strings.HasPrefix(s, QuantifierExactly) {
+		n, err := strconv.Atoi(strings.TrimPrefix(s, QuantifierExactly))
+		if err == nil && n >= 0 {
+			return quantifier{kind: QuantifierExactly, n: n}, nil
+		}
+	}
+	return quantifier{}, fmt.Errorf("%v %q", ErrInvalidQuantifier, s)
+}
+
+func isValidQuantifier(s string) bool {
+	_, err := parseQuantifier(s, QuantifierAll)
+	return err == nil
+}
+
+// getQuantifier returns the quantifier of the rule, defaulting to "all".
+func (r *Rule) getQuantifier() (quantifier, error) {
+	return parseQuantifier(r.Quantifier, QuantifierAll)
+}
+
+// holds tells if matched values out of total satisfy the quantifier
+func (q quantifier) holds(matched, total int) bool {
+	switch q.kind {
+	case QuantifierAny:
+		return matched > 0
+	case QuantifierNone:
+		return matched == 0
+	case QuantifierExactly:
+		return matched == q.n
+	}
+	return matched == total
+}
+
+func (q quantifier) isAll() bool {
+	return q.kind == QuantifierAll
+}
+
+func (q quantifier) String() string {
+	if q.kind == QuantifierExactly {
+		return fmt.Sprintf("%s%d", QuantifierExactly, q.n)
+	}
+	return q.kind
+}
+
+// explain reports how many values matched the predicate, e.g.
+// "1 of [virtio, ide] are in [ide], expected none"
+func (q quantifier) explain(matched int, values, predicate string) string {
+	return fmt.Sprintf("%d of [%s] %s, expected %s", matched, values, predicate, q)
+}
+
+func joinValues(vals interface{}) string {
+	v := reflect.ValueOf(vals)
+	items := make([]string, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		items = append(items, fmt.Sprintf("%v", v.Index(i).Interface()))
+	}
+	return strings.Join(items, ", ")
+}
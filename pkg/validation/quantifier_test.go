@@ -0,0 +1,188 @@
+package validation_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	k6tv1 "kubevirt.io/client-go/api/v1"
+
+	k6tobjs "github.com/kubevirt/kubevirt-template-validator/pkg/kubevirtobjs"
+	"github.com/kubevirt/kubevirt-template-validator/pkg/validation"
+)
+
+var _ = Describe("Quantifiers", func() {
+	var (
+		vmCirros *k6tv1.VirtualMachine
+		vmRef    *k6tv1.VirtualMachine
+	)
+
+	BeforeEach(func() {
+		vmCirros = NewVMCirros()
+		vmRef = k6tobjs.NewDefaultVirtualMachine()
+		devices := &vmCirros.Spec.Template.Spec.Domain.Devices
+		devices.Interfaces = []k6tv1.Interface{
+			{Name: "default", InterfaceBindingMethod: k6tv1.InterfaceBindingMethod{Masquerade: &k6tv1.InterfaceMasquerade{}}},
+			{Name: "secondary", InterfaceBindingMethod: k6tv1.InterfaceBindingMethod{Bridge: &k6tv1.InterfaceBridge{}}},
+		}
+		bootOrder := uint(1)
+		devices.Disks[0].BootOrder = &bootOrder
+	})
+
+	It("Should reject unknown quantifiers", func() {
+		r := validation.Rule{
+			Rule:       "enum",
+			Name:       "disk-bus",
+			Path:       "jsonpath::.spec.domain.devices.disks[*].disk.bus",
+			Message:    "bad quantifier",
+			Values:     []string{"virtio"},
+			Quantifier: "most",
+		}
+		ev := validation.NewEvaluator()
+		res := ev.Evaluate([]validation.Rule{r}, vmCirros)
+		Expect(res.Succeeded()).To(BeFalse())
+		Expect(res.Status[0].Error).To(Equal(validation.ErrInvalidQuantifier))
+
+		for _, q := range []string{"exactly-", "exactly--1", "exactly-one"} {
+			r.Quantifier = q
+			res = ev.Evaluate([]validation.Rule{r}, vmCirros)
+			Expect(res.Status[0].Error).To(Equal(validation.ErrInvalidQuantifier), q)
+		}
+	})
+
+	It("Should check that any value satisfies the rule", func() {
+		r := validation.Rule{
+			Rule:       "required",
+			Name:       "masquerade",
+			Path:       "jsonpath::.spec.domain.devices.interfaces[*].masquerade",
+			Message:    "at least one interface must use masquerade",
+			Quantifier: "any",
+		}
+		expectRuleApplicationSuccess(&r, vmCirros, vmRef)
+
+		vmCirros.Spec.Template.Spec.Domain.Devices.Interfaces[0].Masquerade = nil
+		expectRuleApplicationFailure(&r, vmCirros, vmRef)
+	})
+
+	It("Should check that no value satisfies the rule", func() {
+		r := validation.Rule{
+			Rule:       "enum",
+			Name:       "no-ide",
+			Path:       "jsonpath::.spec.domain.devices.disks[*].disk.bus",
+			Message:    "no disk may use the ide bus",
+			Values:     []string{"ide"},
+			Quantifier: "none",
+		}
+		expectRuleApplicationSuccess(&r, vmCirros, vmRef)
+
+		vmCirros.Spec.Template.Spec.Domain.Devices.Disks[1].Disk.Bus = "ide"
+		expectRuleApplicationFailure(&r, vmCirros, vmRef)
+	})
+
+	It("Should check that exactly N values satisfy the rule", func() {
+		r := validation.Rule{
+			Rule:       "integer",
+			Name:       "first-boot",
+			Path:       "jsonpath::.spec.domain.devices.disks[*].bootOrder",
+			Message:    "exactly one disk has bootOrder 1",
+			Min:        1,
+			Max:        1,
+			Quantifier: "exactly-1",
+		}
+		expectRuleApplicationSuccess(&r, vmCirros, vmRef)
+
+		bootOrder := uint(1)
+		vmCirros.Spec.Template.Spec.Domain.Devices.Disks[1].BootOrder = &bootOrder
+		expectRuleApplicationFailure(&r, vmCirros, vmRef)
+	})
+
+	It("Should not require values unless all the values must satisfy the rule", func() {
+		r := validation.Rule{
+			Rule:       "regex",
+			Name:       "no-cdrom-ide",
+			Path:       "jsonpath::.spec.domain.devices.disks[*].cdrom.bus",
+			Message:    "no cdrom may use the ide bus",
+			Regex:      "^ide$",
+			Quantifier: "none",
+		}
+		expectRuleApplicationSuccess(&r, vmCirros, vmRef)
+	})
+
+	It("Should support quantifiers on all the rule types", func() {
+		rules := []validation.Rule{
+			{
+				Rule:       "quantity",
+				Name:       "memory",
+				Path:       "jsonpath::.spec.domain.resources.requests.memory",
+				Message:    "memory",
+				Min:        "1Gi",
+				Quantifier: "none",
+			},
+			{
+				Rule:       "string",
+				Name:       "disk-names",
+				Path:       "jsonpath::.spec.domain.devices.disks[*].name",
+				Message:    "disk names",
+				MaxLength:  13,
+				Quantifier: "exactly-2",
+			},
+			{
+				Rule:       "forbidden",
+				Name:       "bridge",
+				Path:       "jsonpath::.spec.domain.devices.interfaces[*].bridge",
+				Message:    "bridge",
+				Quantifier: "exactly-1",
+			},
+		}
+		for i := range rules {
+			expectRuleApplicationSuccess(&rules[i], vmCirros, vmRef)
+		}
+	})
+
+	It("Should explain the outcome", func() {
+		r := validation.Rule{
+			Rule:       "enum",
+			Name:       "no-ide",
+			Path:       "jsonpath::.spec.domain.devices.disks[*].disk.bus",
+			Message:    "no disk may use the ide bus",
+			Values:     []string{"ide"},
+			Quantifier: "none",
+		}
+		vmCirros.Spec.Template.Spec.Domain.Devices.Disks[1].Disk.Bus = "ide"
+		ra, err := r.Specialize(vmCirros, vmRef)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = ra.Apply(vmCirros, vmRef)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ra.String()).To(Equal("1 of [virtio, ide] are in [ide], expected none"))
+	})
+
+	It("Should lint the quantifiers", func() {
+		rules := []validation.Rule{
+			{
+				Rule:       "enum",
+				Name:       "disk-bus",
+				Path:       "jsonpath::.spec.domain.devices.disks[*].disk.bus",
+				Message:    "bad quantifier",
+				Values:     []string{"virtio"},
+				Quantifier: "most",
+			},
+			{
+				Rule:       "allOf",
+				Name:       "composite",
+				Message:    "quantifiers are not used by composite rules",
+				Quantifier: "any",
+				Rules: []validation.Rule{{
+					Rule:    "required",
+					Name:    "machine",
+					Path:    "jsonpath::.spec.domain.machine.type",
+					Message: "machine type required",
+				}},
+			},
+		}
+		issues := validation.LintRules(rules)
+		Expect(issues).To(HaveLen(2))
+		Expect(issues[0].Key).To(Equal("quantifier"))
+		Expect(issues[0].Location).To(Equal("rules[0]"))
+		Expect(issues[1].Key).To(Equal("quantifier"))
+		Expect(issues[1].Location).To(Equal("rules[1]"))
+	})
+})
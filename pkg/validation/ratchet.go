@@ -0,0 +1,118 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2019 Red Hat, Inc.
+ */
+
+package validation
+
+import (
+	"fmt"
+	"regexp"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+
+	k6tv1 "kubevirt.io/client-go/api/v1"
+)
+
+// When a template gains a stricter rule, the VMs which already violate it could no longer be
+// updated, even to change something unrelated. Ratcheting tolerates those violations on updates:
+// a cause is downgraded to a warning if the same rule already failed on the same field in the
+// previous version of the VM, and the values of the field are unchanged. The items of the lists
+// are matched by content, so the violations of an item follow it when the list is reordered.
+// The rule errors, and the causes which don't point at a field (e.g. of the cel rules), are never ratcheted.
+
+// EvaluateRuleSetRatcheting is like EvaluateRuleSet, but it tolerates the violations which were
+// already found in the previous version of the VM. See Result.Ratcheted.
+func (ev *Evaluator) EvaluateRuleSetRatcheting(rs *RuleSet, vm, oldVM *k6tv1.VirtualMachine) *Result {
+	res := ev.EvaluateRuleSet(rs, vm, oldVM)
+	if oldVM == nil || res.Succeeded() {
+		return res
+	}
+	// the previous version is judged as it was created
+	oldRes := NewEvaluator().EvaluateRuleSet(rs, oldVM, nil)
+	res.ratchet(oldRes, vm, oldVM, rs.refVm)
+	for _, c := range res.Ratcheted {
+		fmt.Fprintf(ev.Sink, "%s RATCHETED: %s is unchanged\n", c.Rule, c.Field)
+	}
+	return res
+}
+
+func (r *Result) ratchet(oldRes *Result, vm, oldVM, ref *k6tv1.VirtualMachine) {
+	oldCauses := oldRes.Causes()
+
+	remaining := 0
+	for _, c := range r.Causes() {
+		if c.Reason == ReasonRuleError || c.Field == "" || !isPreexisting(c, oldCauses, vm, oldVM, ref) {
+			remaining++
+			continue
+		}
+		r.Ratcheted = append(r.Ratcheted, c)
+		r.warn(fmt.Sprintf("pre-existing violation tolerated on update: %s", c.ToStatusCause().Message))
+	}
+	r.failed = remaining > 0
+}
+
+// isPreexisting tells if the same rule already failed on the same values in the previous version of the VM.
+func isPreexisting(c Cause, oldCauses []Cause, vm, oldVM, ref *k6tv1.VirtualMachine) bool {
+	for _, oc := range oldCauses {
+		if oc.Rule == c.Rule && isFieldUnchanged(c.Field, vm, oc.Field, oldVM, ref) {
+			return true
+		}
+	}
+	return false
+}
+
+// listItem splits a field at its first list index, e.g. "spec.template.spec.domain.devices.disks[1].cdrom.bus"
+// into the list, the index and the field within the item.
+var listItem = regexp.MustCompile(`^(.*?)\[(\d+)\](.*)$`)
+
+// isFieldUnchanged tells if the values at the field (e.g. "spec.template.spec.domain.cpu.cores")
+// are the same as the values at the old field in the previous version of the VM.
+// The items of the lists are matched by content, not by index: "disks[1].cdrom.bus" is unchanged
+// if the disk was "disks[0]" before the list was reordered, but not if another disk took its place.
+func isFieldUnchanged(field string, vm *k6tv1.VirtualMachine, oldField string, oldVM, ref *k6tv1.VirtualMachine) bool {
+	item, oldItem := listItem.FindStringSubmatch(field), listItem.FindStringSubmatch(oldField)
+	if item == nil || oldItem == nil {
+		return field == oldField && haveSameValues(field, vm, field, oldVM, ref)
+	}
+	if item[1] != oldItem[1] || item[3] != oldItem[3] {
+		return false
+	}
+	// the whole items must be the same
+	return haveSameValues(item[1]+"["+item[2]+"]", vm, oldItem[1]+"["+oldItem[2]+"]", oldVM, ref)
+}
+
+func haveSameValues(field string, vm *k6tv1.VirtualMachine, oldField string, oldVM, ref *k6tv1.VirtualMachine) bool {
+	values, err := findPresentValues(VMPathPrefix+"."+field, vm, ref)
+	if err != nil {
+		return false
+	}
+	oldValues, err := findPresentValues(VMPathPrefix+"."+oldField, oldVM, ref)
+	if err != nil {
+		return false
+	}
+	return equality.Semantic.DeepEqual(values, oldValues)
+}
+
+// isRatcheted tells if the cause was tolerated, see EvaluateRuleSetRatcheting.
+func (r *Result) isRatcheted(c Cause) bool {
+	for _, rc := range r.Ratcheted {
+		if rc == c {
+			return true
+		}
+	}
+	return false
+}
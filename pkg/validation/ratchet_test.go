@@ -0,0 +1,117 @@
+package validation_test
+
+import (
+	"bytes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	k6tv1 "kubevirt.io/client-go/api/v1"
+
+	"github.com/kubevirt/kubevirt-template-validator/pkg/validation"
+)
+
+var _ = Describe("Ratcheting", func() {
+	var (
+		oldVM *k6tv1.VirtualMachine
+		newVM *k6tv1.VirtualMachine
+		rs    *validation.RuleSet
+	)
+
+	BeforeEach(func() {
+		oldVM = NewVMCirros()
+		oldVM.Spec.Template.Spec.Domain.CPU = &k6tv1.CPU{Cores: 16}
+		newVM = NewVMCirros()
+		newVM.Spec.Template.Spec.Domain.CPU = &k6tv1.CPU{Cores: 16}
+		rs = validation.NewRuleSet([]validation.Rule{{
+			Rule:    "integer",
+			Name:    "core-limits",
+			Path:    "jsonpath::.spec.domain.cpu.cores",
+			Message: "cpu cores must be limited",
+			Max:     8,
+		}, {
+			Rule:    "enum",
+			Name:    "disk-bus",
+			Path:    "jsonpath::.spec.domain.devices.disks[*].disk.bus",
+			Message: "unsupported disk bus",
+			Values:  []string{"virtio"},
+		}})
+	})
+
+	evaluate := func() *validation.Result {
+		return validation.NewEvaluator().EvaluateRuleSetRatcheting(rs, newVM, oldVM)
+	}
+
+	It("Should tolerate the unchanged violations", func() {
+		newVM.Labels["kubevirt.io/size"] = "large"
+		buf := new(bytes.Buffer)
+		ev := validation.Evaluator{Sink: buf}
+		res := ev.EvaluateRuleSetRatcheting(rs, newVM, oldVM)
+		Expect(res.Succeeded()).To(BeTrue())
+		Expect(res.Causes()).To(BeEmpty())
+		Expect(res.Ratcheted).To(HaveLen(1))
+		Expect(res.Ratcheted[0].Rule).To(Equal("core-limits"))
+		Expect(res.Ratcheted[0].Field).To(Equal("spec.template.spec.domain.cpu.cores"))
+		Expect(res.Warnings).To(HaveLen(1))
+		Expect(res.Warnings[0]).To(HavePrefix("pre-existing violation tolerated on update: cpu cores must be limited"))
+		Expect(buf.String()).To(ContainSubstring("core-limits RATCHETED: spec.template.spec.domain.cpu.cores is unchanged"))
+	})
+
+	It("Should reject the changed violations", func() {
+		newVM.Spec.Template.Spec.Domain.CPU.Cores = 12
+		res := evaluate()
+		Expect(res.Succeeded()).To(BeFalse())
+		Expect(res.Causes()).To(HaveLen(1))
+		Expect(res.Ratcheted).To(BeEmpty())
+	})
+
+	It("Should reject the new violations only", func() {
+		newVM.Spec.Template.Spec.Domain.Devices.Disks[1].Disk.Bus = "ide"
+		res := evaluate()
+		Expect(res.Succeeded()).To(BeFalse())
+		causes := res.Causes()
+		Expect(causes).To(HaveLen(1))
+		Expect(causes[0].Field).To(Equal("spec.template.spec.domain.devices.disks[1].disk.bus"))
+		Expect(res.Ratcheted).To(HaveLen(1))
+		Expect(res.Ratcheted[0].Rule).To(Equal("core-limits"))
+	})
+
+	It("Should tolerate the unchanged elements of a list", func() {
+		oldVM.Spec.Template.Spec.Domain.CPU.Cores = 1
+		oldVM.Spec.Template.Spec.Domain.Devices.Disks[0].Disk.Bus = "ide"
+		newVM.Spec.Template.Spec.Domain.CPU.Cores = 1
+		newVM.Spec.Template.Spec.Domain.Devices.Disks[0].Disk.Bus = "ide"
+		newVM.Spec.Template.Spec.Domain.Devices.Disks[1].Name = "seed"
+		res := evaluate()
+		Expect(res.Succeeded()).To(BeTrue())
+		Expect(res.Ratcheted).To(HaveLen(1))
+		Expect(res.Ratcheted[0].Field).To(Equal("spec.template.spec.domain.devices.disks[0].disk.bus"))
+	})
+
+	It("Should match the elements of a list by content", func() {
+		oldVM.Spec.Template.Spec.Domain.CPU.Cores = 1
+		oldVM.Spec.Template.Spec.Domain.Devices.Disks[0].Disk.Bus = "ide"
+		newVM.Spec.Template.Spec.Domain.CPU.Cores = 1
+		newVM.Spec.Template.Spec.Domain.Devices.Disks[0].Disk.Bus = "ide"
+		disks := newVM.Spec.Template.Spec.Domain.Devices.Disks
+		disks[0], disks[1] = disks[1], disks[0]
+		res := evaluate()
+		Expect(res.Succeeded()).To(BeTrue())
+		Expect(res.Ratcheted).To(HaveLen(1))
+		Expect(res.Ratcheted[0].Field).To(Equal("spec.template.spec.domain.devices.disks[1].disk.bus"))
+
+		// another disk in place of the one at fault
+		disks[0], disks[1] = disks[1], disks[0]
+		disks[0].Name = "seed"
+		res = evaluate()
+		Expect(res.Succeeded()).To(BeFalse())
+		Expect(res.Ratcheted).To(BeEmpty())
+		Expect(res.Causes()[0].Field).To(Equal("spec.template.spec.domain.devices.disks[0].disk.bus"))
+	})
+
+	It("Should not ratchet on creation", func() {
+		res := validation.NewEvaluator().EvaluateRuleSetRatcheting(rs, newVM, nil)
+		Expect(res.Succeeded()).To(BeFalse())
+		Expect(res.Ratcheted).To(BeEmpty())
+	})
+})
@@ -0,0 +1,146 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2019 Red Hat, Inc.
+ */
+
+package validation
+
+import (
+	"fmt"
+	"strings"
+
+	k6tv1 "kubevirt.io/client-go/api/v1"
+)
+
+// unique rules check that all the values found at their path are distinct, e.g. the MAC addresses:
+//   {"rule": "unique", "path": "jsonpath::.spec.domain.devices.interfaces[*].macAddress"}
+// references rules check that all the values found at their path are found at their target too,
+// e.g. that every disk has a matching volume:
+//   {"rule": "references", "path": "jsonpath::.spec.domain.devices.disks[*].name",
+//    "target": "jsonpath::.spec.volumes[*].name"}
+// Like for the presence rules, the values are never taken from the reference VM.
+
+const (
+	ruleUnique     string = "unique"
+	ruleReferences string = "references"
+)
+
+type uniqueRule struct {
+	Ref        *Rule
+	Current    []string
+	Duplicates []string
+	Failing    []failingValue
+	Satisfied  bool
+}
+
+func NewUniqueRule(r *Rule) (RuleApplier, error) {
+	return &uniqueRule{Ref: r}, nil
+}
+
+func (ur *uniqueRule) Apply(vm, ref *k6tv1.VirtualMachine) (bool, error) {
+	values, err := findPresentValues(ur.Ref.Path, vm, ref)
+	if err != nil {
+		return false, err
+	}
+
+	ur.Current = valuesAsStrings(values)
+	ur.Duplicates = nil
+	ur.Failing = nil
+	seen := make(map[string]int)
+	for i, s := range ur.Current {
+		seen[s]++
+		if seen[s] == 2 {
+			ur.Duplicates = append(ur.Duplicates, s)
+		}
+		if seen[s] > 1 {
+			// the first occurrence is not a duplicate
+			ur.Failing = append(ur.Failing, failingValue{Index: i, Message: fmt.Sprintf("Duplicate value %q", s)})
+		}
+	}
+
+	ur.Satisfied = len(ur.Duplicates) == 0
+	return ur.Satisfied, nil
+}
+
+func (ur *uniqueRule) String() string {
+	if ur.Satisfied {
+		return fmt.Sprintf("All [%s] are unique", strings.Join(ur.Current, ", "))
+	}
+	return fmt.Sprintf("Duplicate values [%s] in [%s]", strings.Join(ur.Duplicates, ", "), strings.Join(ur.Current, ", "))
+}
+
+type referencesRule struct {
+	Ref       *Rule
+	Current   []string
+	Targets   []string
+	Dangling  []string
+	Failing   []failingValue
+	Satisfied bool
+}
+
+func NewReferencesRule(r *Rule) (RuleApplier, error) {
+	if !isJSONPath(r.Target) {
+		return nil, fmt.Errorf("%s rule requires a JSONPath target, found %q", r.Rule, r.Target)
+	}
+	return &referencesRule{Ref: r}, nil
+}
+
+func (rr *referencesRule) Apply(vm, ref *k6tv1.VirtualMachine) (bool, error) {
+	values, err := findPresentValues(rr.Ref.Path, vm, ref)
+	if err != nil {
+		return false, err
+	}
+	targets, err := findPresentValues(rr.Ref.Target, vm, ref)
+	if err != nil {
+		return false, err
+	}
+
+	rr.Current = valuesAsStrings(values)
+	rr.Targets = valuesAsStrings(targets)
+	rr.Dangling = nil
+	rr.Failing = nil
+	for i, s := range rr.Current {
+		if !containsString(rr.Targets, s) {
+			rr.Dangling = append(rr.Dangling, s)
+			rr.Failing = append(rr.Failing, failingValue{
+				Index:   i,
+				Message: fmt.Sprintf("Value %q is not found in %s [%s]", s, TrimJSONPath(rr.Ref.Target), strings.Join(rr.Targets, ", ")),
+			})
+		}
+	}
+
+	rr.Satisfied = len(rr.Dangling) == 0
+	return rr.Satisfied, nil
+}
+
+func (rr *referencesRule) String() string {
+	target := TrimJSONPath(rr.Ref.Target)
+	if rr.Satisfied {
+		return fmt.Sprintf("All [%s] are found in %s [%s]", strings.Join(rr.Current, ", "), target, strings.Join(rr.Targets, ", "))
+	}
+	return fmt.Sprintf("Values [%s] are not found in %s [%s]", strings.Join(rr.Dangling, ", "), target, strings.Join(rr.Targets, ", "))
+}
+
+func (ur *uniqueRule) failingValues() []failingValue     { return ur.Failing }
+func (rr *referencesRule) failingValues() []failingValue { return rr.Failing }
+
+func valuesAsStrings(values []interface{}) []string {
+	ret := make([]string, 0, len(values))
+	for _, obj := range values {
+		ret = append(ret, valueAsString(obj))
+	}
+	return ret
+}
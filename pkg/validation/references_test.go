@@ -0,0 +1,131 @@
+package validation_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	k6tv1 "kubevirt.io/client-go/api/v1"
+
+	k6tobjs "github.com/kubevirt/kubevirt-template-validator/pkg/kubevirtobjs"
+	"github.com/kubevirt/kubevirt-template-validator/pkg/validation"
+)
+
+var _ = Describe("References", func() {
+	var (
+		vmCirros *k6tv1.VirtualMachine
+		vmRef    *k6tv1.VirtualMachine
+	)
+
+	BeforeEach(func() {
+		vmCirros = NewVMCirros()
+		vmRef = k6tobjs.NewDefaultVirtualMachine()
+		vmCirros.Spec.Template.Spec.Domain.Devices.Interfaces = []k6tv1.Interface{
+			{Name: "default", MacAddress: "02:00:00:00:00:01"},
+			{Name: "secondary", MacAddress: "02:00:00:00:00:02"},
+		}
+		vmCirros.Spec.Template.Spec.Networks = []k6tv1.Network{
+			{Name: "default"},
+			{Name: "secondary"},
+		}
+	})
+
+	applyRule := func(r *validation.Rule) (bool, string) {
+		ra, err := r.Specialize(vmCirros, vmRef)
+		Expect(err).ToNot(HaveOccurred())
+		ok, err := ra.Apply(vmCirros, vmRef)
+		Expect(err).ToNot(HaveOccurred())
+		return ok, ra.String()
+	}
+
+	Context("With unique rules", func() {
+		It("Should detect duplicate MAC addresses", func() {
+			r := validation.Rule{
+				Rule:    "unique",
+				Name:    "unique-macs",
+				Path:    "jsonpath::.spec.domain.devices.interfaces[*].macAddress",
+				Message: "MAC addresses must be unique",
+			}
+			ok, _ := applyRule(&r)
+			Expect(ok).To(BeTrue())
+
+			vmCirros.Spec.Template.Spec.Domain.Devices.Interfaces[1].MacAddress = "02:00:00:00:00:01"
+			ok, message := applyRule(&r)
+			Expect(ok).To(BeFalse())
+			Expect(message).To(Equal("Duplicate values [02:00:00:00:00:01] in [02:00:00:00:00:01, 02:00:00:00:00:01]"))
+		})
+
+		It("Should ignore the values which are not set", func() {
+			r := validation.Rule{
+				Rule:    "unique",
+				Name:    "unique-boot-order",
+				Path:    "jsonpath::.spec.domain.devices.disks[*].bootOrder",
+				Message: "boot orders must be unique",
+			}
+			ok, _ := applyRule(&r)
+			Expect(ok).To(BeTrue())
+
+			bootOrder := uint(1)
+			vmCirros.Spec.Template.Spec.Domain.Devices.Disks[0].BootOrder = &bootOrder
+			vmCirros.Spec.Template.Spec.Domain.Devices.Disks[1].BootOrder = &bootOrder
+			ok, message := applyRule(&r)
+			Expect(ok).To(BeFalse())
+			Expect(message).To(HavePrefix("Duplicate values [1]"))
+		})
+	})
+
+	Context("With references rules", func() {
+		It("Should detect interfaces without network", func() {
+			r := validation.Rule{
+				Rule:    "references",
+				Name:    "interface-networks",
+				Path:    "jsonpath::.spec.domain.devices.interfaces[*].name",
+				Target:  "jsonpath::.spec.networks[*].name",
+				Message: "interfaces must have a matching network",
+			}
+			ok, _ := applyRule(&r)
+			Expect(ok).To(BeTrue())
+
+			vmCirros.Spec.Template.Spec.Networks = vmCirros.Spec.Template.Spec.Networks[:1]
+			ok, message := applyRule(&r)
+			Expect(ok).To(BeFalse())
+			Expect(message).To(Equal("Values [secondary] are not found in .spec.networks[*].name [default]"))
+		})
+
+		It("Should detect disks without volume", func() {
+			r := validation.Rule{
+				Rule:    "references",
+				Name:    "disk-volumes",
+				Path:    "jsonpath::.spec.domain.devices.disks[*].name",
+				Target:  "jsonpath::.spec.volumes[*].name",
+				Message: "disks must have a matching volume",
+			}
+			ok, _ := applyRule(&r)
+			Expect(ok).To(BeTrue())
+
+			vmCirros.Spec.Template.Spec.Volumes = nil
+			ok, message := applyRule(&r)
+			Expect(ok).To(BeFalse())
+			Expect(message).To(HavePrefix("Values [containerdisk, cloudinitdisk] are not found"))
+		})
+
+		It("Should require a JSONPath target", func() {
+			r := validation.Rule{
+				Rule:    "references",
+				Name:    "disk-volumes",
+				Path:    "jsonpath::.spec.domain.devices.disks[*].name",
+				Message: "disks must have a matching volume",
+			}
+			_, err := r.Specialize(vmCirros, vmRef)
+			Expect(err).To(HaveOccurred())
+
+			issues := validation.LintRules([]validation.Rule{r})
+			Expect(issues).To(HaveLen(1))
+			Expect(issues[0].Key).To(Equal("target"))
+
+			r.Target = "jsonpath::.spec.volumez[*].name"
+			issues = validation.LintRules([]validation.Rule{r})
+			Expect(issues).To(HaveLen(1))
+			Expect(issues[0].Key).To(Equal("target"))
+		})
+	})
+})
@@ -19,7 +19,11 @@
 package validation
 
 import (
-	"encoding/json"
+	"regexp"
+	"text/template"
+
+	"github.com/google/cel-go/cel"
+	"github.com/xeipuuv/gojsonschema"
 
 	k6tv1 "kubevirt.io/client-go/api/v1"
 )
@@ -36,8 +40,16 @@ type Rule struct {
 	Path    string `json:"path"`
 	Message string `json:"message"`
 	// optional keys
-	Valid       string `json:"valid,omitempty"`
-	JustWarning bool   `json:"justWarning,omitempty"`
+	Valid    string      `json:"valid,omitempty"`
+	When     []Condition `json:"when,omitempty"`
+	Severity string      `json:"severity,omitempty"`
+	// the admission operations the rule applies to, "CREATE" and/or "UPDATE" (default: both)
+	Operations []string `json:"operations,omitempty"`
+	// how to fix the VM when the rule is not satisfied, shown along with the message
+	Hint   string `json:"hint,omitempty"`
+	DocURL string `json:"docURL,omitempty"`
+	// deprecated: use Severity "warning" instead
+	JustWarning bool `json:"justWarning,omitempty"`
 	// arguments (optional keys)
 	Values    []string    `json:"values,omitempty"`
 	Min       interface{} `json:"min,omitempty"`
@@ -45,8 +57,63 @@ type Rule struct {
 	MinLength interface{} `json:"minLength,omitempty"`
 	MaxLength interface{} `json:"maxLength,omitempty"`
 	Regex     string      `json:"regex,omitempty"`
+	Value     interface{} `json:"value,omitempty"`
+	// what to do when the path has no value: "skip", "fail" or "default" (value rules only)
+	OnMissing string      `json:"onMissing,omitempty"`
+	Default   interface{} `json:"default,omitempty"`
+	// how many of the values found must satisfy the rule (e.g. "all", "any", "none", "exactly-1")
+	Quantifier string `json:"quantifier,omitempty"`
+	// the function computed over the values found (aggregate rules only)
+	Function string `json:"function,omitempty"`
+	// the JSONPath of the values referenced by the values found (references rules only)
+	Target string `json:"target,omitempty"`
+	// the expected format of the values found, e.g. "mac" (format rules only)
+	Format string `json:"format,omitempty"`
+	// nested rules (composite rules only)
+	Rules []Rule `json:"rules,omitempty"`
+	// CEL expression (cel rules only)
+	Expression string `json:"expression,omitempty"`
+	// JSON Schema fragment the objects found must match (schema rules only)
+	Schema interface{} `json:"schema,omitempty"`
+	// the allowed changes of the value found, on updates (transition rules only)
+	Transitions []Transition `json:"transitions,omitempty"`
+
+	celProgram      cel.Program
+	messageTemplate *template.Template
+	element         string // the list element the rule is scoped to, if any (see forEach rules)
+	regex           *regexp.Regexp
+	jsonSchema      *gojsonschema.Schema
+	expressions     compiledExpressions
+	scoped          *scopedRules // the nested rules scoped to each element (forEach rules only)
+	compileErr      error
+}
+
+// Severity tells what happens when a Rule is not satisfied:
+// errors reject the VM, warnings are reported back to the user, infos are just logged.
+const (
+	SeverityError   string = "error"
+	SeverityWarning string = "warning"
+	SeverityInfo    string = "info"
+)
+
+func isValidSeverity(s string) bool {
+	return s == "" || s == SeverityError || s == SeverityWarning || s == SeverityInfo
 }
 
+// GetSeverity returns the effective severity of the rule. An explicit Severity
+// always wins over the legacy JustWarning flag.
+func (r *Rule) GetSeverity() string {
+	if r.Severity != "" {
+		return r.Severity
+	}
+	if r.JustWarning {
+		return SeverityWarning
+	}
+	return SeverityError
+}
+
+// findPathOn tells if the valid path of the rule is set in the VM, see isSet: the nil
+// values found, e.g. the cdrom of a scoped disk which is not a cdrom, do not count.
 func (r *Rule) findPathOn(vm *k6tv1.VirtualMachine) (bool, error) {
 	var err error
 	p, err := NewPath(r.Valid)
@@ -57,27 +124,77 @@ func (r *Rule) findPathOn(vm *k6tv1.VirtualMachine) (bool, error) {
 	if err != nil {
 		return false, err
 	}
-	return p.Len() > 0, nil
+	return p.CountPresent() > 0, nil
 }
 
 func (r *Rule) IsAppliableOn(vm *k6tv1.VirtualMachine) (bool, error) {
-	if r.Valid == "" {
-		// nothing to check against, so it is OK
-		return true, nil
+	if r.Valid != "" {
+		ok, err := r.findPathOn(vm)
+		if err == ErrInvalidJSONPath {
+			return false, nil
+		}
+		if !ok || err != nil {
+			return ok, err
+		}
 	}
-	ok, err := r.findPathOn(vm)
-	if err == ErrInvalidJSONPath {
-		return false, nil
+	for i := range r.When {
+		ok, err := r.When[i].isMetBy(vm, r.expressions)
+		if !ok || err != nil {
+			return ok, err
+		}
 	}
-	return ok, err
+	// nothing else to check against, so it is OK
+	return true, nil
 }
 
+// compile prepares the rule for the evaluation. Compilation errors are stored, and
+// reported when the rule is evaluated, exactly like any other malformed rule.
+func (r *Rule) compile() {
+	if r.compileErr == nil && r.messageTemplate == nil && isMessageTemplate(r.Message) {
+		r.messageTemplate, r.compileErr = compileMessage(r.Name, r.Message)
+	}
+	if r.compileErr == nil {
+		switch {
+		case r.Rule == ruleCEL && r.celProgram == nil:
+			r.celProgram, r.compileErr = compileCEL(r.Expression)
+		case r.Rule == "regex" && r.regex == nil:
+			r.regex, r.compileErr = regexp.Compile(r.Regex)
+		case r.Rule == ruleSchema && r.jsonSchema == nil:
+			r.jsonSchema, r.compileErr = compileSchema(r.Schema)
+		}
+	}
+	if r.Rule == ruleForEach && r.scoped == nil {
+		r.scoped = &scopedRules{}
+	}
+	if r.expressions == nil {
+		params := []interface{}{r.Path, r.Min, r.Max, r.MinLength, r.MaxLength, r.Default}
+		for _, c := range r.When {
+			params = append(params, c.Min, c.Max)
+		}
+		// the rules without expressions are left untouched, they may be shared (see RuleSetCache)
+		if exprs := compileExpressions(params...); exprs != nil {
+			r.expressions = exprs
+		}
+	}
+	for i := range r.Rules {
+		r.Rules[i].compile()
+	}
+}
+
+// param returns the parameter of the rule, or its compiled expression if it is one.
+func (r *Rule) param(obj interface{}) interface{} {
+	return r.expressions.param(obj)
+}
+
+// ParseRules decodes the rules, either a bare list or a versioned document, in JSON or YAML.
+// Unknown keys are rejected. Errors are *ParseError, telling which rule and key are at fault.
 func ParseRules(data []byte) ([]Rule, error) {
-	var rules []Rule
-	if len(data) == 0 {
-		// nothing to do
-		return rules, nil
+	rules, err := parseRules(data, true)
+	if err != nil {
+		return nil, err
+	}
+	for i := range rules {
+		rules[i].compile()
 	}
-	err := json.Unmarshal(data, &rules)
-	return rules, err
+	return rules, nil
 }
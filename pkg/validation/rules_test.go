@@ -1,6 +1,12 @@
 package validation_test
 
 import (
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
@@ -87,4 +93,174 @@ var _ = Describe("Rules", func() {
 		})
 
 	})
+
+	Context("With versioned or YAML validation text", func() {
+		It("Should parse a versioned document", func() {
+			text := `{
+            "apiVersion": "validation.kubevirt.io/v1alpha1",
+            "rules": [{
+              "name": "core-limits",
+              "path": "jsonpath::.spec.domain.cpu.cores",
+              "rule": "integer",
+              "message": "cpu cores must be limited",
+              "max": 8
+            }]
+          }`
+			rules, err := validation.ParseRules([]byte(text))
+
+			Expect(err).To(Not(HaveOccurred()))
+			Expect(len(rules)).To(Equal(1))
+			Expect(rules[0].Name).To(Equal("core-limits"))
+		})
+
+		It("Should parse YAML", func() {
+			text := `
+apiVersion: validation.kubevirt.io/v1alpha1
+rules:
+- name: core-limits
+  path: jsonpath::.spec.domain.cpu.cores
+  rule: integer
+  message: cpu cores must be limited
+  max: 8
+- name: supported-bus
+  path: jsonpath::.spec.domain.devices.disks[*].disk.bus
+  rule: enum
+  message: the disk bus type must be one of the supported values
+  values: [virtio, scsi]
+  when:
+  - path: jsonpath::.spec.domain.devices.disks
+`
+			rules, err := validation.ParseRules([]byte(text))
+
+			Expect(err).To(Not(HaveOccurred()))
+			Expect(len(rules)).To(Equal(2))
+			Expect(rules[1].Values).To(Equal([]string{"virtio", "scsi"}))
+			Expect(len(rules[1].When)).To(Equal(1))
+		})
+
+		It("Should parse a bare YAML list", func() {
+			text := `
+- name: core-limits
+  path: jsonpath::.spec.domain.cpu.cores
+  rule: integer
+  message: cpu cores must be limited
+  max: 8
+`
+			rules, err := validation.ParseRules([]byte(text))
+
+			Expect(err).To(Not(HaveOccurred()))
+			Expect(len(rules)).To(Equal(1))
+		})
+
+		It("Should reject unsupported versions", func() {
+			_, err := validation.ParseRules([]byte(`{"apiVersion": "validation.kubevirt.io/v2", "rules": []}`))
+
+			Expect(err).To(HaveOccurred())
+			Expect(err.(*validation.ParseError).Key).To(Equal("apiVersion"))
+		})
+	})
+
+	Context("With malformed validation text", func() {
+		It("Should reject unknown keys", func() {
+			text := `[{
+            "name": "core-limits",
+            "path": "jsonpath::.spec.domain.cpu.cores",
+            "rule": "integer",
+            "message": "cpu cores must be limited",
+            "max": 8
+          }, {
+            "name": "name-length",
+            "path": "jsonpath::.metadata.name",
+            "rule": "string",
+            "message": "the name is too long",
+            "maxLenght": 63
+          }]`
+			_, err := validation.ParseRules([]byte(text))
+
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("rules[1] (name-length) maxLenght: unknown key"))
+		})
+
+		It("Should reject unknown keys in nested rules and conditions", func() {
+			text := `[{
+            "name": "composite",
+            "rule": "anyOf",
+            "message": "composite",
+            "rules": [{
+              "name": "nested",
+              "path": "jsonpath::.spec.domain.cpu.cores",
+              "rule": "integer",
+              "message": "nested",
+              "max": 8,
+              "when": [{"path": "jsonpath::.spec.domain.cpu", "equal": 1}]
+            }]
+          }]`
+			_, err := validation.ParseRules([]byte(text))
+
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("rules[0].rules[0] (nested) when[0].equal: unknown key"))
+		})
+
+		It("Should report type mismatches", func() {
+			text := `[{
+            "name": "supported-bus",
+            "path": "jsonpath::.spec.domain.devices.disks[*].disk.bus",
+            "rule": "enum",
+            "message": "the disk bus type must be one of the supported values",
+            "values": "virtio"
+          }]`
+			_, err := validation.ParseRules([]byte(text))
+
+			Expect(err).To(HaveOccurred())
+			perr := err.(*validation.ParseError)
+			Expect(perr.Location).To(Equal("rules[0]"))
+			Expect(perr.Name).To(Equal("supported-bus"))
+			Expect(perr.Key).To(Equal("values"))
+		})
+
+		It("Should report the position of syntax errors", func() {
+			text := "[{\n  \"name\": \"broken\",\n  \"rule\" \"integer\"\n}]"
+			_, err := validation.ParseRules([]byte(text))
+
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("line 3, column"))
+		})
+	})
+
+	Context("With the published JSON Schema", func() {
+		It("Should describe all the rule keys", func() {
+			data, err := ioutil.ReadFile("../../api/validations.schema.json")
+			Expect(err).To(Not(HaveOccurred()))
+			var schema struct {
+				Definitions map[string]struct {
+					Properties map[string]interface{} `json:"properties"`
+				} `json:"definitions"`
+			}
+			Expect(json.Unmarshal(data, &schema)).To(Succeed())
+
+			Expect(sortedKeys(schema.Definitions["rule"].Properties)).To(Equal(jsonKeysOf(validation.Rule{})))
+			Expect(sortedKeys(schema.Definitions["condition"].Properties)).To(Equal(jsonKeysOf(validation.Condition{})))
+		})
+	})
 })
+
+func sortedKeys(m map[string]interface{}) []string {
+	var keys []string
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func jsonKeysOf(obj interface{}) []string {
+	var keys []string
+	t := reflect.TypeOf(obj)
+	for i := 0; i < t.NumField(); i++ {
+		if name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]; name != "" && name != "-" {
+			keys = append(keys, name)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,177 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2019 Red Hat, Inc.
+ */
+
+package validation
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	lru "github.com/hashicorp/golang-lru"
+
+	k6tv1 "kubevirt.io/client-go/api/v1"
+
+	k6tobjs "github.com/kubevirt/kubevirt-template-validator/pkg/kubevirtobjs"
+)
+
+// RuleSet is a set of rules compiled once and evaluated many times, possibly concurrently.
+// Compiling a RuleSet means doing upfront all the work which depends only on the rules,
+// like compiling the regexes and the CEL expressions, or building the reference VM.
+// A RuleSet must never be modified after it is created.
+type RuleSet struct {
+	Rules []Rule
+	// where the rules come from (e.g. "template default/fedora"), reported in the causes
+	Source string
+	// the unknown keys, which were ignored, see CompileRulesLenient
+	Ignored []LintIssue
+	refVm   *k6tv1.VirtualMachine
+}
+
+func NewRuleSet(rules []Rule) *RuleSet {
+	for i := range rules {
+		rules[i].compile()
+	}
+	return &RuleSet{
+		Rules: rules,
+		refVm: k6tobjs.NewDefaultVirtualMachine(),
+	}
+}
+
+func CompileRules(data []byte) (*RuleSet, error) {
+	rules, err := ParseRules(data)
+	if err != nil {
+		return nil, err
+	}
+	return NewRuleSet(rules), nil
+}
+
+// CompileRulesLenient is like CompileRules, but the unknown keys are ignored rather than rejected,
+// e.g. the keys of a newer version of the rules. They are reported as warnings on evaluation.
+func CompileRulesLenient(data []byte) (*RuleSet, error) {
+	items, err := splitRules(data, false)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := parseRuleList("rules", items, false)
+	if err != nil {
+		return nil, err
+	}
+	raw := make([]interface{}, len(items))
+	for i, item := range items {
+		json.Unmarshal(item, &raw[i])
+	}
+	l := linter{}
+	l.lintAllUnknownKeys("rules", rules, raw)
+
+	rs := NewRuleSet(rules)
+	rs.Ignored = l.issues
+	return rs, nil
+}
+
+// WithSource returns a copy of the RuleSet with the given Source. The compiled rules are shared.
+func (rs *RuleSet) WithSource(source string) *RuleSet {
+	ret := *rs
+	ret.Source = source
+	return &ret
+}
+
+func (rs *RuleSet) Len() int {
+	return len(rs.Rules)
+}
+
+// EvaluateRuleSet is like EvaluateWithOldVM, but it uses a precompiled RuleSet.
+func (ev *Evaluator) EvaluateRuleSet(rs *RuleSet, vm, oldVM *k6tv1.VirtualMachine) *Result {
+	res := ev.evaluate(rs.Rules, vm, oldVM, rs.refVm, newCELVars(vm, oldVM))
+	res.Source = rs.Source
+	if len(rs.Ignored) > 0 {
+		var warnings []string
+		for _, issue := range rs.Ignored {
+			warnings = append(warnings, rs.describeIgnored(issue))
+		}
+		res.Warnings = append(warnings, res.Warnings...)
+	}
+	return res
+}
+
+func (rs *RuleSet) describeIgnored(issue LintIssue) string {
+	if rs.Source == "" {
+		return fmt.Sprintf("%s, ignored", issue)
+	}
+	return fmt.Sprintf("%s, ignored [source: %s]", issue, rs.Source)
+}
+
+type ruleSetEntry struct {
+	hash    string
+	ruleSet *RuleSet
+}
+
+// RuleSetCache holds the most recently used RuleSets. Entries are identified by a key
+// (e.g. the template namespace/name), and are automatically recompiled if the rules
+// content changes.
+type RuleSetCache struct {
+	entries *lru.Cache
+}
+
+func NewRuleSetCache(size int) *RuleSetCache {
+	return &RuleSetCache{
+		entries: mustNewLRU(size),
+	}
+}
+
+func HashRules(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Get returns the RuleSet compiled from data, reusing the cached one if the content didn't change.
+// The rules are compiled leniently, see CompileRulesLenient. Parse errors are never cached.
+func (c *RuleSetCache) Get(key string, data []byte) (*RuleSet, error) {
+	hash := HashRules(data)
+	if obj, ok := c.entries.Get(key); ok {
+		entry := obj.(ruleSetEntry)
+		if entry.hash == hash {
+			return entry.ruleSet, nil
+		}
+	}
+
+	rs, err := CompileRulesLenient(data)
+	if err != nil {
+		return nil, err
+	}
+	c.entries.Add(key, ruleSetEntry{hash: hash, ruleSet: rs})
+	return rs, nil
+}
+
+func (c *RuleSetCache) Invalidate(key string) {
+	c.entries.Remove(key)
+}
+
+func (c *RuleSetCache) Len() int {
+	return c.entries.Len()
+}
+
+func mustNewLRU(size int) *lru.Cache {
+	c, err := lru.New(size)
+	if err != nil {
+		// can only happen if size <= 0, which is a programming error
+		panic(err)
+	}
+	return c
+}
@@ -0,0 +1,197 @@
+package validation_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	k6tv1 "kubevirt.io/client-go/api/v1"
+
+	"github.com/kubevirt/kubevirt-template-validator/pkg/validation"
+)
+
+var benchRules = []byte(`[{
+	"name": "core-limits",
+	"valid": "jsonpath::.spec.domain.cpu.cores",
+	"path": "jsonpath::.spec.domain.cpu.cores",
+	"rule": "integer",
+	"message": "cpu cores must be limited",
+	"min": 1,
+	"max": 8
+}, {
+	"name": "supported-bus",
+	"path": "jsonpath::.spec.domain.devices.disks[*].disk.bus",
+	"rule": "enum",
+	"message": "the disk bus must be virtio or sata",
+	"values": ["virtio", "sata"]
+}, {
+	"name": "machine-type",
+	"path": "jsonpath::.spec.domain.machine.type",
+	"rule": "regex",
+	"message": "the machine type must be q35",
+	"regex": "^q35$"
+}, {
+	"name": "memory",
+	"path": "jsonpath::.spec.domain.resources.requests.memory",
+	"rule": "quantity",
+	"message": "memory size must be reasonable",
+	"min": "64Mi",
+	"max": "4Gi"
+}]`)
+
+var _ = Describe("RuleSet", func() {
+	var vmCirros *k6tv1.VirtualMachine
+
+	BeforeEach(func() {
+		vmCirros = NewVMCirros()
+	})
+
+	Context("Compiling rules", func() {
+		It("Should reject malformed rules", func() {
+			_, err := validation.CompileRules([]byte(`[{"name": "broken"`))
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("Should ignore the unknown keys when lenient, with warnings", func() {
+			text := []byte(`[{
+				"name": "core-limits",
+				"path": "jsonpath::.spec.domain.cpu.cores",
+				"rule": "integer",
+				"message": "cpu cores must be limited",
+				"max": 8,
+				"maxx": 4
+			}]`)
+			_, err := validation.CompileRules(text)
+			Expect(err).To(HaveOccurred())
+
+			rs, err := validation.CompileRulesLenient(text)
+			Expect(err).To(Not(HaveOccurred()))
+			Expect(rs.Len()).To(Equal(1))
+			res := validation.NewEvaluator().EvaluateRuleSet(rs.WithSource("template ns/tmpl"), vmCirros, nil)
+			Expect(res.Succeeded()).To(BeTrue())
+			Expect(res.Warnings).To(ConsistOf("rules[0] (core-limits) maxx: unknown key, ignored [source: template ns/tmpl]"))
+		})
+
+		It("Should evaluate like plain rules", func() {
+			rules, err := validation.ParseRules(benchRules)
+			Expect(err).To(Not(HaveOccurred()))
+			rs, err := validation.CompileRules(benchRules)
+			Expect(err).To(Not(HaveOccurred()))
+			Expect(rs.Len()).To(Equal(len(rules)))
+
+			ev := validation.NewEvaluator()
+			expected := ev.Evaluate(rules, vmCirros)
+			res := ev.EvaluateRuleSet(rs, vmCirros, nil)
+			Expect(res.Succeeded()).To(Equal(expected.Succeeded()))
+			Expect(len(res.Status)).To(Equal(len(expected.Status)))
+			for i := range res.Status {
+				Expect(res.Status[i].Satisfied).To(Equal(expected.Status[i].Satisfied))
+				Expect(res.Status[i].Message).To(Equal(expected.Status[i].Message))
+			}
+		})
+
+		It("Should be reusable across evaluations", func() {
+			rs, err := validation.CompileRules(benchRules)
+			Expect(err).To(Not(HaveOccurred()))
+
+			ev := validation.NewEvaluator()
+			Expect(ev.EvaluateRuleSet(rs, vmCirros, nil).Succeeded()).To(BeTrue())
+
+			vmCirros.Spec.Template.Spec.Domain.Machine.Type = "pc"
+			Expect(ev.EvaluateRuleSet(rs, vmCirros, nil).Succeeded()).To(BeFalse())
+
+			vmCirros.Spec.Template.Spec.Domain.Machine.Type = "q35"
+			Expect(ev.EvaluateRuleSet(rs, vmCirros, nil).Succeeded()).To(BeTrue())
+		})
+		It("Should be evaluated concurrently", func() {
+			rs, err := validation.CompileRules(benchRules)
+			Expect(err).To(Not(HaveOccurred()))
+
+			done := make(chan bool)
+			for i := 0; i < 4; i++ {
+				go func() {
+					defer GinkgoRecover()
+					vm := NewVMCirros()
+					done <- validation.NewEvaluator().EvaluateRuleSet(rs, vm, nil).Succeeded()
+				}()
+			}
+			for i := 0; i < 4; i++ {
+				Expect(<-done).To(BeTrue())
+			}
+		})
+	})
+
+	Context("Caching rule sets", func() {
+		It("Should reuse the rule set if the content did not change", func() {
+			cache := validation.NewRuleSetCache(4)
+			rs1, err := cache.Get("ns/tmpl", benchRules)
+			Expect(err).To(Not(HaveOccurred()))
+			rs2, err := cache.Get("ns/tmpl", benchRules)
+			Expect(err).To(Not(HaveOccurred()))
+			Expect(rs2).To(BeIdenticalTo(rs1))
+		})
+
+		It("Should recompile the rule set if the content changed", func() {
+			cache := validation.NewRuleSetCache(4)
+			rs1, err := cache.Get("ns/tmpl", benchRules)
+			Expect(err).To(Not(HaveOccurred()))
+			rs2, err := cache.Get("ns/tmpl", []byte(`[]`))
+			Expect(err).To(Not(HaveOccurred()))
+			Expect(rs2).ToNot(BeIdenticalTo(rs1))
+			Expect(rs2.Len()).To(Equal(0))
+		})
+
+		It("Should recompile the rule set once invalidated", func() {
+			cache := validation.NewRuleSetCache(4)
+			rs1, err := cache.Get("ns/tmpl", benchRules)
+			Expect(err).To(Not(HaveOccurred()))
+			cache.Invalidate("ns/tmpl")
+			Expect(cache.Len()).To(Equal(0))
+			rs2, err := cache.Get("ns/tmpl", benchRules)
+			Expect(err).To(Not(HaveOccurred()))
+			Expect(rs2).ToNot(BeIdenticalTo(rs1))
+		})
+
+		It("Should not cache malformed rules", func() {
+			cache := validation.NewRuleSetCache(4)
+			_, err := cache.Get("ns/tmpl", []byte(`[{"name": "broken"`))
+			Expect(err).To(HaveOccurred())
+			Expect(cache.Len()).To(Equal(0))
+		})
+
+		It("Should be bounded in size", func() {
+			cache := validation.NewRuleSetCache(2)
+			for _, key := range []string{"ns/a", "ns/b", "ns/c"} {
+				_, err := cache.Get(key, benchRules)
+				Expect(err).To(Not(HaveOccurred()))
+			}
+			Expect(cache.Len()).To(Equal(2))
+		})
+	})
+})
+
+func BenchmarkEvaluate(b *testing.B) {
+	vm := NewVMCirros()
+	ev := validation.NewEvaluator()
+	for i := 0; i < b.N; i++ {
+		rules, err := validation.ParseRules(benchRules)
+		if err != nil {
+			b.Fatal(err)
+		}
+		ev.Evaluate(rules, vm)
+	}
+}
+
+func BenchmarkEvaluateRuleSet(b *testing.B) {
+	vm := NewVMCirros()
+	ev := validation.NewEvaluator()
+	cache := validation.NewRuleSetCache(1)
+	for i := 0; i < b.N; i++ {
+		rs, err := cache.Get("ns/tmpl", benchRules)
+		if err != nil {
+			b.Fatal(err)
+		}
+		ev.EvaluateRuleSet(rs, vm, nil)
+	}
+}
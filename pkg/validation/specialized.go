@@ -21,11 +21,13 @@ package validation
 import (
 	"errors"
 	"fmt"
+	"math/big"
 	"reflect"
 	"regexp"
-	"strconv"
 	"strings"
 
+	"k8s.io/apimachinery/pkg/api/resource"
+
 	k6tv1 "kubevirt.io/client-go/api/v1"
 )
 
@@ -39,30 +41,69 @@ var ErrNoValuesFound = errors.New("no values were found")
 // we need a vm reference to specialize a rule because few key fields may
 // be JSONPath, and we need to walk them to get e.g. the value to check,
 // or the limits to enforce.
+// The rule is compiled first, if needed; the evaluation uses the rules compiled beforehand.
 func (r *Rule) Specialize(vm, ref *k6tv1.VirtualMachine) (RuleApplier, error) {
+	r.compile()
+	return r.specialize(vm, nil, ref, nil)
+}
+
+// The CEL variables are shared by the rules of an evaluation, see celVars. If nil, they are made for the rule.
+func (r *Rule) specialize(vm, oldVM, ref *k6tv1.VirtualMachine, vars *celVars) (RuleApplier, error) {
+	if vars == nil {
+		vars = newCELVars(vm, oldVM)
+	}
 	switch r.Rule {
 	case "integer":
 		return NewIntRule(r, vm, ref)
+	case "quantity":
+		return NewQuantityRule(r, vm, ref)
 	case "string":
 		return NewStringRule(r, vm, ref)
 	case "enum":
 		return NewEnumRule(r, vm, ref)
 	case "regex":
 		return NewRegexRule(r)
+	case "bool":
+		return NewBoolRule(r)
+	case "required":
+		return NewPresenceRule(r, true)
+	case "forbidden":
+		return NewPresenceRule(r, false)
+	case ruleAllOf, ruleAnyOf, ruleOneOf, ruleNot:
+		return NewCompositeRule(r, oldVM, vars)
+	case ruleCEL:
+		return NewCELRule(r, vars)
+	case ruleForEach:
+		return NewForEachRule(r, oldVM, vars)
+	case ruleAggregate:
+		return NewAggregateRule(r, vm, ref)
+	case ruleUnique:
+		return NewUniqueRule(r)
+	case ruleReferences:
+		return NewReferencesRule(r)
+	case ruleFormat:
+		return NewFormatRule(r)
+	case ruleSchema:
+		return NewSchemaRule(r)
+	case ruleImmutable:
+		return NewImmutableRule(r, oldVM)
+	case ruleTransition:
+		return NewTransitionRule(r, oldVM)
 	}
 	return nil, fmt.Errorf("usupported rule: %s", r.Rule)
 }
 
+// Range bounds are rationals, so the bounds computed by expressions are compared exactly.
 type Range struct {
 	MinSet bool
-	Min    int64
+	Min    *big.Rat
 	MaxSet bool
-	Max    int64
+	Max    *big.Rat
 }
 
 func (r *Range) Decode(Min, Max interface{}, vm, ref *k6tv1.VirtualMachine) error {
 	if Min != nil {
-		v, err := decodeInt(Min, vm, ref)
+		v, err := decodeNumber(Min, vm, ref)
 		if err != nil {
 			return err
 		}
@@ -70,7 +111,7 @@ func (r *Range) Decode(Min, Max interface{}, vm, ref *k6tv1.VirtualMachine) erro
 		r.MinSet = true
 	}
 	if Max != nil {
-		v, err := decodeInt(Max, vm, ref)
+		v, err := decodeNumber(Max, vm, ref)
 
 		if err != nil {
 			return err
@@ -81,11 +122,83 @@ func (r *Range) Decode(Min, Max interface{}, vm, ref *k6tv1.VirtualMachine) erro
 	return nil
 }
 
-func (r *Range) Includes(v int64) bool {
-	if r.MinSet && v < r.Min {
+func (r *Range) Includes(v *big.Rat) bool {
+	if r.MinSet && v.Cmp(r.Min) < 0 {
 		return false
 	}
-	if r.MaxSet && v > r.Max {
+	if r.MaxSet && v.Cmp(r.Max) > 0 {
+		return false
+	}
+	return true
+}
+
+func (r *Range) IncludesInt(v int64) bool {
+	return r.Includes(new(big.Rat).SetInt64(v))
+}
+
+// bounds returns the bounds for the messages, "N/A" if not set.
+func (r *Range) bounds() (string, string) {
+	lowerBound := "N/A"
+	if r.MinSet {
+		lowerBound = formatNumber(r.Min)
+	}
+	upperBound := "N/A"
+	if r.MaxSet {
+		upperBound = formatNumber(r.Max)
+	}
+	return lowerBound, upperBound
+}
+
+// formatNumber formats the integers as such, and the other rationals with milli precision.
+func formatNumber(v *big.Rat) string {
+	if v.IsInt() {
+		return v.Num().String()
+	}
+	return v.FloatString(3)
+}
+
+func formatNumbers(vals []*big.Rat) []string {
+	ret := make([]string, 0, len(vals))
+	for _, v := range vals {
+		ret = append(ret, formatNumber(v))
+	}
+	return ret
+}
+
+// QuantityRange is like Range, but its bounds are resource.Quantity, so
+// they can be expressed using units (e.g. "1Gi", "250m") and compared exactly.
+type QuantityRange struct {
+	MinSet bool
+	Min    resource.Quantity
+	MaxSet bool
+	Max    resource.Quantity
+}
+
+func (r *QuantityRange) Decode(Min, Max interface{}, vm, ref *k6tv1.VirtualMachine) error {
+	if Min != nil {
+		v, err := decodeQuantity(Min, vm, ref)
+		if err != nil {
+			return err
+		}
+		r.Min = v
+		r.MinSet = true
+	}
+	if Max != nil {
+		v, err := decodeQuantity(Max, vm, ref)
+		if err != nil {
+			return err
+		}
+		r.Max = v
+		r.MaxSet = true
+	}
+	return nil
+}
+
+func (r *QuantityRange) Includes(v resource.Quantity) bool {
+	if r.MinSet && v.Cmp(r.Min) < 0 {
+		return false
+	}
+	if r.MaxSet && v.Cmp(r.Max) > 0 {
 		return false
 	}
 	return true
@@ -93,10 +206,14 @@ func (r *Range) Includes(v int64) bool {
 
 // These are the specializedrules
 type intRule struct {
-	Ref       *Rule
-	Value     Range
-	Current   []int64
-	Satisfied bool
+	Ref          *Rule
+	Value        Range
+	Quantifier   quantifier
+	Current      []*big.Rat
+	Matched      int
+	Satisfied    bool
+	Explanations []string
+	Missing      missingValue
 }
 
 // JSONPATH lookup logic, aka what this "ref" object and why we need it
@@ -113,11 +230,19 @@ type intRule struct {
 //   if even this lookup fails, we mark the path as bogus.
 //   Otherwise we use the zero, default, value for our logic.
 
-// The first argument is either a single literal integer or a JSON path to one or more integers.
+// The first argument is either a single literal integer, an expression yielding one number,
+// or a JSON path to one or more integers. The numbers are rationals, because of the expressions.
 // Currently the function does not support multiple literal integers.
-func decodeInts(obj interface{}, vm, ref *k6tv1.VirtualMachine) ([]int64, error) {
+func decodeNumbers(obj interface{}, vm, ref *k6tv1.VirtualMachine) ([]*big.Rat, error) {
 	if val, ok := toInt64(obj); ok {
-		return []int64{val}, nil
+		return []*big.Rat{new(big.Rat).SetInt64(val)}, nil
+	}
+	if isExpressionParam(obj) {
+		res, err := evaluateExpression(obj, vm, ref)
+		if err != nil {
+			return nil, err
+		}
+		return []*big.Rat{res.Value}, nil
 	}
 
 	jsonPath, ok := obj.(string)
@@ -128,20 +253,28 @@ func decodeInts(obj interface{}, vm, ref *k6tv1.VirtualMachine) ([]int64, error)
 		return nil, fmt.Errorf("parameter is not JSONPath: %v", jsonPath)
 	}
 
-	v, err := decodeInt64FromJSONPath(jsonPath, vm)
+	path, err := lookupPath(jsonPath, vm, ref)
+	if err != nil {
+		return nil, err
+	}
+	ints, err := path.AsInt64()
 	if err != nil {
-		v, err = decodeInt64FromJSONPath(jsonPath, ref)
+		return nil, err
+	}
+	ret := make([]*big.Rat, 0, len(ints))
+	for _, v := range ints {
+		ret = append(ret, new(big.Rat).SetInt64(v))
 	}
-	return v, err
+	return ret, nil
 }
 
-func decodeInt(obj interface{}, vm, ref *k6tv1.VirtualMachine) (int64, error) {
-	v, err := decodeInts(obj, vm, ref)
+func decodeNumber(obj interface{}, vm, ref *k6tv1.VirtualMachine) (*big.Rat, error) {
+	v, err := decodeNumbers(obj, vm, ref)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 	if len(v) != 1 {
-		return 0, fmt.Errorf("expected one value, found %v", len(v))
+		return nil, fmt.Errorf("expected one value, found %v", len(v))
 	}
 	return v[0], nil
 }
@@ -152,11 +285,19 @@ func decodeStrings(s string, vm, ref *k6tv1.VirtualMachine) ([]string, error) {
 	if !isJSONPath(s) {
 		return []string{s}, nil
 	}
-	v, err := decodeJSONPathString(s, vm)
+	path, err := lookupPath(s, vm, ref)
 	if err != nil {
-		v, err = decodeJSONPathString(s, ref)
+		return nil, err
 	}
-	return v, err
+	return path.AsString()
+}
+
+// decodeStringParam is like decodeStrings, but accepts any literal value, e.g. a default.
+func decodeStringParam(obj interface{}, vm, ref *k6tv1.VirtualMachine) ([]string, error) {
+	if s, ok := obj.(string); ok {
+		return decodeStrings(s, vm, ref)
+	}
+	return []string{valueAsString(obj)}, nil
 }
 
 func decodeString(s string, vm, ref *k6tv1.VirtualMachine) (string, error) {
@@ -170,20 +311,58 @@ func decodeString(s string, vm, ref *k6tv1.VirtualMachine) (string, error) {
 	return vals[0], nil
 }
 
-func decodeInt64FromJSONPath(jsonPath string, vm *k6tv1.VirtualMachine) ([]int64, error) {
-	path, err := findJsonPath(jsonPath, vm)
+// The first argument is either a single literal quantity (a number or a string like "1Gi"),
+// an expression yielding one quantity, or a JSON path to one or more quantities.
+func decodeQuantities(obj interface{}, vm, ref *k6tv1.VirtualMachine) ([]resource.Quantity, error) {
+	if isExpressionParam(obj) {
+		res, err := evaluateExpression(obj, vm, ref)
+		if err != nil {
+			return nil, err
+		}
+		return []resource.Quantity{res.AsQuantity()}, nil
+	}
+	if s, ok := obj.(string); !ok || !isJSONPath(s) {
+		if val, ok := toQuantity(obj); ok {
+			return []resource.Quantity{val}, nil
+		}
+		return nil, fmt.Errorf("unsupported quantity %v (%v)", obj, reflect.TypeOf(obj).Name())
+	}
+
+	path, err := lookupPath(obj.(string), vm, ref)
 	if err != nil {
 		return nil, err
 	}
-	return path.AsInt64()
+	return path.AsQuantity()
 }
 
-func decodeJSONPathString(jsonPath string, vm *k6tv1.VirtualMachine) ([]string, error) {
-	path, err := findJsonPath(jsonPath, vm)
+func decodeQuantity(obj interface{}, vm, ref *k6tv1.VirtualMachine) (resource.Quantity, error) {
+	v, err := decodeQuantities(obj, vm, ref)
+	if err != nil {
+		return resource.Quantity{}, err
+	}
+	if len(v) != 1 {
+		return resource.Quantity{}, fmt.Errorf("expected one value, found %v", len(v))
+	}
+	return v[0], nil
+}
+
+func decodeBools(s string, vm, ref *k6tv1.VirtualMachine) ([]bool, error) {
+	path, err := lookupPath(s, vm, ref)
 	if err != nil {
 		return nil, err
 	}
-	return path.AsString()
+	return path.AsBool()
+}
+
+// decodeBoolParam is like decodeBools, but accepts a literal boolean too, e.g. a default.
+func decodeBoolParam(obj interface{}, vm, ref *k6tv1.VirtualMachine) ([]bool, error) {
+	if s, ok := obj.(string); ok && isJSONPath(s) {
+		return decodeBools(s, vm, ref)
+	}
+	if v, ok := toBool(obj); ok {
+		return []bool{v}, nil
+	}
+	return nil, fmt.Errorf("unsupported boolean value %v", obj)
 }
 
 func findJsonPath(jsonPath string, vm *k6tv1.VirtualMachine) (*Path, error) {
@@ -198,9 +377,45 @@ func findJsonPath(jsonPath string, vm *k6tv1.VirtualMachine) (*Path, error) {
 	return path, nil
 }
 
+// lookupPath finds the values at the path on the VM, falling back to the reference VM
+// when the path is missing, so optional values read as their zero value.
+// A nil leaf (e.g. `memory: {}` without `guest`) is missing just like its absent parent.
+func lookupPath(jsonPath string, vm, ref *k6tv1.VirtualMachine) (*Path, error) {
+	path, err := findJsonPath(jsonPath, vm)
+	if err != nil || path.hasOnlyNilLeaves() {
+		return findRefPath(jsonPath, ref)
+	}
+	return path, nil
+}
+
+// findRefPath finds the values at the path on the reference VM. The reference VM can't have
+// everything, e.g. the keys of the labels or the annotations: the paths it lacks are missing
+// optional values if the schema of the VM knows them, and bogus paths otherwise.
+func findRefPath(jsonPath string, ref *k6tv1.VirtualMachine) (*Path, error) {
+	path, err := findJsonPath(jsonPath, ref)
+	if err != ErrInvalidJSONPath {
+		return path, err
+	}
+	if _, schemaErr := checkSchemaPath(jsonPath); schemaErr != nil {
+		return nil, err
+	}
+	return &Path{}, nil
+}
+
+// checkMissingPath tells a missing optional subpath apart from a bogus path,
+// once the lookup on the VM failed.
+func checkMissingPath(jsonPath string, ref *k6tv1.VirtualMachine) error {
+	_, err := findRefPath(jsonPath, ref)
+	return err
+}
+
 func NewIntRule(r *Rule, vm, ref *k6tv1.VirtualMachine) (RuleApplier, error) {
-	ir := intRule{Ref: r}
-	err := ir.Value.Decode(r.Min, r.Max, vm, ref)
+	q, err := r.getQuantifier()
+	if err != nil {
+		return nil, err
+	}
+	ir := intRule{Ref: r, Quantifier: q}
+	err = ir.Value.Decode(r.param(r.Min), r.param(r.Max), vm, ref)
 	if err != nil {
 		return nil, err
 	}
@@ -208,66 +423,190 @@ func NewIntRule(r *Rule, vm, ref *k6tv1.VirtualMachine) (RuleApplier, error) {
 }
 
 func (ir *intRule) Apply(vm, ref *k6tv1.VirtualMachine) (bool, error) {
-	vals, err := decodeInts(ir.Ref.Path, vm, ref)
+	src, missing, err := resolveMissing(ir.Ref, vm, ref)
 	if err != nil {
 		return false, err
 	}
-	if len(vals) == 0 {
+	ir.Missing = missing
+	if missing.fails() {
+		ir.Satisfied = false
+		return false, nil
+	}
+
+	vals, err := decodeNumbers(ir.Ref.param(src), vm, ref)
+	if err != nil {
+		return false, err
+	}
+	if len(vals) == 0 && ir.Quantifier.isAll() {
 		return false, ErrNoValuesFound
 	}
 
 	ir.Current = vals
-	satisfied := true
+	ir.Explanations = explainExpressions(vm, ref, ir.Ref.param(ir.Ref.Path), ir.Ref.param(ir.Ref.Min), ir.Ref.param(ir.Ref.Max))
+	ir.Matched = 0
 	for _, val := range vals {
-		if !ir.Value.Includes(val) {
-			satisfied = false
-			break
+		if ir.Value.Includes(val) {
+			ir.Matched++
 		}
 	}
 
-	ir.Satisfied = satisfied
+	ir.Satisfied = ir.Quantifier.holds(ir.Matched, len(vals))
 	return ir.Satisfied, nil
 }
 
 func (ir *intRule) String() string {
-	lowerBound := "N/A"
-	if ir.Value.MinSet {
-		lowerBound = strconv.FormatInt(ir.Value.Min, 10)
-	}
-	upperBound := "N/A"
-	if ir.Value.MaxSet {
-		upperBound = strconv.FormatInt(ir.Value.Max, 10)
-	}
+	return ir.Missing.annotate(ir.message())
+}
+
+func (ir *intRule) message() string {
+	lowerBound, upperBound := ir.Value.bounds()
+	current := formatNumbers(ir.Current)
 
+	if !ir.Quantifier.isAll() {
+		predicate := fmt.Sprintf("are in interval [%s, %s]", lowerBound, upperBound)
+		return withExplanations(ir.Quantifier.explain(ir.Matched, strings.Join(current, ", "), predicate), ir.Explanations)
+	}
 	if ir.Satisfied {
-		return fmt.Sprintf("All values %v are in interval [%s, %s]", ir.Current, lowerBound, upperBound)
+		return withExplanations(fmt.Sprintf("All values %v are in interval [%s, %s]", current, lowerBound, upperBound), ir.Explanations)
 	} else {
 		errorMessage := ""
 		for i, value := range ir.Current {
-			if ir.Value.MinSet && value < ir.Value.Min {
-				errorMessage += fmt.Sprintf("value %v is lower than minimum [%s]", value, lowerBound)
+			if ir.Value.MinSet && value.Cmp(ir.Value.Min) < 0 {
+				errorMessage += fmt.Sprintf("value %s is lower than minimum [%s]", current[i], lowerBound)
 			}
-			if ir.Value.MaxSet && value > ir.Value.Max {
-				errorMessage += fmt.Sprintf("value %v is higher than maximum [%s]", value, upperBound)
+			if ir.Value.MaxSet && value.Cmp(ir.Value.Max) > 0 {
+				errorMessage += fmt.Sprintf("value %s is higher than maximum [%s]", current[i], upperBound)
 			}
 			if i != (len(ir.Current) - 1) {
 				errorMessage += ", "
 			}
 		}
-		return errorMessage
+		return withExplanations(errorMessage, ir.Explanations)
+	}
+}
+
+func withExplanations(message string, explanations []string) string {
+	if len(explanations) == 0 {
+		return message
+	}
+	return fmt.Sprintf("%s (%s)", message, strings.Join(explanations, "; "))
+}
+
+type quantityRule struct {
+	Ref          *Rule
+	Value        QuantityRange
+	Quantifier   quantifier
+	Current      []resource.Quantity
+	Matched      int
+	Satisfied    bool
+	Explanations []string
+	Missing      missingValue
+}
+
+func NewQuantityRule(r *Rule, vm, ref *k6tv1.VirtualMachine) (RuleApplier, error) {
+	q, err := r.getQuantifier()
+	if err != nil {
+		return nil, err
+	}
+	qr := quantityRule{Ref: r, Quantifier: q}
+	err = qr.Value.Decode(r.param(r.Min), r.param(r.Max), vm, ref)
+	if err != nil {
+		return nil, err
 	}
+	return &qr, nil
+}
+
+func (qr *quantityRule) Apply(vm, ref *k6tv1.VirtualMachine) (bool, error) {
+	src, missing, err := resolveMissing(qr.Ref, vm, ref)
+	if err != nil {
+		return false, err
+	}
+	qr.Missing = missing
+	if missing.fails() {
+		qr.Satisfied = false
+		return false, nil
+	}
+
+	vals, err := decodeQuantities(qr.Ref.param(src), vm, ref)
+	if err != nil {
+		return false, err
+	}
+	if len(vals) == 0 && qr.Quantifier.isAll() {
+		return false, ErrNoValuesFound
+	}
+
+	qr.Current = vals
+	qr.Explanations = explainExpressions(vm, ref, qr.Ref.param(qr.Ref.Path), qr.Ref.param(qr.Ref.Min), qr.Ref.param(qr.Ref.Max))
+	qr.Matched = 0
+	for _, val := range vals {
+		if qr.Value.Includes(val) {
+			qr.Matched++
+		}
+	}
+
+	qr.Satisfied = qr.Quantifier.holds(qr.Matched, len(vals))
+	return qr.Satisfied, nil
+}
+
+func (qr *quantityRule) String() string {
+	return qr.Missing.annotate(qr.message())
+}
+
+func (qr *quantityRule) message() string {
+	lowerBound := "N/A"
+	if qr.Value.MinSet {
+		lowerBound = qr.Value.Min.String()
+	}
+	upperBound := "N/A"
+	if qr.Value.MaxSet {
+		upperBound = qr.Value.Max.String()
+	}
+
+	if !qr.Quantifier.isAll() {
+		predicate := fmt.Sprintf("are in interval [%s, %s]", lowerBound, upperBound)
+		return withExplanations(qr.Quantifier.explain(qr.Matched, strings.Join(quantitiesToStrings(qr.Current), ", "), predicate), qr.Explanations)
+	}
+	if qr.Satisfied {
+		return withExplanations(fmt.Sprintf("All values [%s] are in interval [%s, %s]", strings.Join(quantitiesToStrings(qr.Current), ", "), lowerBound, upperBound), qr.Explanations)
+	} else {
+		var errorMessages []string
+		for _, value := range qr.Current {
+			if qr.Value.MinSet && value.Cmp(qr.Value.Min) < 0 {
+				errorMessages = append(errorMessages, fmt.Sprintf("value %s is lower than minimum [%s]", value.String(), lowerBound))
+			}
+			if qr.Value.MaxSet && value.Cmp(qr.Value.Max) > 0 {
+				errorMessages = append(errorMessages, fmt.Sprintf("value %s is higher than maximum [%s]", value.String(), upperBound))
+			}
+		}
+		return withExplanations(strings.Join(errorMessages, ", "), qr.Explanations)
+	}
+}
+
+func quantitiesToStrings(vals []resource.Quantity) []string {
+	ret := make([]string, 0, len(vals))
+	for i := range vals {
+		ret = append(ret, vals[i].String())
+	}
+	return ret
 }
 
 type stringRule struct {
-	Ref       *Rule
-	Length    Range
-	Current   []string
-	Satisfied bool
+	Ref        *Rule
+	Length     Range
+	Quantifier quantifier
+	Current    []string
+	Matched    int
+	Satisfied  bool
+	Missing    missingValue
 }
 
 func NewStringRule(r *Rule, vm, ref *k6tv1.VirtualMachine) (RuleApplier, error) {
-	sr := stringRule{Ref: r}
-	err := sr.Length.Decode(r.MinLength, r.MaxLength, vm, ref)
+	q, err := r.getQuantifier()
+	if err != nil {
+		return nil, err
+	}
+	sr := stringRule{Ref: r, Quantifier: q}
+	err = sr.Length.Decode(r.param(r.MinLength), r.param(r.MaxLength), vm, ref)
 	if err != nil {
 		return nil, err
 	}
@@ -275,37 +614,47 @@ func NewStringRule(r *Rule, vm, ref *k6tv1.VirtualMachine) (RuleApplier, error)
 }
 
 func (sr *stringRule) Apply(vm, ref *k6tv1.VirtualMachine) (bool, error) {
-	vals, err := decodeStrings(sr.Ref.Path, vm, ref)
+	src, missing, err := resolveMissing(sr.Ref, vm, ref)
 	if err != nil {
 		return false, err
 	}
-	if len(vals) == 0 {
+	sr.Missing = missing
+	if missing.fails() {
+		sr.Satisfied = false
+		return false, nil
+	}
+
+	vals, err := decodeStringParam(src, vm, ref)
+	if err != nil {
+		return false, err
+	}
+	if len(vals) == 0 && sr.Quantifier.isAll() {
 		return false, ErrNoValuesFound
 	}
 
 	sr.Current = vals
-	satisfied := true
+	sr.Matched = 0
 	for _, val := range vals {
-		if !sr.Length.Includes(int64(len(val))) {
-			satisfied = false
-			break
+		if sr.Length.IncludesInt(int64(len(val))) {
+			sr.Matched++
 		}
 	}
 
-	sr.Satisfied = satisfied
+	sr.Satisfied = sr.Quantifier.holds(sr.Matched, len(vals))
 	return sr.Satisfied, nil
 }
 
 func (sr *stringRule) String() string {
-	lowerBound := "N/A"
-	if sr.Length.MinSet {
-		lowerBound = strconv.FormatInt(sr.Length.Min, 10)
-	}
-	upperBound := "N/A"
-	if sr.Length.MaxSet {
-		upperBound = strconv.FormatInt(sr.Length.Max, 10)
-	}
+	return sr.Missing.annotate(sr.message())
+}
+
+func (sr *stringRule) message() string {
+	lowerBound, upperBound := sr.Length.bounds()
 
+	if !sr.Quantifier.isAll() {
+		predicate := fmt.Sprintf("have lengths in interval [%s, %s]", lowerBound, upperBound)
+		return sr.Quantifier.explain(sr.Matched, strings.Join(sr.Current, ", "), predicate)
+	}
 	if sr.Satisfied {
 		return fmt.Sprintf("Lengts of all strings are in interval [%s, %s]", lowerBound, upperBound)
 	} else {
@@ -314,14 +663,21 @@ func (sr *stringRule) String() string {
 }
 
 type enumRule struct {
-	Ref       *Rule
-	Values    []string
-	Current   []string
-	Satisfied bool
+	Ref        *Rule
+	Values     []string
+	Quantifier quantifier
+	Current    []string
+	Matched    int
+	Satisfied  bool
+	Missing    missingValue
 }
 
 func NewEnumRule(r *Rule, vm, ref *k6tv1.VirtualMachine) (RuleApplier, error) {
-	er := enumRule{Ref: r}
+	q, err := r.getQuantifier()
+	if err != nil {
+		return nil, err
+	}
+	er := enumRule{Ref: r, Quantifier: q}
 	for _, v := range r.Values {
 		s, err := decodeString(v, vm, ref)
 		if err != nil {
@@ -333,16 +689,32 @@ func NewEnumRule(r *Rule, vm, ref *k6tv1.VirtualMachine) (RuleApplier, error) {
 }
 
 func (er *enumRule) Apply(vm, ref *k6tv1.VirtualMachine) (bool, error) {
-	vals, err := decodeStrings(er.Ref.Path, vm, ref)
+	src, missing, err := resolveMissing(er.Ref, vm, ref)
+	if err != nil {
+		return false, err
+	}
+	er.Missing = missing
+	if missing.fails() {
+		er.Satisfied = false
+		return false, nil
+	}
+
+	vals, err := decodeStringParam(src, vm, ref)
 	if err != nil {
 		return false, err
 	}
-	if len(vals) == 0 {
+	if len(vals) == 0 && er.Quantifier.isAll() {
 		return false, ErrNoValuesFound
 	}
 
 	er.Current = vals
-	er.Satisfied = containsOnly(vals, er.Values)
+	er.Matched = 0
+	for _, val := range vals {
+		if containsOnly([]string{val}, er.Values) {
+			er.Matched++
+		}
+	}
+	er.Satisfied = er.Quantifier.holds(er.Matched, len(vals))
 	return er.Satisfied, nil
 }
 
@@ -360,6 +732,14 @@ outerLoop:
 }
 
 func (er *enumRule) String() string {
+	return er.Missing.annotate(er.message())
+}
+
+func (er *enumRule) message() string {
+	if !er.Quantifier.isAll() {
+		predicate := fmt.Sprintf("are in [%s]", strings.Join(er.Values, ", "))
+		return er.Quantifier.explain(er.Matched, strings.Join(er.Current, ", "), predicate)
+	}
 	if er.Satisfied {
 		return fmt.Sprintf("All [%s] are in [%s]",
 			strings.Join(er.Current, ", "),
@@ -372,49 +752,230 @@ func (er *enumRule) String() string {
 }
 
 type regexRule struct {
-	Ref       *Rule
-	Regex     *regexp.Regexp
-	Current   []string
-	Satisfied bool
+	Ref        *Rule
+	Regex      *regexp.Regexp
+	Quantifier quantifier
+	Current    []string
+	Matched    int
+	Satisfied  bool
+	Missing    missingValue
 }
 
 func NewRegexRule(r *Rule) (RuleApplier, error) {
-	regex, err := regexp.Compile(r.Regex)
+	if r.compileErr != nil {
+		return nil, r.compileErr
+	}
+	q, err := r.getQuantifier()
 	if err != nil {
 		return nil, err
 	}
 	return &regexRule{
-		Ref:   r,
-		Regex: regex,
+		Ref:        r,
+		Regex:      r.regex,
+		Quantifier: q,
 	}, nil
 }
 
 func (rr *regexRule) Apply(vm, ref *k6tv1.VirtualMachine) (bool, error) {
-	vals, err := decodeStrings(rr.Ref.Path, vm, ref)
+	src, missing, err := resolveMissing(rr.Ref, vm, ref)
 	if err != nil {
 		return false, err
 	}
-	if len(vals) == 0 {
+	rr.Missing = missing
+	if missing.fails() {
+		rr.Satisfied = false
+		return false, nil
+	}
+
+	vals, err := decodeStringParam(src, vm, ref)
+	if err != nil {
+		return false, err
+	}
+	if len(vals) == 0 && rr.Quantifier.isAll() {
 		return false, ErrNoValuesFound
 	}
 
 	rr.Current = vals
-	satisfied := true
+	rr.Matched = 0
 	for _, val := range vals {
-		if !rr.Regex.MatchString(val) {
-			satisfied = false
-			break
+		if rr.Regex.MatchString(val) {
+			rr.Matched++
 		}
 	}
 
-	rr.Satisfied = satisfied
+	rr.Satisfied = rr.Quantifier.holds(rr.Matched, len(vals))
 	return rr.Satisfied, nil
 }
 
 func (rr *regexRule) String() string {
+	return rr.Missing.annotate(rr.message())
+}
+
+func (rr *regexRule) message() string {
+	if !rr.Quantifier.isAll() {
+		return rr.Quantifier.explain(rr.Matched, strings.Join(rr.Current, ", "), fmt.Sprintf("match %s", rr.Regex))
+	}
 	if rr.Satisfied {
 		return fmt.Sprintf("All [%s] match %s", strings.Join(rr.Current, ", "), rr.Regex)
 	} else {
 		return fmt.Sprintf("Some of [%s] do not match %s", strings.Join(rr.Current, ", "), rr.Regex)
 	}
 }
+
+type boolRule struct {
+	Ref        *Rule
+	Expected   bool
+	Quantifier quantifier
+	Current    []bool
+	Matched    int
+	Satisfied  bool
+	Missing    missingValue
+}
+
+func NewBoolRule(r *Rule) (RuleApplier, error) {
+	q, err := r.getQuantifier()
+	if err != nil {
+		return nil, err
+	}
+	br := boolRule{
+		Ref:        r,
+		Expected:   true,
+		Quantifier: q,
+	}
+	if r.Value != nil {
+		v, ok := toBool(r.Value)
+		if !ok {
+			return nil, fmt.Errorf("unsupported boolean value %v", r.Value)
+		}
+		br.Expected = v
+	}
+	return &br, nil
+}
+
+func (br *boolRule) Apply(vm, ref *k6tv1.VirtualMachine) (bool, error) {
+	src, missing, err := resolveMissing(br.Ref, vm, ref)
+	if err != nil {
+		return false, err
+	}
+	br.Missing = missing
+	if missing.fails() {
+		br.Satisfied = false
+		return false, nil
+	}
+
+	vals, err := decodeBoolParam(src, vm, ref)
+	if err != nil {
+		return false, err
+	}
+	if len(vals) == 0 && br.Quantifier.isAll() {
+		return false, ErrNoValuesFound
+	}
+
+	br.Current = vals
+	br.Matched = 0
+	for _, val := range vals {
+		if val == br.Expected {
+			br.Matched++
+		}
+	}
+
+	br.Satisfied = br.Quantifier.holds(br.Matched, len(vals))
+	return br.Satisfied, nil
+}
+
+func (br *boolRule) String() string {
+	return br.Missing.annotate(br.message())
+}
+
+func (br *boolRule) message() string {
+	if !br.Quantifier.isAll() {
+		return br.Quantifier.explain(br.Matched, joinValues(br.Current), fmt.Sprintf("are %v", br.Expected))
+	}
+	if br.Satisfied {
+		return fmt.Sprintf("All values %v are %v", br.Current, br.Expected)
+	} else {
+		return fmt.Sprintf("Some of %v are not %v", br.Current, br.Expected)
+	}
+}
+
+// presenceRule checks if a path is set or not set. Unlike the other rules,
+// it never looks at the reference VM for values, because the zero-initialized
+// reference VM has all the optional fields set by construction.
+// The reference VM is used only to tell bogus paths apart from missing values.
+// The quantifier counts the values which are set (required) or missing (forbidden).
+type presenceRule struct {
+	Ref        *Rule
+	Required   bool
+	Quantifier quantifier
+	Found      int
+	Total      int
+	Satisfied  bool
+}
+
+func NewPresenceRule(r *Rule, required bool) (RuleApplier, error) {
+	fallback := QuantifierAll
+	if required {
+		fallback = QuantifierAny
+	}
+	q, err := parseQuantifier(r.Quantifier, fallback)
+	if err != nil {
+		return nil, err
+	}
+	return &presenceRule{
+		Ref:        r,
+		Required:   required,
+		Quantifier: q,
+	}, nil
+}
+
+func (pr *presenceRule) Apply(vm, ref *k6tv1.VirtualMachine) (bool, error) {
+	path, err := NewPath(pr.Ref.Path)
+	if err != nil {
+		return false, err
+	}
+	err = path.Find(vm)
+	if err == ErrInvalidJSONPath {
+		// missing optional subpath or bogus path?
+		if refErr := checkMissingPath(pr.Ref.Path, ref); refErr != nil {
+			return false, refErr
+		}
+		pr.Found = 0
+		pr.Total = 0
+	} else if err != nil {
+		return false, err
+	} else {
+		pr.Found = path.CountPresent()
+		pr.Total = path.Len()
+	}
+
+	pr.Satisfied = pr.Quantifier.holds(pr.matched(), pr.Total)
+	return pr.Satisfied, nil
+}
+
+func (pr *presenceRule) matched() int {
+	if pr.Required {
+		return pr.Found
+	}
+	return pr.Total - pr.Found
+}
+
+func (pr *presenceRule) String() string {
+	path := TrimJSONPath(pr.Ref.Path)
+	if pr.Ref.Quantifier != "" {
+		predicate := "set"
+		if !pr.Required {
+			predicate = "missing"
+		}
+		return fmt.Sprintf("%d of the %d values of %s are %s, expected %s", pr.matched(), pr.Total, path, predicate, pr.Quantifier)
+	}
+	if pr.Required {
+		if pr.Satisfied {
+			return fmt.Sprintf("Required value %s is present", path)
+		}
+		return fmt.Sprintf("Required value %s is missing", path)
+	}
+	if pr.Satisfied {
+		return fmt.Sprintf("Forbidden value %s is not set", path)
+	}
+	return fmt.Sprintf("Forbidden value %s is set (%d values found)", path, pr.Found)
+}
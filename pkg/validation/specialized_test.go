@@ -37,6 +37,31 @@ var _ = Describe("Specialized", func() {
 			expectRuleApplicationSuccess(&r, vmCirros, vmRef)
 		})
 
+		It("Should apply simple quantity rules", func() {
+			r := validation.Rule{
+				Rule:    "quantity",
+				Name:    "EnoughMemory",
+				Path:    "jsonpath::.spec.domain.resources.requests.memory",
+				Message: "Memory size not in range",
+				Min:     "64Mi",
+				Max:     "1Gi",
+			}
+			expectRuleApplicationSuccess(&r, vmCirros, vmRef)
+		})
+
+		It("Should apply quantity rules to fractional values", func() {
+			vmCirros.Spec.Template.Spec.Domain.Resources.Requests[k8sv1.ResourceCPU] = resource.MustParse("500m")
+			r := validation.Rule{
+				Rule:    "quantity",
+				Name:    "EnoughCPU",
+				Path:    "jsonpath::.spec.domain.resources.requests.cpu",
+				Message: "CPU request not in range",
+				Min:     "250m",
+				Max:     1,
+			}
+			expectRuleApplicationSuccess(&r, vmCirros, vmRef)
+		})
+
 		It("Should apply simple string rules", func() {
 			r := validation.Rule{
 				Rule:      "string",
@@ -92,6 +117,60 @@ var _ = Describe("Specialized", func() {
 			}
 			expectRuleApplicationSuccess(&r, vmCirros, vmRef)
 		})
+		It("Should apply simple bool rules", func() {
+			_true := true
+			vmCirros.Spec.Template.Spec.Domain.Features = &k6tv1.Features{
+				SMM: &k6tv1.FeatureState{Enabled: &_true},
+			}
+			r := validation.Rule{
+				Rule:    "bool",
+				Name:    "SMMEnabled",
+				Path:    "jsonpath::.spec.domain.features.smm.enabled",
+				Message: "SMM must be enabled",
+			}
+			expectRuleApplicationSuccess(&r, vmCirros, vmRef)
+		})
+
+		It("Should apply bool rules with explicit value", func() {
+			r := validation.Rule{
+				Rule:    "bool",
+				Name:    "SMMDisabled",
+				Path:    "jsonpath::.spec.domain.features.smm.enabled",
+				Message: "SMM must not be enabled",
+				Value:   false,
+			}
+			expectRuleApplicationSuccess(&r, vmCirros, vmRef)
+		})
+
+		It("Should apply required rules", func() {
+			r := validation.Rule{
+				Rule:    "required",
+				Name:    "HasMachineType",
+				Path:    "jsonpath::.spec.domain.machine.type",
+				Message: "machine type must be set",
+			}
+			expectRuleApplicationSuccess(&r, vmCirros, vmRef)
+		})
+
+		It("Should apply forbidden rules", func() {
+			r := validation.Rule{
+				Rule:    "forbidden",
+				Name:    "NoHostDevices",
+				Path:    "jsonpath::.spec.domain.devices.hostDevices",
+				Message: "host devices must not be set",
+			}
+			expectRuleApplicationSuccess(&r, vmCirros, vmRef)
+		})
+
+		It("Should apply forbidden rules to missing optional paths", func() {
+			r := validation.Rule{
+				Rule:    "forbidden",
+				Name:    "NoSMM",
+				Path:    "jsonpath::.spec.domain.features.smm",
+				Message: "SMM must not be configured",
+			}
+			expectRuleApplicationSuccess(&r, vmCirros, vmRef)
+		})
 	})
 
 	Context("With invalid data", func() {
@@ -144,6 +223,96 @@ var _ = Describe("Specialized", func() {
 			expectRuleApplicationFailure(&r2, vmCirros, vmRef)
 		})
 
+		It("Should fail simple quantity rules", func() {
+			r1 := validation.Rule{
+				Rule:    "quantity",
+				Name:    "EnoughMemory",
+				Path:    "jsonpath::.spec.domain.resources.requests.memory",
+				Message: "Memory size not in range",
+				Min:     "1Gi",
+			}
+			expectRuleApplicationFailure(&r1, vmCirros, vmRef)
+
+			r2 := validation.Rule{
+				Rule:    "quantity",
+				Name:    "EnoughMemory",
+				Path:    "jsonpath::.spec.domain.resources.requests.memory",
+				Message: "Memory size not in range",
+				Max:     "64Mi",
+			}
+			expectRuleApplicationFailure(&r2, vmCirros, vmRef)
+		})
+
+		It("Should reject malformed quantity bounds", func() {
+			r := validation.Rule{
+				Rule:    "quantity",
+				Name:    "EnoughMemory",
+				Path:    "jsonpath::.spec.domain.resources.requests.memory",
+				Message: "Memory size not in range",
+				Min:     "one gigabyte",
+			}
+			ra, err := r.Specialize(vmCirros, vmRef)
+			Expect(err).To(HaveOccurred())
+			Expect(ra).To(BeNil())
+		})
+
+		It("Should fail simple bool rules", func() {
+			r := validation.Rule{
+				Rule:    "bool",
+				Name:    "SMMEnabled",
+				Path:    "jsonpath::.spec.domain.features.smm.enabled",
+				Message: "SMM must be enabled",
+			}
+			expectRuleApplicationFailure(&r, vmCirros, vmRef)
+		})
+
+		It("Should reject bool rules with non-boolean value", func() {
+			r := validation.Rule{
+				Rule:    "bool",
+				Name:    "SMMEnabled",
+				Path:    "jsonpath::.spec.domain.features.smm.enabled",
+				Message: "SMM must be enabled",
+				Value:   "yes",
+			}
+			ra, err := r.Specialize(vmCirros, vmRef)
+			Expect(err).To(HaveOccurred())
+			Expect(ra).To(BeNil())
+		})
+
+		It("Should fail required rules on missing optional paths", func() {
+			r := validation.Rule{
+				Rule:    "required",
+				Name:    "HasCPU",
+				Path:    "jsonpath::.spec.domain.cpu.cores",
+				Message: "cores must be set",
+			}
+			expectRuleApplicationFailure(&r, vmCirros, vmRef)
+		})
+
+		It("Should fail forbidden rules when values are set", func() {
+			vmCirros.Spec.Template.Spec.Domain.Devices.HostDevices = []k6tv1.HostDevice{{
+				Name:       "gpu",
+				DeviceName: "nvidia.com/TU104GL_Tesla_T4",
+			}}
+			r := validation.Rule{
+				Rule:    "forbidden",
+				Name:    "NoHostDevices",
+				Path:    "jsonpath::.spec.domain.devices.hostDevices",
+				Message: "host devices must not be set",
+			}
+			expectRuleApplicationFailure(&r, vmCirros, vmRef)
+		})
+
+		It("Should error presence rules with bogus paths", func() {
+			r := validation.Rule{
+				Rule:    "forbidden",
+				Name:    "NoHostDevices",
+				Path:    "jsonpath::.spec.domain.this.path.does.not.exist",
+				Message: "host devices must not be set",
+			}
+			expectRuleApplicationError(&r, vmCirros, vmRef)
+		})
+
 		It("Should apply simple string rules", func() {
 			r1 := validation.Rule{
 				Rule:      "string",
@@ -282,6 +451,31 @@ var _ = Describe("Specialized", func() {
 			Expect(result).To(Equal("value 10000000000 is higher than maximum [536870912]"))
 		})
 
+		It("Should post message with units when quantity is lower", func() {
+			vmCirros.Spec.Template.Spec.Domain.Resources.Requests = k8sv1.ResourceList{
+				k8sv1.ResourceMemory: resource.MustParse("512Mi"),
+			}
+
+			r := validation.Rule{
+				Rule:    "quantity",
+				Name:    "EnoughMemory",
+				Path:    "jsonpath::.spec.domain.resources.requests.memory",
+				Message: "Memory size not in range",
+				Min:     "1Gi",
+				Max:     "64Gi",
+			}
+			ra, err := r.Specialize(vmCirros, vmRef)
+			Expect(err).To(BeNil())
+			Expect(ra).To(Not(BeNil()))
+
+			ok, err := ra.Apply(vmCirros, vmRef)
+			Expect(err).To(BeNil())
+			Expect(ok).To(Equal(false))
+
+			result := ra.String()
+			Expect(result).To(Equal("value 512Mi is lower than minimum [1Gi]"))
+		})
+
 		It("Should post message when value is winthin limits", func() {
 			vmCirros.Spec.Template.Spec.Domain.Resources.Requests = k8sv1.ResourceList{
 				k8sv1.ResourceMemory: resource.MustParse("68M"),
@@ -0,0 +1,205 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2019 Red Hat, Inc.
+ */
+
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+
+	k6tv1 "kubevirt.io/client-go/api/v1"
+)
+
+// On updates, the rules can compare the VM with its previous version:
+// immutable rules check that the values found at their path did not change, e.g.
+//   {"rule": "immutable", "path": "jsonpath::.spec.domain.firmware.uuid"}
+// transition rules check that the value found at their path changed only as allowed, e.g.
+//   {"rule": "transition", "path": "vm::.spec.runStrategy",
+//    "transitions": [{"from": "Manual", "to": "Always"}, {"from": "*", "to": "Halted"}]}
+// An unset value is "", and "*" matches any value. Both are always satisfied on creation.
+// The operations key limits any rule to the creation or to the updates of the VM.
+
+const (
+	ruleImmutable  string = "immutable"
+	ruleTransition string = "transition"
+
+	OperationCreate string = "CREATE"
+	OperationUpdate string = "UPDATE"
+
+	anyValue string = "*"
+)
+
+var ErrInvalidOperation = errors.New("unrecognized operation")
+
+// Transition is a change of value allowed by a transition rule.
+type Transition struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+func (t Transition) matches(from, to string) bool {
+	return (t.From == anyValue || t.From == from) && (t.To == anyValue || t.To == to)
+}
+
+func (t Transition) String() string {
+	return fmt.Sprintf("%q -> %q", t.From, t.To)
+}
+
+func isValidOperation(s string) bool {
+	return s == OperationCreate || s == OperationUpdate
+}
+
+// operation tells the admission operation, from the previous version of the VM: there is none on creation.
+func operation(oldVM *k6tv1.VirtualMachine) string {
+	if oldVM == nil {
+		return OperationCreate
+	}
+	return OperationUpdate
+}
+
+// isOperationSelected tells if the rule applies to the admission operation.
+func (r *Rule) isOperationSelected(oldVM *k6tv1.VirtualMachine) bool {
+	return len(r.Operations) == 0 || containsString(r.Operations, operation(oldVM))
+}
+
+type immutableRule struct {
+	Ref       *Rule
+	OldVM     *k6tv1.VirtualMachine
+	Previous  []string
+	Current   []string
+	Satisfied bool
+}
+
+func NewImmutableRule(r *Rule, oldVM *k6tv1.VirtualMachine) (RuleApplier, error) {
+	if !isJSONPath(r.Path) {
+		return nil, fmt.Errorf("%s rule requires a JSONPath, found %q", r.Rule, r.Path)
+	}
+	return &immutableRule{Ref: r, OldVM: oldVM}, nil
+}
+
+func (ir *immutableRule) Apply(vm, ref *k6tv1.VirtualMachine) (bool, error) {
+	current, err := findPresentValues(ir.Ref.Path, vm, ref)
+	if err != nil {
+		return false, err
+	}
+	ir.Current = valuesAsStrings(current)
+	if ir.OldVM == nil {
+		ir.Satisfied = true
+		return ir.Satisfied, nil
+	}
+
+	previous, err := findPresentValues(ir.Ref.Path, ir.OldVM, ref)
+	if err != nil {
+		return false, err
+	}
+	ir.Previous = valuesAsStrings(previous)
+	ir.Satisfied = equality.Semantic.DeepEqual(previous, current)
+	return ir.Satisfied, nil
+}
+
+func (ir *immutableRule) String() string {
+	path := TrimJSONPath(ir.Ref.Path)
+	switch {
+	case ir.OldVM == nil:
+		return fmt.Sprintf("%s is set to [%s] on creation", path, strings.Join(ir.Current, ", "))
+	case ir.Satisfied:
+		return fmt.Sprintf("%s is unchanged [%s]", path, strings.Join(ir.Current, ", "))
+	}
+	return fmt.Sprintf("%s is immutable, but changed from [%s] to [%s]", path, strings.Join(ir.Previous, ", "), strings.Join(ir.Current, ", "))
+}
+
+type transitionRule struct {
+	Ref       *Rule
+	OldVM     *k6tv1.VirtualMachine
+	Previous  string
+	Current   string
+	Satisfied bool
+}
+
+func NewTransitionRule(r *Rule, oldVM *k6tv1.VirtualMachine) (RuleApplier, error) {
+	if !isJSONPath(r.Path) {
+		return nil, fmt.Errorf("%s rule requires a JSONPath, found %q", r.Rule, r.Path)
+	}
+	if len(r.Transitions) == 0 {
+		return nil, fmt.Errorf("%s rule requires at least one transition", r.Rule)
+	}
+	return &transitionRule{Ref: r, OldVM: oldVM}, nil
+}
+
+func (tr *transitionRule) Apply(vm, ref *k6tv1.VirtualMachine) (bool, error) {
+	var err error
+	tr.Current, err = findSingleValue(tr.Ref.Path, vm, ref)
+	if err != nil {
+		return false, err
+	}
+	if tr.OldVM == nil {
+		tr.Satisfied = true
+		return tr.Satisfied, nil
+	}
+
+	tr.Previous, err = findSingleValue(tr.Ref.Path, tr.OldVM, ref)
+	if err != nil {
+		return false, err
+	}
+	tr.Satisfied = tr.Previous == tr.Current
+	for _, t := range tr.Ref.Transitions {
+		if t.matches(tr.Previous, tr.Current) {
+			tr.Satisfied = true
+		}
+	}
+	return tr.Satisfied, nil
+}
+
+func (tr *transitionRule) String() string {
+	path := TrimJSONPath(tr.Ref.Path)
+	switch {
+	case tr.OldVM == nil:
+		return fmt.Sprintf("%s is set to %q on creation", path, tr.Current)
+	case tr.Previous == tr.Current:
+		return fmt.Sprintf("%s is unchanged %q", path, tr.Current)
+	case tr.Satisfied:
+		return fmt.Sprintf("%s changed from %q to %q", path, tr.Previous, tr.Current)
+	}
+	return fmt.Sprintf("%s cannot change from %q to %q, allowed transitions: %s", path, tr.Previous, tr.Current, tr.allowed())
+}
+
+func (tr *transitionRule) allowed() string {
+	allowed := make([]string, len(tr.Ref.Transitions))
+	for i, t := range tr.Ref.Transitions {
+		allowed[i] = t.String()
+	}
+	return strings.Join(allowed, ", ")
+}
+
+// findSingleValue returns the value set at path, or "" if none is.
+func findSingleValue(path string, vm, ref *k6tv1.VirtualMachine) (string, error) {
+	values, err := findPresentValues(path, vm, ref)
+	if err != nil {
+		return "", err
+	}
+	switch len(values) {
+	case 0:
+		return "", nil
+	case 1:
+		return valueAsString(values[0]), nil
+	}
+	return "", fmt.Errorf("expected at most one value, found %v", len(values))
+}
@@ -0,0 +1,183 @@
+package validation_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	k6tv1 "kubevirt.io/client-go/api/v1"
+
+	"github.com/kubevirt/kubevirt-template-validator/pkg/validation"
+)
+
+var _ = Describe("Updates", func() {
+	var (
+		oldVM *k6tv1.VirtualMachine
+		newVM *k6tv1.VirtualMachine
+	)
+
+	BeforeEach(func() {
+		oldVM = NewVMCirros()
+		newVM = NewVMCirros()
+	})
+
+	machineTypeRule := validation.Rule{
+		Rule:    "immutable",
+		Name:    "machine-type",
+		Path:    "jsonpath::.spec.domain.machine.type",
+		Message: "the machine type can't change",
+	}
+
+	runStrategyRule := validation.Rule{
+		Rule:    "transition",
+		Name:    "run-strategy",
+		Path:    "vm::.spec.runStrategy",
+		Message: "run strategy from {{.Previous}} to {{.Value}} is not supported, expected {{.Allowed}}",
+		Transitions: []validation.Transition{
+			{From: "", To: "Manual"},
+			{From: "Manual", To: "Always"},
+			{From: "*", To: "Halted"},
+		},
+	}
+
+	setRunStrategy := func(vm *k6tv1.VirtualMachine, rs k6tv1.VirtualMachineRunStrategy) {
+		vm.Spec.Running = nil
+		vm.Spec.RunStrategy = &rs
+	}
+
+	evaluate := func(rules ...validation.Rule) *validation.Result {
+		return validation.NewEvaluator().EvaluateWithOldVM(rules, newVM, oldVM)
+	}
+
+	It("Should accept the unchanged values", func() {
+		res := evaluate(machineTypeRule)
+		Expect(res.Succeeded()).To(BeTrue())
+	})
+
+	It("Should reject the changed values", func() {
+		newVM.Spec.Template.Spec.Domain.Machine.Type = "pc"
+		res := evaluate(machineTypeRule)
+		Expect(res.Succeeded()).To(BeFalse())
+		causes := res.Causes()
+		Expect(causes).To(HaveLen(1))
+		Expect(causes[0].Field).To(Equal("spec.template.spec.domain.machine.type"))
+		Expect(causes[0].Message).To(Equal("the machine type can't change: .spec.domain.machine.type is immutable, but changed from [q35] to [pc]"))
+	})
+
+	It("Should reject the values set or unset after creation", func() {
+		newVM.Spec.Template.Spec.Domain.Firmware = &k6tv1.Firmware{UUID: "5d307ca9-b3ef-428c-8861-06e72d69f223"}
+		res := evaluate(validation.Rule{
+			Rule:    "immutable",
+			Name:    "firmware-uuid",
+			Path:    "jsonpath::.spec.domain.firmware.uuid",
+			Message: "the firmware UUID can't change",
+		})
+		Expect(res.Succeeded()).To(BeFalse())
+
+		newVM, oldVM = oldVM, newVM
+		res = evaluate(validation.Rule{
+			Rule:    "immutable",
+			Name:    "firmware-uuid",
+			Path:    "jsonpath::.spec.domain.firmware.uuid",
+			Message: "the firmware UUID can't change",
+		})
+		Expect(res.Succeeded()).To(BeFalse())
+	})
+
+	It("Should compare whole objects", func() {
+		newVM.Spec.Template.ObjectMeta.Labels["kubevirt.io/size"] = "small"
+		res := evaluate(validation.Rule{
+			Rule:    "immutable",
+			Name:    "template-labels",
+			Path:    "jsonpath::.metadata.labels",
+			Message: "the template labels can't change",
+		})
+		Expect(res.Succeeded()).To(BeFalse())
+	})
+
+	It("Should accept anything on creation", func() {
+		newVM.Spec.Template.Spec.Domain.Machine.Type = "pc"
+		setRunStrategy(newVM, k6tv1.RunStrategyAlways)
+		res := validation.NewEvaluator().Evaluate([]validation.Rule{machineTypeRule, runStrategyRule}, newVM)
+		Expect(res.Succeeded()).To(BeTrue())
+	})
+
+	It("Should accept the allowed transitions", func() {
+		setRunStrategy(newVM, k6tv1.RunStrategyManual)
+		Expect(evaluate(runStrategyRule).Succeeded()).To(BeTrue())
+
+		setRunStrategy(oldVM, k6tv1.RunStrategyManual)
+		setRunStrategy(newVM, k6tv1.RunStrategyAlways)
+		Expect(evaluate(runStrategyRule).Succeeded()).To(BeTrue())
+
+		setRunStrategy(oldVM, k6tv1.RunStrategyAlways)
+		setRunStrategy(newVM, k6tv1.RunStrategyHalted)
+		Expect(evaluate(runStrategyRule).Succeeded()).To(BeTrue())
+
+		setRunStrategy(oldVM, k6tv1.RunStrategyAlways)
+		setRunStrategy(newVM, k6tv1.RunStrategyAlways)
+		Expect(evaluate(runStrategyRule).Succeeded()).To(BeTrue())
+	})
+
+	It("Should reject the other transitions", func() {
+		setRunStrategy(oldVM, k6tv1.RunStrategyHalted)
+		setRunStrategy(newVM, k6tv1.RunStrategyAlways)
+		res := evaluate(runStrategyRule)
+		Expect(res.Succeeded()).To(BeFalse())
+		causes := res.Causes()
+		Expect(causes).To(HaveLen(1))
+		Expect(causes[0].Field).To(Equal("spec.runStrategy"))
+		Expect(causes[0].Message).To(Equal(`run strategy from Halted to Always is not supported, expected "" -> "Manual", "Manual" -> "Always", "*" -> "Halted"`))
+	})
+
+	It("Should limit the rules to the given operations", func() {
+		r := validation.Rule{
+			Rule:       "required",
+			Name:       "firmware-uuid",
+			Path:       "jsonpath::.spec.domain.firmware.uuid",
+			Message:    "the firmware UUID must be set on creation",
+			Operations: []string{"CREATE"},
+		}
+		res := evaluate(r)
+		Expect(res.Succeeded()).To(BeTrue())
+		Expect(res.Status).To(HaveLen(1))
+		Expect(res.Status[0].Skipped).To(BeTrue())
+
+		res = validation.NewEvaluator().Evaluate([]validation.Rule{r}, newVM)
+		Expect(res.Succeeded()).To(BeFalse())
+
+		r.Operations = []string{"DELETE"}
+		res = evaluate(r)
+		Expect(res.Succeeded()).To(BeFalse())
+		Expect(res.Status[0].Error).To(Equal(validation.ErrInvalidOperation))
+	})
+
+	It("Should lint the update rules", func() {
+		r := runStrategyRule
+		r.Transitions = nil
+		r.Operations = []string{"CREATE"}
+		issues := validation.LintRules([]validation.Rule{r})
+		Expect(issues).To(HaveLen(2))
+		Expect(issues[0].Key).To(Equal("operations"))
+		Expect(issues[1].Key).To(Equal("transitions"))
+
+		r = runStrategyRule
+		r.Transitions = []validation.Transition{{From: "Manual", To: "Manual"}}
+		r.Operations = []string{"UPDATE", "DELETE"}
+		issues = validation.LintRules([]validation.Rule{r})
+		Expect(issues).To(HaveLen(2))
+		Expect(issues[0].Key).To(Equal("operations[1]"))
+		Expect(issues[1].Key).To(Equal("transitions[0]"))
+
+		issues = validation.Lint([]byte(`
+- name: run-strategy
+  rule: transition
+  path: vm::.spec.runStrategy
+  message: unsupported run strategy change
+  transitions:
+  - from: Manual
+    into: Always
+`))
+		Expect(issues).To(HaveLen(1))
+		Expect(issues[0].Key).To(Equal("transitions[0].into"))
+	})
+})
@@ -24,14 +24,21 @@ import (
 	"io/ioutil"
 	"net/http"
 
+	admissionv1 "k8s.io/api/admission/v1"
 	"k8s.io/api/admission/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
+	templatev1 "github.com/openshift/api/template/v1"
+
 	k6tv1 "kubevirt.io/client-go/api/v1"
 )
 
+// The v1 and v1beta1 AdmissionReviews have the very same wire format, so we always
+// decode the reviews as v1, remembering which version the API server sent.
+// The responses must use the same version of the request.
+
 // GetAdmissionReview
-func GetAdmissionReview(r *http.Request) (*v1beta1.AdmissionReview, error) {
+func GetAdmissionReview(r *http.Request) (*admissionv1.AdmissionReview, error) {
 	var body []byte
 	if r.Body != nil {
 		if data, err := ioutil.ReadAll(r.Body); err == nil {
@@ -45,20 +52,51 @@ func GetAdmissionReview(r *http.Request) (*v1beta1.AdmissionReview, error) {
 		return nil, fmt.Errorf("contentType=%s, expect application/json", contentType)
 	}
 
-	ar := &v1beta1.AdmissionReview{}
+	ar := &admissionv1.AdmissionReview{}
 	err := json.Unmarshal(body, ar)
-	return ar, err
+	if err != nil {
+		return nil, err
+	}
+
+	switch ar.APIVersion {
+	case "":
+		// very old API servers may omit the version; they can only speak v1beta1
+		ar.APIVersion = v1beta1.SchemeGroupVersion.String()
+	case admissionv1.SchemeGroupVersion.String(), v1beta1.SchemeGroupVersion.String():
+		// supported
+	default:
+		return nil, fmt.Errorf("unsupported AdmissionReview version %s", ar.APIVersion)
+	}
+	if ar.Request == nil {
+		return nil, fmt.Errorf("AdmissionReview without request")
+	}
+	return ar, nil
+}
+
+// ToAdmissionReview wraps the response in an AdmissionReview of the same version of the request.
+func ToAdmissionReview(ar *admissionv1.AdmissionReview, resp *admissionv1.AdmissionResponse) *admissionv1.AdmissionReview {
+	review := &admissionv1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: ar.APIVersion,
+			Kind:       "AdmissionReview",
+		},
+		Response: resp,
+	}
+	if review.Response != nil && ar.Request != nil {
+		review.Response.UID = ar.Request.UID
+	}
+	return review
 }
 
-func ToAdmissionResponseOK() *v1beta1.AdmissionResponse {
-	reviewResponse := v1beta1.AdmissionResponse{}
+func ToAdmissionResponseOK() *admissionv1.AdmissionResponse {
+	reviewResponse := admissionv1.AdmissionResponse{}
 	reviewResponse.Allowed = true
 	return &reviewResponse
 }
 
 // ToAdmissionResponseError
-func ToAdmissionResponseError(err error) *v1beta1.AdmissionResponse {
-	return &v1beta1.AdmissionResponse{
+func ToAdmissionResponseError(err error) *admissionv1.AdmissionResponse {
+	return &admissionv1.AdmissionResponse{
 		Result: &metav1.Status{
 			Message: err.Error(),
 			Code:    http.StatusBadRequest,
@@ -66,7 +104,7 @@ func ToAdmissionResponseError(err error) *v1beta1.AdmissionResponse {
 	}
 }
 
-func ToAdmissionResponse(causes []metav1.StatusCause) *v1beta1.AdmissionResponse {
+func ToAdmissionResponse(causes []metav1.StatusCause) *admissionv1.AdmissionResponse {
 	globalMessage := ""
 	for _, cause := range causes {
 		if globalMessage == "" {
@@ -76,7 +114,7 @@ func ToAdmissionResponse(causes []metav1.StatusCause) *v1beta1.AdmissionResponse
 		}
 	}
 
-	return &v1beta1.AdmissionResponse{
+	return &admissionv1.AdmissionResponse{
 		Result: &metav1.Status{
 			Message: globalMessage,
 			Reason:  metav1.StatusReasonInvalid,
@@ -88,7 +126,7 @@ func ToAdmissionResponse(causes []metav1.StatusCause) *v1beta1.AdmissionResponse
 	}
 }
 
-func GetAdmissionReviewVM(ar *v1beta1.AdmissionReview) (*k6tv1.VirtualMachine, *k6tv1.VirtualMachine, error) {
+func GetAdmissionReviewVM(ar *admissionv1.AdmissionReview) (*k6tv1.VirtualMachine, *k6tv1.VirtualMachine, error) {
 	if ar.Request.Resource.Resource != "virtualmachines" {
 		return nil, nil, fmt.Errorf("expect resource %v to be '%s'", ar.Request.Resource, "virtualmachines")
 	}
@@ -102,7 +140,7 @@ func GetAdmissionReviewVM(ar *v1beta1.AdmissionReview) (*k6tv1.VirtualMachine, *
 		return nil, nil, err
 	}
 
-	if ar.Request.Operation == v1beta1.Update {
+	if ar.Request.Operation == admissionv1.Update {
 		raw := ar.Request.OldObject.Raw
 		oldVM := k6tv1.VirtualMachine{}
 		err = json.Unmarshal(raw, &oldVM)
@@ -114,3 +152,18 @@ func GetAdmissionReviewVM(ar *v1beta1.AdmissionReview) (*k6tv1.VirtualMachine, *
 
 	return &newVM, nil, nil
 }
+
+// GetAdmissionReviewTemplate returns the Template under review. The previous version of the Template
+// is not needed to validate it, so it is never decoded.
+func GetAdmissionReviewTemplate(ar *admissionv1.AdmissionReview) (*templatev1.Template, error) {
+	if ar.Request.Resource.Resource != "templates" {
+		return nil, fmt.Errorf("expect resource %v to be '%s'", ar.Request.Resource, "templates")
+	}
+
+	tmpl := templatev1.Template{}
+	err := json.Unmarshal(ar.Request.Object.Raw, &tmpl)
+	if err != nil {
+		return nil, err
+	}
+	return &tmpl, nil
+}
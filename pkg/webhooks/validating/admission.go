@@ -29,25 +29,49 @@ import (
 	"github.com/kubevirt/kubevirt-template-validator/pkg/validation"
 )
 
-func ValidateVMTemplate(rules []validation.Rule, newVM, oldVM *k6tv1.VirtualMachine) []metav1.StatusCause {
+// ValidateVMTemplate returns the causes of the rejection of the VM, if any, and
+// the warnings which should be reported back to the user regardless of the outcome.
+func ValidateVMTemplate(rules []validation.Rule, newVM, oldVM *k6tv1.VirtualMachine) ([]metav1.StatusCause, []string) {
+	return ValidateVMTemplateRuleSet(validation.NewRuleSet(rules), newVM, oldVM, false)
+}
+
+// ValidateVMTemplateRuleSet is like ValidateVMTemplate, with precompiled rules.
+// See EvaluateVMTemplate about ratcheting.
+func ValidateVMTemplateRuleSet(rs *validation.RuleSet, newVM, oldVM *k6tv1.VirtualMachine, ratcheting bool) ([]metav1.StatusCause, []string) {
 	var causes []metav1.StatusCause
-	if len(rules) == 0 {
+	if rs.Len() == 0 {
 		// no rules! everything is permitted, so let's bail out quickly
 		log.Log.V(8).Infof("no admission rules for: %s", newVM.Name)
-		return causes
+		return causes, nil
+	}
+
+	res := EvaluateVMTemplate(rs, newVM, oldVM, ratcheting)
+	if res.Succeeded() {
+		return causes, res.Warnings
 	}
+	return res.ToStatusCauses(), res.Warnings
+}
 
+// EvaluateVMTemplate evaluates the rules exactly like the admission does, returning the full Result.
+// With ratcheting, a VM which already violates a rule can still be updated, as long as the update
+// does not touch the values at fault. See validation.Evaluator.EvaluateRuleSetRatcheting.
+func EvaluateVMTemplate(rs *validation.RuleSet, newVM, oldVM *k6tv1.VirtualMachine, ratcheting bool) *validation.Result {
 	setDefaultValues(newVM)
+	if oldVM != nil && oldVM.Spec.Template != nil {
+		// the rules comparing the two versions must see the same defaults
+		setDefaultValues(oldVM)
+	}
 
 	buf := new(bytes.Buffer)
 	ev := validation.Evaluator{Sink: buf}
-	res := ev.Evaluate(rules, newVM)
-	log.Log.V(2).Infof("evalution summary for %s:\n%s\nsucceeded=%v", newVM.Name, buf.String(), res.Succeeded())
-
-	if res.Succeeded() {
-		return causes
+	var res *validation.Result
+	if ratcheting {
+		res = ev.EvaluateRuleSetRatcheting(rs, newVM, oldVM)
+	} else {
+		res = ev.EvaluateRuleSet(rs, newVM, oldVM)
 	}
-	return res.ToStatusCauses()
+	log.Log.V(2).Infof("evalution summary for %s:\n%s\nsucceeded=%v", newVM.Name, buf.String(), res.Succeeded())
+	return res
 }
 
 func setDefaultValues(vm *k6tv1.VirtualMachine) {
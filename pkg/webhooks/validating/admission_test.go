@@ -17,10 +17,22 @@ var _ = Describe("Admission", func() {
 			oldVM := k6tv1.VirtualMachine{}
 			var rules []validation.Rule
 
-			causes := ValidateVMTemplate(rules, &newVM, &oldVM)
+			causes, _ := ValidateVMTemplate(rules, &newVM, &oldVM)
 
 			Expect(len(causes)).To(Equal(0))
 		})
+
+		It("should share the empty rules among the VMs to skip", func() {
+			vm := k6tv1.VirtualMachine{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{vmSkipValidationAnnotationKey: ""},
+				},
+			}
+			rs, err := getValidationRuleSetForVM(&vm)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rs).To(BeIdenticalTo(noRules))
+			Expect(rs.Len()).To(BeZero())
+		})
 	})
 
 	Context("Default values", func() {
@@ -52,7 +64,7 @@ var _ = Describe("Admission", func() {
 				Min:     1,
 			}}
 
-			causes := ValidateVMTemplate(rules, &vm, &k6tv1.VirtualMachine{})
+			causes, _ := ValidateVMTemplate(rules, &vm, &k6tv1.VirtualMachine{})
 			Expect(len(causes)).To(Equal(0))
 		})
 
@@ -65,7 +77,7 @@ var _ = Describe("Admission", func() {
 				Min:     1,
 			}}
 
-			causes := ValidateVMTemplate(rules, &vm, &k6tv1.VirtualMachine{})
+			causes, _ := ValidateVMTemplate(rules, &vm, &k6tv1.VirtualMachine{})
 			Expect(len(causes)).To(Equal(0))
 		})
 
@@ -78,8 +90,83 @@ var _ = Describe("Admission", func() {
 				Min:     1,
 			}}
 
-			causes := ValidateVMTemplate(rules, &vm, &k6tv1.VirtualMachine{})
+			causes, _ := ValidateVMTemplate(rules, &vm, &k6tv1.VirtualMachine{})
+			Expect(len(causes)).To(Equal(0))
+		})
+	})
+
+	Context("Warnings", func() {
+		It("should admit and return warnings", func() {
+			vm := k6tv1.VirtualMachine{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test-vm",
+				},
+				Spec: k6tv1.VirtualMachineSpec{
+					Template: &k6tv1.VirtualMachineInstanceTemplateSpec{
+						Spec: k6tv1.VirtualMachineInstanceSpec{
+							Domain: k6tv1.DomainSpec{
+								CPU: &k6tv1.CPU{Cores: 16},
+							},
+						},
+					},
+				},
+			}
+			rules := []validation.Rule{{
+				Name:     "test-cores-warning",
+				Path:     "jsonpath::.spec.domain.cpu.cores",
+				Rule:     "integer",
+				Message:  "too many cores",
+				Max:      8,
+				Severity: validation.SeverityWarning,
+			}}
+
+			causes, warnings := ValidateVMTemplate(rules, &vm, nil)
 			Expect(len(causes)).To(Equal(0))
+			Expect(warnings).To(Equal([]string{"too many cores: value 16 is higher than maximum [8]"}))
+		})
+	})
+
+	Context("Ratcheting", func() {
+		newVM := func(cores uint32) *k6tv1.VirtualMachine {
+			return &k6tv1.VirtualMachine{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test-vm",
+				},
+				Spec: k6tv1.VirtualMachineSpec{
+					Template: &k6tv1.VirtualMachineInstanceTemplateSpec{
+						Spec: k6tv1.VirtualMachineInstanceSpec{
+							Domain: k6tv1.DomainSpec{
+								CPU: &k6tv1.CPU{Cores: cores},
+							},
+						},
+					},
+				},
+			}
+		}
+		rules := []validation.Rule{{
+			Name:    "test-cores-limit",
+			Path:    "jsonpath::.spec.domain.cpu.cores",
+			Rule:    "integer",
+			Message: "too many cores",
+			Max:     8,
+		}}
+
+		It("should reject the pre-existing violations by default", func() {
+			causes, _ := ValidateVMTemplate(rules, newVM(16), newVM(16))
+			Expect(causes).To(HaveLen(1))
+		})
+
+		It("should tolerate the pre-existing violations when enabled", func() {
+			rs := validation.NewRuleSet(rules)
+			causes, warnings := ValidateVMTemplateRuleSet(rs, newVM(16), newVM(16), true)
+			Expect(causes).To(BeEmpty())
+			Expect(warnings).To(HaveLen(1))
+
+			causes, _ = ValidateVMTemplateRuleSet(rs, newVM(16), newVM(12), true)
+			Expect(causes).To(HaveLen(1))
+
+			causes, _ = ValidateVMTemplateRuleSet(rs, newVM(16), nil, true)
+			Expect(causes).To(HaveLen(1))
 		})
 	})
 
@@ -101,11 +188,38 @@ var _ = Describe("Admission", func() {
 				Spec: k6tv1.VirtualMachineSpec{},
 			}
 
-			vmRules, err := getValidationRulesForVM(vm)
+			rs, err := getValidationRuleSetForVM(vm)
 			Expect(err).ToNot(HaveOccurred())
 
-			Expect(len(vmRules)).To(Equal(1))
-			Expect(vmRules[0].Name).To(Equal(ruleName))
+			Expect(rs.Len()).To(Equal(1))
+			Expect(rs.Rules[0].Name).To(Equal(ruleName))
+			Expect(rs.Source).To(Equal("VM annotation vm.kubevirt.io/validations"))
+		})
+
+		It("unknown keys in the validation annotation should only be warned about", func() {
+			vm := &k6tv1.VirtualMachine{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test-vm",
+					Annotations: map[string]string{
+						vmValidationAnnotationKey: `[{"name": "max-cores", "rule": "integer", "path": "jsonpath::.spec.domain.cpu.cores", "message": "too many cores", "max": 8, "newKey": true}]`,
+					},
+				},
+				Spec: k6tv1.VirtualMachineSpec{
+					Template: &k6tv1.VirtualMachineInstanceTemplateSpec{
+						Spec: k6tv1.VirtualMachineInstanceSpec{
+							Domain: k6tv1.DomainSpec{
+								CPU: &k6tv1.CPU{Cores: 2},
+							},
+						},
+					},
+				},
+			}
+
+			rs, err := getValidationRuleSetForVM(vm)
+			Expect(err).ToNot(HaveOccurred())
+			causes, warnings := ValidateVMTemplateRuleSet(rs, vm, nil, false)
+			Expect(causes).To(BeEmpty())
+			Expect(warnings).To(ConsistOf("rules[0] (max-cores) newKey: unknown key, ignored [source: VM annotation vm.kubevirt.io/validations]"))
 		})
 	})
 })
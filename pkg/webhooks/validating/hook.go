@@ -22,8 +22,7 @@ import (
 	"encoding/json"
 	"net/http"
 
-	"k8s.io/api/admission/v1beta1"
-	"k8s.io/apimachinery/pkg/runtime"
+	admissionv1 "k8s.io/api/admission/v1"
 
 	"github.com/davecgh/go-spew/spew"
 
@@ -34,15 +33,24 @@ import (
 
 const (
 	VMTemplateValidatePath string = "/virtualmachine-template-validate"
+	TemplateValidatePath   string = "/template-validate"
 )
 
-func ServeVMTemplateValidate(resp http.ResponseWriter, req *http.Request) {
-	serve(resp, req, admitVMTemplate)
+// ServeVMTemplateValidate admits the VMs. With ratcheting, the updates may keep the violations
+// of the previous version of the VM, see EvaluateVMTemplate.
+func ServeVMTemplateValidate(resp http.ResponseWriter, req *http.Request, ratcheting bool) {
+	serve(resp, req, func(ar *admissionv1.AdmissionReview) *admissionv1.AdmissionResponse {
+		return admitVMTemplate(ar, ratcheting)
+	})
 }
 
-type admitFunc func(*v1beta1.AdmissionReview) *v1beta1.AdmissionResponse
+func ServeTemplateValidate(resp http.ResponseWriter, req *http.Request) {
+	serve(resp, req, admitTemplate)
+}
+
+type admitFunc func(*admissionv1.AdmissionReview) *admissionv1.AdmissionResponse
 
-func admitVMTemplate(ar *v1beta1.AdmissionReview) *v1beta1.AdmissionResponse {
+func admitVMTemplate(ar *admissionv1.AdmissionReview, ratcheting bool) *admissionv1.AdmissionResponse {
 	newVM, oldVM, err := webhooks.GetAdmissionReviewVM(ar)
 	if err != nil {
 		return webhooks.ToAdmissionResponseError(err)
@@ -52,48 +60,69 @@ func admitVMTemplate(ar *v1beta1.AdmissionReview) *v1beta1.AdmissionResponse {
 		return webhooks.ToAdmissionResponseOK()
 	}
 
-	rules, err := getValidationRulesForVM(newVM)
+	rs, err := getValidationRuleSetForVM(newVM)
 	if err != nil {
 		return webhooks.ToAdmissionResponseError(err)
 	}
 
 	log.Log.V(8).Infof("admission newVM:\n%s", spew.Sdump(newVM))
 	log.Log.V(8).Infof("admission oldVM:\n%s", spew.Sdump(oldVM))
-	log.Log.V(8).Infof("admission rules:\n%s", spew.Sdump(rules))
+	log.Log.V(8).Infof("admission rules:\n%s", spew.Sdump(rs.Rules))
 
-	causes := ValidateVMTemplate(rules, newVM, oldVM)
+	causes, warnings := ValidateVMTemplateRuleSet(rs, newVM, oldVM, ratcheting)
+	var resp *admissionv1.AdmissionResponse
 	if len(causes) > 0 {
-		return webhooks.ToAdmissionResponse(causes)
+		resp = webhooks.ToAdmissionResponse(causes)
+	} else {
+		resp = webhooks.ToAdmissionResponseOK()
+	}
+	resp.Warnings = warnings
+	return resp
+}
+
+func admitTemplate(ar *admissionv1.AdmissionReview) *admissionv1.AdmissionResponse {
+	tmpl, err := webhooks.GetAdmissionReviewTemplate(ar)
+	if err != nil {
+		return webhooks.ToAdmissionResponseError(err)
 	}
 
-	return webhooks.ToAdmissionResponseOK()
+	if tmpl.DeletionTimestamp != nil {
+		return webhooks.ToAdmissionResponseOK()
+	}
+
+	log.Log.V(8).Infof("admission template:\n%s", spew.Sdump(tmpl))
+
+	causes, warnings := ValidateTemplate(tmpl)
+	var resp *admissionv1.AdmissionResponse
+	if len(causes) > 0 {
+		resp = webhooks.ToAdmissionResponse(causes)
+	} else {
+		resp = webhooks.ToAdmissionResponseOK()
+	}
+	resp.Warnings = warnings
+	return resp
 }
 
 func serve(resp http.ResponseWriter, req *http.Request, admit admitFunc) {
-	response := v1beta1.AdmissionReview{}
 	review, err := webhooks.GetAdmissionReview(req)
 
 	log.Log.V(8).Infof("evaluating admission")
 	defer log.Log.V(8).Infof("evaluated admission")
 
 	if err != nil {
+		log.Log.V(2).Infof("rejected malformed admission review: %v", err)
 		resp.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
-	log.Log.V(8).Infof("admission review:\n%s", spew.Sdump(review))
+	log.Log.V(8).Infof("admission review (%s):\n%s", review.APIVersion, spew.Sdump(review))
 
 	reviewResponse := admit(review)
 
 	log.Log.V(8).Infof("admission review response:\n%s", spew.Sdump(reviewResponse))
 
-	if reviewResponse != nil {
-		response.Response = reviewResponse
-		response.Response.UID = review.Request.UID
-	}
-	// reset the Object and OldObject, they are not needed in a response.
-	review.Request.Object = runtime.RawExtension{}
-	review.Request.OldObject = runtime.RawExtension{}
+	// the Object and OldObject are not needed in a response, so we don't send the request back.
+	response := webhooks.ToAdmissionReview(review, reviewResponse)
 
 	responseBytes, err := json.Marshal(response)
 	if err != nil {
@@ -101,6 +130,7 @@ func serve(resp http.ResponseWriter, req *http.Request, admit admitFunc) {
 		resp.WriteHeader(http.StatusBadRequest)
 		return
 	}
+	resp.Header().Set("Content-Type", "application/json")
 	if _, err := resp.Write(responseBytes); err != nil {
 		log.Log.Errorf("failed to write webhook response: %v", err)
 		resp.WriteHeader(http.StatusBadRequest)
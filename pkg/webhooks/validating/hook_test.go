@@ -0,0 +1,170 @@
+package validating
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	k6tv1 "kubevirt.io/client-go/api/v1"
+
+	"github.com/kubevirt/kubevirt-template-validator/pkg/validation"
+)
+
+func newAnnotatedVM(cores uint32, rules []validation.Rule) []byte {
+	data, err := json.Marshal(rules)
+	Expect(err).ToNot(HaveOccurred())
+
+	vm := k6tv1.VirtualMachine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "test-vm",
+			Annotations: map[string]string{
+				vmValidationAnnotationKey: string(data),
+			},
+		},
+		Spec: k6tv1.VirtualMachineSpec{
+			Template: &k6tv1.VirtualMachineInstanceTemplateSpec{
+				Spec: k6tv1.VirtualMachineInstanceSpec{
+					Domain: k6tv1.DomainSpec{
+						CPU: &k6tv1.CPU{Cores: cores},
+					},
+				},
+			},
+		},
+	}
+	raw, err := json.Marshal(vm)
+	Expect(err).ToNot(HaveOccurred())
+	return raw
+}
+
+func newAdmissionRequest(apiVersion string, vm []byte) []byte {
+	review := admissionv1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: apiVersion,
+			Kind:       "AdmissionReview",
+		},
+		Request: &admissionv1.AdmissionRequest{
+			UID: types.UID("test-uid"),
+			Resource: metav1.GroupVersionResource{
+				Group:    "kubevirt.io",
+				Version:  "v1alpha3",
+				Resource: "virtualmachines",
+			},
+			Operation: admissionv1.Create,
+			Object:    runtime.RawExtension{Raw: vm},
+		},
+	}
+	data, err := json.Marshal(review)
+	Expect(err).ToNot(HaveOccurred())
+	return data
+}
+
+func postAdmissionReview(body []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, VMTemplateValidatePath, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	ServeVMTemplateValidate(rec, req, false)
+	return rec
+}
+
+var _ = Describe("Hook", func() {
+	coreRules := []validation.Rule{{
+		Name:    "max-cores",
+		Path:    "jsonpath::.spec.domain.cpu.cores",
+		Rule:    "integer",
+		Message: "too many cores",
+		Max:     8,
+	}, {
+		Name:     "suggested-cores",
+		Path:     "jsonpath::.spec.domain.cpu.cores",
+		Rule:     "integer",
+		Message:  "more than 4 cores are not recommended",
+		Max:      4,
+		Severity: validation.SeverityWarning,
+	}}
+
+	Context("with v1 AdmissionReviews", func() {
+		apiVersion := admissionv1.SchemeGroupVersion.String()
+
+		It("should admit and reply with the same version", func() {
+			rec := postAdmissionReview(newAdmissionRequest(apiVersion, newAnnotatedVM(2, coreRules)))
+			Expect(rec.Code).To(Equal(http.StatusOK))
+
+			review := admissionv1.AdmissionReview{}
+			Expect(json.Unmarshal(rec.Body.Bytes(), &review)).To(Succeed())
+			Expect(review.APIVersion).To(Equal(apiVersion))
+			Expect(review.Kind).To(Equal("AdmissionReview"))
+			Expect(review.Request).To(BeNil())
+			Expect(review.Response.UID).To(Equal(types.UID("test-uid")))
+			Expect(review.Response.Allowed).To(BeTrue())
+			Expect(review.Response.Warnings).To(BeEmpty())
+		})
+
+		It("should admit with warnings", func() {
+			rec := postAdmissionReview(newAdmissionRequest(apiVersion, newAnnotatedVM(6, coreRules)))
+			Expect(rec.Code).To(Equal(http.StatusOK))
+
+			review := admissionv1.AdmissionReview{}
+			Expect(json.Unmarshal(rec.Body.Bytes(), &review)).To(Succeed())
+			Expect(review.Response.Allowed).To(BeTrue())
+			Expect(review.Response.Warnings).To(Equal([]string{"more than 4 cores are not recommended: value 6 is higher than maximum [4]"}))
+		})
+
+		It("should reject with causes and warnings", func() {
+			rec := postAdmissionReview(newAdmissionRequest(apiVersion, newAnnotatedVM(16, coreRules)))
+			Expect(rec.Code).To(Equal(http.StatusOK))
+
+			review := admissionv1.AdmissionReview{}
+			Expect(json.Unmarshal(rec.Body.Bytes(), &review)).To(Succeed())
+			Expect(review.Response.Allowed).To(BeFalse())
+			Expect(review.Response.Result.Code).To(Equal(int32(http.StatusUnprocessableEntity)))
+			Expect(review.Response.Result.Details.Causes).To(HaveLen(1))
+			Expect(review.Response.Warnings).To(HaveLen(1))
+		})
+	})
+
+	Context("with v1beta1 AdmissionReviews", func() {
+		apiVersion := v1beta1.SchemeGroupVersion.String()
+
+		It("should admit and reply with the same version", func() {
+			rec := postAdmissionReview(newAdmissionRequest(apiVersion, newAnnotatedVM(2, coreRules)))
+			Expect(rec.Code).To(Equal(http.StatusOK))
+
+			review := v1beta1.AdmissionReview{}
+			Expect(json.Unmarshal(rec.Body.Bytes(), &review)).To(Succeed())
+			Expect(review.APIVersion).To(Equal(apiVersion))
+			Expect(review.Response.UID).To(Equal(types.UID("test-uid")))
+			Expect(review.Response.Allowed).To(BeTrue())
+		})
+
+		It("should reject", func() {
+			rec := postAdmissionReview(newAdmissionRequest(apiVersion, newAnnotatedVM(16, coreRules)))
+			Expect(rec.Code).To(Equal(http.StatusOK))
+
+			review := v1beta1.AdmissionReview{}
+			Expect(json.Unmarshal(rec.Body.Bytes(), &review)).To(Succeed())
+			Expect(review.APIVersion).To(Equal(apiVersion))
+			Expect(review.Response.Allowed).To(BeFalse())
+			Expect(review.Response.Result.Details.Causes).To(HaveLen(1))
+		})
+	})
+
+	Context("with malformed AdmissionReviews", func() {
+		It("should refuse unknown versions", func() {
+			rec := postAdmissionReview(newAdmissionRequest("admission.k8s.io/v2", newAnnotatedVM(2, coreRules)))
+			Expect(rec.Code).To(Equal(http.StatusBadRequest))
+		})
+
+		It("should refuse reviews without request", func() {
+			rec := postAdmissionReview([]byte(`{"apiVersion": "admission.k8s.io/v1", "kind": "AdmissionReview"}`))
+			Expect(rec.Code).To(Equal(http.StatusBadRequest))
+		})
+	})
+})
@@ -0,0 +1,215 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2019 Red Hat, Inc.
+ */
+
+package validating
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	templatev1 "github.com/openshift/api/template/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+
+	k6tv1 "kubevirt.io/client-go/api/v1"
+
+	"github.com/kubevirt/kubevirt-template-validator/pkg/validation"
+)
+
+// The templates are validated when they are created or updated, so a broken validations annotation
+// is reported to the template author, rather than rejecting every VM created from the template later.
+// The VMs embedded in the template are checked against their rules too, with the parameters
+// replaced by their default values, like `oc process` does, and their failures are reported as warnings.
+// The parameters without a default value are replaced by a placeholder made from their name
+// (e.g. "${NAME}" becomes "name"), because most of them are names; a VM which uses them
+// as non-string values (e.g. "${{CPU_CORES}}") can't be checked.
+
+// parameterRef matches the references to the template parameters: "${NAME}", or "${{NAME}}"
+// for the non-string values, which must be quoted strings on their own.
+var parameterRef = regexp.MustCompile(`"\$\{\{([a-zA-Z0-9_]+)\}\}"|\$\{([a-zA-Z0-9_]+)\}`)
+
+// ValidateTemplate returns the causes of the rejection of the template, if any, and
+// the warnings which should be reported back to the user regardless of the outcome.
+func ValidateTemplate(tmpl *templatev1.Template) ([]metav1.StatusCause, []string) {
+	var causes []metav1.StatusCause
+	var warnings []string
+
+	rs, ruleCauses, lintWarnings := compileRuleSet(tmpl.Annotations[annotationValidationKey], "metadata.annotations."+annotationValidationKey)
+	if len(ruleCauses) > 0 {
+		return ruleCauses, nil
+	}
+	warnings = append(warnings, lintWarnings...)
+	if rs != nil {
+		key, err := cache.MetaNamespaceKeyFunc(tmpl)
+		if err == nil {
+			rs = rs.WithSource("template " + key)
+		}
+	}
+
+	for i := range tmpl.Objects {
+		field := fmt.Sprintf("objects[%d]", i)
+		vm, unset, err := processVirtualMachine(tmpl.Objects[i].Raw, tmpl.Parameters)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("%s not checked: %v", field, err))
+			continue
+		}
+		if vm == nil {
+			// not a VM
+			continue
+		}
+		vmCauses, vmWarnings := validateEmbeddedVM(vm, rs, field, unset)
+		causes = append(causes, vmCauses...)
+		warnings = append(warnings, vmWarnings...)
+	}
+	return causes, warnings
+}
+
+// compileRuleSet compiles the rules found on the given field. Only the broken rules, which can't
+// be parsed or compiled, are causes: they would reject every VM using them. The other issues
+// found by the linter are just advice, e.g. a path unknown to the KubeVirt version we were built
+// with may be known to the cluster, so they are returned as warnings.
+// No rules at all are not an issue: the RuleSet is nil.
+func compileRuleSet(data, field string) (*validation.RuleSet, []metav1.StatusCause, []string) {
+	if strings.TrimSpace(data) == "" {
+		return nil, nil, nil
+	}
+	rs, err := validation.CompileRules([]byte(data))
+	if err != nil {
+		return nil, []metav1.StatusCause{{
+			Type:    metav1.CauseTypeFieldValueInvalid,
+			Field:   field,
+			Message: err.Error(),
+		}}, nil
+	}
+	var causes []metav1.StatusCause
+	for _, issue := range rs.CompileErrors() {
+		causes = append(causes, metav1.StatusCause{
+			Type:    metav1.CauseTypeFieldValueInvalid,
+			Field:   field,
+			Message: issue.String(),
+		})
+	}
+	if len(causes) > 0 {
+		return nil, causes, nil
+	}
+	var warnings []string
+	for _, issue := range validation.Lint([]byte(data)) {
+		warnings = append(warnings, fmt.Sprintf("%s: %s", field, issue.String()))
+	}
+	return rs, nil, warnings
+}
+
+// validateEmbeddedVM checks the VM against its own rules, like the VM admission would:
+// the rules in its annotation, if any, or the rules of the template. Only the broken rules
+// of its annotation are causes, the rules it doesn't satisfy are warnings.
+func validateEmbeddedVM(vm *k6tv1.VirtualMachine, rs *validation.RuleSet, field string, unset []string) ([]metav1.StatusCause, []string) {
+	if _, skip := vm.Annotations[vmSkipValidationAnnotationKey]; skip {
+		return nil, nil
+	}
+	var warnings []string
+	if data := vm.Annotations[vmValidationAnnotationKey]; data != "" {
+		var causes []metav1.StatusCause
+		rs, causes, warnings = compileRuleSet(data, field+".metadata.annotations."+vmValidationAnnotationKey)
+		if len(causes) > 0 {
+			return causes, nil
+		}
+		if rs != nil {
+			rs = rs.WithSource("VM annotation " + vmValidationAnnotationKey)
+		}
+	}
+	if rs == nil || vm.Spec.Template == nil {
+		return nil, warnings
+	}
+
+	if len(unset) > 0 {
+		warnings = append(warnings, fmt.Sprintf("%s checked with placeholders for the parameters without a default value: %s", field, strings.Join(unset, ", ")))
+	}
+	// The default values are just a starting point, which the users are expected to tweak,
+	// so the VMs which don't satisfy the rules don't make the template unusable.
+	causes, vmWarnings := ValidateVMTemplateRuleSet(rs, vm, nil, false)
+	warnings = append(warnings, vmWarnings...)
+	for _, cause := range causes {
+		causeField := field
+		if cause.Field != "" {
+			causeField = field + "." + cause.Field
+		}
+		warnings = append(warnings, fmt.Sprintf("%s: %s", causeField, cause.Message))
+	}
+	return nil, warnings
+}
+
+// processVirtualMachine decodes the object if it is a VirtualMachine, replacing the parameters
+// with their default values. Returns the names of the parameters without a default value.
+func processVirtualMachine(raw []byte, params []templatev1.Parameter) (*k6tv1.VirtualMachine, []string, error) {
+	var meta metav1.TypeMeta
+	if err := json.Unmarshal(raw, &meta); err != nil {
+		return nil, nil, err
+	}
+	if meta.Kind != "VirtualMachine" || !strings.HasPrefix(meta.APIVersion, "kubevirt.io/") {
+		return nil, nil, nil
+	}
+
+	values := make(map[string]string)
+	for _, p := range params {
+		values[p.Name] = p.Value
+	}
+	unset := make(map[string]bool)
+	var processErr error
+	processed := parameterRef.ReplaceAllFunc(raw, func(ref []byte) []byte {
+		m := parameterRef.FindSubmatch(ref)
+		if len(m[1]) > 0 {
+			// non-string value, the JSON literal as-is
+			value, ok := values[string(m[1])]
+			if !ok || value == "" {
+				processErr = fmt.Errorf("parameter %s has no default value", m[1])
+				return ref
+			}
+			if !json.Valid([]byte(value)) {
+				quoted, _ := json.Marshal(value)
+				return quoted
+			}
+			return []byte(value)
+		}
+		name := string(m[2])
+		value, ok := values[name]
+		if !ok || value == "" {
+			unset[name] = true
+			value = strings.Replace(strings.ToLower(name), "_", "-", -1)
+		}
+		quoted, _ := json.Marshal(value)
+		// the value is within a JSON string already
+		return quoted[1 : len(quoted)-1]
+	})
+	if processErr != nil {
+		return nil, nil, processErr
+	}
+
+	vm := k6tv1.VirtualMachine{}
+	if err := json.Unmarshal(processed, &vm); err != nil {
+		return nil, nil, err
+	}
+	var names []string
+	for name := range unset {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return &vm, names, nil
+}
@@ -0,0 +1,268 @@
+package validating
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	templatev1 "github.com/openshift/api/template/v1"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+const templateVM = `{
+  "apiVersion": "kubevirt.io/v1alpha3",
+  "kind": "VirtualMachine",
+  "metadata": {"name": "${NAME}"},
+  "spec": {
+    "running": false,
+    "template": {
+      "spec": {
+        "domain": {
+          "cpu": {"cores": "${{CPU_CORES}}"},
+          "devices": {}
+        }
+      }
+    }
+  }
+}`
+
+const templateRules = `[{
+  "name": "max-cores",
+  "path": "jsonpath::.spec.domain.cpu.cores",
+  "rule": "integer",
+  "message": "too many cores",
+  "max": 8
+}]`
+
+func newTemplate(rules string, params []templatev1.Parameter, objects ...string) *templatev1.Template {
+	tmpl := &templatev1.Template{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-template",
+			Namespace: "openshift",
+			Annotations: map[string]string{
+				annotationValidationKey: rules,
+			},
+		},
+		Parameters: params,
+	}
+	for _, obj := range objects {
+		tmpl.Objects = append(tmpl.Objects, runtime.RawExtension{Raw: []byte(obj)})
+	}
+	return tmpl
+}
+
+func postTemplateAdmissionReview(tmpl *templatev1.Template) *admissionv1.AdmissionResponse {
+	raw, err := json.Marshal(tmpl)
+	Expect(err).ToNot(HaveOccurred())
+	review := admissionv1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: admissionv1.SchemeGroupVersion.String(),
+			Kind:       "AdmissionReview",
+		},
+		Request: &admissionv1.AdmissionRequest{
+			UID: types.UID("test-uid"),
+			Resource: metav1.GroupVersionResource{
+				Group:    "template.openshift.io",
+				Version:  "v1",
+				Resource: "templates",
+			},
+			Operation: admissionv1.Create,
+			Object:    runtime.RawExtension{Raw: raw},
+		},
+	}
+	body, err := json.Marshal(review)
+	Expect(err).ToNot(HaveOccurred())
+
+	req := httptest.NewRequest(http.MethodPost, TemplateValidatePath, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	ServeTemplateValidate(rec, req)
+	Expect(rec.Code).To(Equal(http.StatusOK))
+
+	reply := admissionv1.AdmissionReview{}
+	Expect(json.Unmarshal(rec.Body.Bytes(), &reply)).To(Succeed())
+	Expect(reply.Response).ToNot(BeNil())
+	Expect(reply.Response.UID).To(Equal(types.UID("test-uid")))
+	return reply.Response
+}
+
+// readTemplates decodes all the templates found in the (multi-document) YAML file.
+func readTemplates(path string) []templatev1.Template {
+	data, err := ioutil.ReadFile(path)
+	Expect(err).ToNot(HaveOccurred())
+
+	var tmpls []templatev1.Template
+	decoder := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), 4096)
+	for {
+		tmpl := templatev1.Template{}
+		err := decoder.Decode(&tmpl)
+		if err == io.EOF {
+			break
+		}
+		Expect(err).ToNot(HaveOccurred(), path)
+		if tmpl.Kind == "Template" {
+			tmpls = append(tmpls, tmpl)
+		}
+	}
+	return tmpls
+}
+
+var _ = Describe("Template", func() {
+	cores := func(value string) []templatev1.Parameter {
+		return []templatev1.Parameter{{Name: "NAME"}, {Name: "CPU_CORES", Value: value}}
+	}
+
+	It("should admit a template without rules", func() {
+		causes, warnings := ValidateTemplate(newTemplate("", cores("16"), templateVM))
+		Expect(causes).To(BeEmpty())
+		Expect(warnings).To(BeEmpty())
+	})
+
+	It("should reject the broken rules", func() {
+		causes, _ := ValidateTemplate(newTemplate(`[{"name": "max-cores", "rule": "integer", "path": "jsonpath::.spec.domain.cpu.cores", "maxx": 8}]`, cores("2"), templateVM))
+		Expect(causes).ToNot(BeEmpty())
+		for _, c := range causes {
+			Expect(c.Type).To(Equal(metav1.CauseTypeFieldValueInvalid))
+			Expect(c.Field).To(Equal("metadata.annotations.validations"))
+		}
+		Expect(causes[0].Message).To(ContainSubstring("maxx"))
+	})
+
+	It("should reject the rules which can't be parsed", func() {
+		causes, _ := ValidateTemplate(newTemplate(`[{"name": `, cores("2"), templateVM))
+		Expect(causes).To(HaveLen(1))
+		Expect(causes[0].Field).To(Equal("metadata.annotations.validations"))
+	})
+
+	It("should reject the rules which can't be compiled", func() {
+		causes, _ := ValidateTemplate(newTemplate(`[{"name": "vm-name", "rule": "regex", "path": "jsonpath::.metadata.name", "message": "bad name", "regex": "[a-z"}]`, cores("2"), templateVM))
+		Expect(causes).To(HaveLen(1))
+		Expect(causes[0].Field).To(Equal("metadata.annotations.validations"))
+		Expect(causes[0].Message).To(ContainSubstring("rules[0] (vm-name) regex"))
+	})
+
+	It("should only warn about the other lint issues", func() {
+		rules := `[{"name": "max-cores", "rule": "integer", "path": "jsonpath::.spec.domain.cpu.cores", "message": "too many cores", "max": 8, "regex": "[0-9]+"}]`
+		causes, warnings := ValidateTemplate(newTemplate(rules, cores("2"), templateVM))
+		Expect(causes).To(BeEmpty())
+		Expect(warnings).To(ContainElement("metadata.annotations.validations: rules[0] (max-cores) regex: not used by integer rules"))
+
+		rules = `[{"name": "new-field", "rule": "integer", "path": "jsonpath::.spec.domain.cpu.someNewField", "message": "too many", "max": 8}]`
+		causes, warnings = ValidateTemplate(newTemplate(rules, nil))
+		Expect(causes).To(BeEmpty())
+		Expect(warnings).To(ConsistOf(HavePrefix("metadata.annotations.validations: rules[0] (new-field) path: ")))
+	})
+
+	It("should check the VMs with the default values of the parameters", func() {
+		causes, warnings := ValidateTemplate(newTemplate(templateRules, cores("2"), templateVM))
+		Expect(causes).To(BeEmpty())
+		Expect(warnings).To(ConsistOf("objects[0] checked with placeholders for the parameters without a default value: NAME"))
+
+		causes, warnings = ValidateTemplate(newTemplate(templateRules, cores("16"), templateVM))
+		Expect(causes).To(BeEmpty())
+		Expect(warnings).To(HaveLen(2))
+		Expect(warnings[1]).To(HavePrefix("objects[0].spec.template.spec.domain.cpu.cores: "))
+		Expect(warnings[1]).To(ContainSubstring("too many cores"))
+		Expect(warnings[1]).To(ContainSubstring("source: template openshift/test-template"))
+	})
+
+	It("should reject the broken rules of the VMs", func() {
+		vm := `{
+  "apiVersion": "kubevirt.io/v1alpha3",
+  "kind": "VirtualMachine",
+  "metadata": {"name": "test-vm", "annotations": {"vm.kubevirt.io/validations": "[{\"name\": \"vm-name\", \"rule\": \"regex\", \"path\": \"jsonpath::.metadata.name\", \"message\": \"bad name\", \"regex\": \"[a-z\"}]"}},
+  "spec": {"template": {"spec": {"domain": {"cpu": {"cores": 2}, "devices": {}}}}}
+}`
+		causes, _ := ValidateTemplate(newTemplate(templateRules, nil, vm))
+		Expect(causes).To(HaveLen(1))
+		Expect(causes[0].Field).To(Equal("objects[0].metadata.annotations.vm.kubevirt.io/validations"))
+	})
+
+	It("should skip the VMs using non-string parameters without a default value", func() {
+		causes, warnings := ValidateTemplate(newTemplate(templateRules, cores(""), templateVM))
+		Expect(causes).To(BeEmpty())
+		Expect(warnings).To(ConsistOf("objects[0] not checked: parameter CPU_CORES has no default value"))
+	})
+
+	It("should ignore the objects which are not VMs", func() {
+		causes, warnings := ValidateTemplate(newTemplate(templateRules, cores("16"), `{"apiVersion": "v1", "kind": "Service", "metadata": {"name": "${NAME}"}}`))
+		Expect(causes).To(BeEmpty())
+		Expect(warnings).To(BeEmpty())
+	})
+
+	It("should prefer the rules of the VM annotation", func() {
+		vm := `{
+  "apiVersion": "kubevirt.io/v1alpha3",
+  "kind": "VirtualMachine",
+  "metadata": {"name": "test-vm", "annotations": {"vm.kubevirt.io/validations": "[{\"name\": \"min-cores\", \"rule\": \"integer\", \"path\": \"jsonpath::.spec.domain.cpu.cores\", \"message\": \"not enough cores\", \"min\": 32}]"}},
+  "spec": {"template": {"spec": {"domain": {"cpu": {"cores": 16}, "devices": {}}}}}
+}`
+		causes, warnings := ValidateTemplate(newTemplate(templateRules, nil, vm))
+		Expect(causes).To(BeEmpty())
+		Expect(warnings).To(ConsistOf(ContainSubstring("not enough cores")))
+	})
+
+	Context("with the shipped templates", func() {
+		It("should admit the common templates", func() {
+			tmpls := readTemplates("../../../hack/env/common-templates.yaml")
+			Expect(tmpls).ToNot(BeEmpty())
+			for i := range tmpls {
+				causes, _ := ValidateTemplate(&tmpls[i])
+				Expect(causes).To(BeEmpty(), tmpls[i].Name)
+			}
+		})
+
+		It("should admit the functests templates, except the invalid ones", func() {
+			admitted, rejected := 0, 0
+			err := filepath.Walk("../../../functests/manifests", func(path string, info os.FileInfo, err error) error {
+				if err != nil || info.IsDir() || filepath.Ext(path) != ".yaml" {
+					return err
+				}
+				invalid := strings.Contains(path, "/invalid/")
+				for _, tmpl := range readTemplates(path) {
+					causes, _ := ValidateTemplate(&tmpl)
+					if invalid {
+						Expect(causes).ToNot(BeEmpty(), path)
+						rejected++
+					} else {
+						Expect(causes).To(BeEmpty(), path)
+						admitted++
+					}
+				}
+				return nil
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(admitted).ToNot(BeZero())
+			Expect(rejected).ToNot(BeZero())
+		})
+	})
+
+	Context("with AdmissionReviews", func() {
+		It("should admit with warnings", func() {
+			resp := postTemplateAdmissionReview(newTemplate(templateRules, cores("2"), templateVM))
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(resp.Warnings).To(HaveLen(1))
+		})
+
+		It("should reject with causes", func() {
+			resp := postTemplateAdmissionReview(newTemplate(`[{"name": "vm-name", "rule": "regex", "path": "jsonpath::.metadata.name", "message": "bad name", "regex": "[a-z"}]`, cores("2"), templateVM))
+			Expect(resp.Allowed).To(BeFalse())
+			Expect(resp.Result).ToNot(BeNil())
+			Expect(resp.Result.Details).ToNot(BeNil())
+			Expect(resp.Result.Details.Causes).To(HaveLen(1))
+			Expect(resp.Result.Details.Causes[0].Field).To(Equal("metadata.annotations.validations"))
+		})
+	})
+})
@@ -22,6 +22,7 @@ import (
 	"fmt"
 
 	templatev1 "github.com/openshift/api/template/v1"
+	"k8s.io/client-go/tools/cache"
 
 	k6tv1 "kubevirt.io/client-go/api/v1"
 	"kubevirt.io/client-go/log"
@@ -115,33 +116,91 @@ func getParentTemplateForVM(vm *k6tv1.VirtualMachine) (*templatev1.Template, err
 	return tmpl.DeepCopy(), nil
 }
 
-func getValidationRulesFromTemplate(tmpl *templatev1.Template) ([]validation.Rule, error) {
-	return validation.ParseRules([]byte(tmpl.Annotations[annotationValidationKey]))
+// templateRuleSets holds the compiled rules of the templates, keyed by the template namespace/name.
+var templateRuleSets = validation.NewRuleSetCache(templateRuleSetCacheSize)
+
+// vmRuleSets holds the compiled rules of the VM annotations, keyed by the hash of their content,
+// because many VMs usually carry the very same rules. It has its own cache, so the VMs can't
+// evict the rules of the templates.
+var vmRuleSets = validation.NewRuleSetCache(vmRuleSetCacheSize)
+
+// noRules is shared by all the VMs without rules, so their admission does no work at all.
+var noRules = validation.NewRuleSet(nil)
+
+const (
+	templateRuleSetCacheSize int = 512
+	vmRuleSetCacheSize       int = 128
+)
+
+// RegisterTemplateInvalidation makes sure the cached rules of a template are dropped
+// as soon as the template changes or is deleted.
+func RegisterTemplateInvalidation(informer cache.SharedIndexInformer) {
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			invalidateTemplateRuleSet(newObj)
+		},
+		DeleteFunc: invalidateTemplateRuleSet,
+	})
+}
+
+func invalidateTemplateRuleSet(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		log.Log.V(4).Warningf("cannot invalidate rules for template: %v", err)
+		return
+	}
+	log.Log.V(8).Infof("invalidating rules for template %s", key)
+	templateRuleSets.Invalidate(key)
+}
+
+func getValidationRuleSetFromTemplate(tmpl *templatev1.Template) (*validation.RuleSet, error) {
+	key, err := cache.MetaNamespaceKeyFunc(tmpl)
+	if err != nil {
+		return nil, err
+	}
+	rs, err := templateRuleSets.Get(key, []byte(tmpl.Annotations[annotationValidationKey]))
+	if err != nil {
+		return nil, err
+	}
+	return rs.WithSource("template " + key), nil
 }
 
-func getValidationRulesFromVM(vm *k6tv1.VirtualMachine) ([]validation.Rule, error) {
-	return validation.ParseRules([]byte(vm.Annotations[vmValidationAnnotationKey]))
+func getValidationRuleSetFromVM(vm *k6tv1.VirtualMachine) (*validation.RuleSet, error) {
+	data := []byte(vm.Annotations[vmValidationAnnotationKey])
+	rs, err := vmRuleSets.Get("sha256:"+validation.HashRules(data), data)
+	if err != nil {
+		return nil, err
+	}
+	return rs.WithSource("VM annotation " + vmValidationAnnotationKey), nil
+}
+
+func getValidationRuleSetForVM(vm *k6tv1.VirtualMachine) (*validation.RuleSet, error) {
+	return SelectRuleSetForVM(vm, func() (*validation.RuleSet, error) {
+		tmpl, err := getParentTemplateForVM(vm)
+		if tmpl == nil || err != nil {
+			// no template resources (kubevirt deployed on kubernetes, not OKD/OCP) or
+			// no parent template for this VM. In either case, we have nothing to do,
+			// and err is automatically correct
+			return noRules, err
+		}
+		return getValidationRuleSetFromTemplate(tmpl)
+	})
 }
 
-func getValidationRulesForVM(vm *k6tv1.VirtualMachine) ([]validation.Rule, error) {
+// SelectRuleSetForVM returns the rules the admission evaluates on the VM: none if the VM skips
+// the validation, the rules of its own annotation if any, or the rules of its template otherwise,
+// which are returned by templateRuleSet.
+func SelectRuleSetForVM(vm *k6tv1.VirtualMachine, templateRuleSet func() (*validation.RuleSet, error)) (*validation.RuleSet, error) {
 	// If the VM has the 'vm.kubevirt.io/skip-validations' annotations, skip validation
 	if _, skip := vm.Annotations[vmSkipValidationAnnotationKey]; skip {
 		log.Log.V(8).Infof("skipped validation for VM [%s] in namespace [%s]", vm.Name, vm.Namespace)
-		return []validation.Rule{}, nil
+		return noRules, nil
 	}
 
 	// If the VM has the 'vm.kubevirt.io/validations' annotation applied, we will use the validation rules
 	// it contains instead of the validation rules from the template.
 	if vm.Annotations[vmValidationAnnotationKey] != "" {
-		return getValidationRulesFromVM(vm)
-	}
-
-	tmpl, err := getParentTemplateForVM(vm)
-	if tmpl == nil || err != nil {
-		// no template resources (kubevirt deployed on kubernetes, not OKD/OCP) or
-		// no parent template for this VM. In either case, we have nothing to do,
-		// and err is automatically correct
-		return []validation.Rule{}, err
+		return getValidationRuleSetFromVM(vm)
 	}
-	return getValidationRulesFromTemplate(tmpl)
+	return templateRuleSet()
 }